@@ -1,23 +1,68 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/iankencruz/sabiflow/internal/application"
 )
 
+// shutdownTimeout bounds how long in-flight requests get to finish.
+const shutdownTimeout = 15 * time.Second
+
 func main() {
 	app, err := application.NewApplication()
 	if err != nil {
 		log.Fatal(err)
 	}
 	cfg := app.Config
+	defer app.DB.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		app.SessionSweeper.Run(ctx)
+	}()
+
+	server := &http.Server{
+		Addr:    ":" + cfg.Port,
+		Handler: application.Routes(app),
+	}
+
+	// Shutdown drains in-flight requests, but ListenAndServe returns as
+	// soon as it starts; drained is closed once it has finished.
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		log.Println("Shutting down server")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Println("Error shutting down server:", err)
+		}
+	}()
 
 	log.Println("Starting server on port", cfg.Port)
-	err = http.ListenAndServe(":"+cfg.Port, application.Routes(app))
-	if err != nil {
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("Error starting server:", err)
 	}
 
+	// Wait for requests, the emails they queued and the sweeper before the
+	// deferred pool close.
+	<-drained
+	app.AuthService.Wait()
+	wg.Wait()
 }
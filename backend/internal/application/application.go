@@ -2,10 +2,19 @@ package application
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"os"
 
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/iankencruz/sabiflow/internal/auth"
+	"github.com/iankencruz/sabiflow/internal/platform/encryption"
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/iankencruz/sabiflow/internal/platform/password"
 	"github.com/iankencruz/sabiflow/internal/shared/logger"
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/iankencruz/sabiflow/internal/shared/policy"
+	"github.com/iankencruz/sabiflow/internal/shared/privacy"
 	"github.com/iankencruz/sabiflow/internal/shared/sessions"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -16,8 +25,14 @@ type Application struct {
 	DB             *pgxpool.Pool
 	Logger         *slog.Logger
 	AuthHandler    *auth.AuthHandler
+	AuthService    *auth.AuthServiceImpl
 	SessionManager *sessions.Manager
+	SessionSweeper sessions.Sweeper
 	UserRepo       auth.UserRepository
+	Mailer         mail.Sender
+	Authorizer     *middleware.Authorizer
+	Policies       *policy.Engine
+	Privacy        *privacy.Registry
 }
 
 func NewApplication() (*Application, error) {
@@ -32,14 +47,116 @@ func NewApplication() (*Application, error) {
 	// Initialize the Logger
 	log := logger.New(cfg.Env)
 	// Initialize the Session Manager
-	sessionManager := sessions.NewManager(db)
+	sessionManager := sessions.NewManager(sessions.NewPostgresStore(db), sessions.Config{
+		CookieName:       cfg.SessionCookieName,
+		Domain:           cfg.SessionCookieDomain,
+		Secure:           cfg.SessionSecure,
+		SameSite:         sessions.ParseSameSite(cfg.SessionSameSite),
+		IdleTimeout:      cfg.SessionIdleTimeout,
+		RefreshThreshold: cfg.SessionRefreshThreshold,
+		RememberMe:       cfg.SessionRememberMe,
+		AbsoluteLifetime: cfg.SessionAbsoluteLifetime,
+	})
+
+	// Initialize the Mailer (log-only unless SMTP is configured)
+	var mailer mail.Sender = mail.NewLogSender(log)
+	if cfg.SMTPHost != "" {
+		mailer = mail.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+
+	// Initialize the Cipher for secrets at rest
+	cipher, err := newCipher(cfg, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize WebAuthn (passkeys)
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     cfg.WebAuthnRPOrigins,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize password hashing and the password policy
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Modules register what they hold about a person for data-protection
+	// export and erasure; auth goes first so the account is erased last
+	privacyRegistry := privacy.NewRegistry()
 
 	userRepo := auth.NewUserRepository(db)
-	authService := &auth.AuthServiceImpl{Repo: userRepo}
+	authService := &auth.AuthServiceImpl{
+		Repo:                 userRepo,
+		Mailer:               mailer,
+		Logger:               log,
+		FrontendURL:          cfg.FrontendURL,
+		PasswordResetTTL:     cfg.PasswordResetTTL,
+		EmailVerificationTTL: cfg.EmailVerificationTTL,
+		Cipher:               cipher,
+		TOTPIssuer:           cfg.TOTPIssuer,
+		MFAChallengeTTL:      cfg.MFAChallengeTTL,
+		ReauthWindow:         cfg.ReauthWindow,
+		WebAuthn:             webAuthn,
+		OpenRegistration:     cfg.OpenRegistration,
+		InvitationTTL:        cfg.InvitationTTL,
+		Principals:           auth.NewPrincipalCache(cfg.PermissionCacheTTL),
+		Passwords: password.NewArgon2id(password.Params{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+		}),
+		PasswordPolicy: passwordPolicy,
+		PasswordResetLimits: auth.RequestLimits{
+			MaxPerAccount: cfg.PasswordResetMaxPerAccount,
+			MaxPerIP:      cfg.PasswordResetMaxPerIP,
+			Window:        cfg.PasswordResetWindow,
+		},
+		MagicLinks: auth.MagicLinkSettings{
+			Enabled:       cfg.MagicLinkEnabled,
+			TTL:           cfg.MagicLinkTTL,
+			URL:           cfg.APIURL + "/api/v1/auth/magic-link/",
+			MaxPerAccount: cfg.MagicLinkMaxPerAccount,
+			MaxPerIP:      cfg.MagicLinkMaxPerIP,
+			Window:        cfg.MagicLinkWindow,
+		},
+		LoginThrottle: auth.LoginThrottle{
+			MaxAttempts:   cfg.LoginMaxAttempts,
+			IPMaxAttempts: cfg.LoginIPMaxAttempts,
+			Window:        cfg.LoginAttemptWindow,
+			Lockout:       cfg.LoginLockout,
+			MaxLockout:    cfg.LoginMaxLockout,
+		},
+		Privacy:       privacyRegistry,
+		DataExportTTL: cfg.DataExportTTL,
+	}
+	privacyRegistry.Register(authService.PersonalDataSources()...)
+
+	// Keep the permission catalogue in step with the codes modules register
+	if err := authService.SyncPermissions(context.Background()); err != nil {
+		return nil, err
+	}
+
 	authHandler := &auth.AuthHandler{
-		Service:        authService,
-		SessionManager: sessionManager,
-		Logger:         log,
+		Service:         authService,
+		SessionManager:  sessionManager,
+		Logger:          log,
+		FrontendURL:     cfg.FrontendURL,
+		OAuthSuccessURL: cfg.OAuthSuccessURL,
+		Providers:       auth.NewProviderRegistry(cfg.OIDCProviders),
+	}
+
+	// Purges expired sessions in the background; see cmd/api
+	sessionSweeper := sessions.Sweeper{
+		Sessions:  sessionManager,
+		Interval:  cfg.SessionSweepInterval,
+		BatchSize: cfg.SessionSweepBatchSize,
+		Logger:    log,
 	}
 
 	return &Application{
@@ -47,7 +164,61 @@ func NewApplication() (*Application, error) {
 		DB:             db,
 		Logger:         log,
 		AuthHandler:    authHandler,
+		AuthService:    authService,
 		SessionManager: sessionManager,
+		SessionSweeper: sessionSweeper,
 		UserRepo:       userRepo,
+		Mailer:         mailer,
+		Authorizer:     middleware.NewAuthorizer(sessionManager, authService),
+		Policies:       policy.NewEngine(db),
+		Privacy:        privacyRegistry,
 	}, nil
 }
+
+// newPasswordPolicy builds the password policy from config, loading the
+// breached-password list when one is configured.
+func newPasswordPolicy(cfg *Config) (*password.Policy, error) {
+	rules := &password.Policy{
+		MinLength:      cfg.PasswordMinLength,
+		RequireUpper:   cfg.PasswordRequireUpper,
+		RequireNumber:  cfg.PasswordRequireNumber,
+		RequireSpecial: cfg.PasswordRequireSpecial,
+	}
+	if cfg.BreachedPasswordsFile == "" {
+		return rules, nil
+	}
+
+	// Small lists are loaded into memory; anything bigger must be a sorted
+	// SHA-1 list, which is searched on disk
+	info, err := os.Stat(cfg.BreachedPasswordsFile)
+	if err != nil {
+		return nil, err
+	}
+	load := rules.LoadBreachedList
+	if info.Size() > password.MaxBreachedListSize {
+		load = rules.OpenSortedBreachedList
+	}
+	if err := load(cfg.BreachedPasswordsFile); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// newCipher builds the at-rest cipher from config. In development a missing
+// key falls back to a random one, which means 2FA enrolments do not survive
+// a restart; anywhere else it is an error.
+func newCipher(cfg *Config, log *slog.Logger) (*encryption.Cipher, error) {
+	if cfg.EncryptionKey != "" {
+		return encryption.NewCipherFromBase64(cfg.EncryptionKey)
+	}
+	if cfg.Env != "development" {
+		return nil, errors.New("APP_ENCRYPTION_KEY is required outside development")
+	}
+
+	log.Warn("APP_ENCRYPTION_KEY not set, using an ephemeral key")
+	key, err := encryption.RandomKey()
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewCipher(key)
+}
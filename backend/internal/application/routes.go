@@ -9,17 +9,16 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 
-	mw "github.com/iankencruz/sabiflow/internal/shared/middleware" // RequireAuth, Can, …
-	"github.com/iankencruz/sabiflow/internal/shared/response"      // WriteJSON helper
+	"github.com/iankencruz/sabiflow/internal/shared/response" // WriteJSON helper
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
 )
 
 // Router returns the fully-wired chi router.
 // Call this from cmd/api/main.go *after* you construct Application.
 func Routes(app *Application) *chi.Mux {
-	//--------------------------------------------------------------------
-	// One-time injection so the simple Can/CanAny/CanAll wrappers work
-	//--------------------------------------------------------------------
-	mw.InitPermissionMiddleware(app.SessionManager, app.UserRepo)
+	// RequireAuth, Can, CanAny, CanAll, …
+	authz := app.Authorizer
 
 	//--------------------------------------------------------------------
 	// Root router + global middleware
@@ -29,17 +28,33 @@ func Routes(app *Application) *chi.Mux {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", sessions.CSRFHeader, tenant.Header},
 		AllowCredentials: true,
 	}))
+	// Behind a reverse proxy, take the client address from its headers
+	// (TRUSTED_PROXIES) so logs and per-IP limits see the real caller
+	r.Use(sessions.TrustedProxies{Networks: app.Config.TrustedProxies}.Middleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
+	// Which studio the request is for: X-Studio header, /api/v1/s/{slug}/…
+	// or a subdomain of STUDIO_BASE_DOMAIN. RequireAuth checks membership.
+	r.Use(tenant.Resolver{
+		PathPrefix: "/api/v1",
+		BaseDomain: app.Config.StudioBaseDomain,
+	}.Middleware)
+
 	//--------------------------------------------------------------------
 	// API v1
 	//--------------------------------------------------------------------
 	r.Route("/api", func(r chi.Router) {
 		r.Route("/v1", func(r chi.Router) {
+			// Unsafe requests authenticated by cookie need a matching
+			// X-CSRF-Token and a trusted Origin; Bearer requests are exempt
+			r.Use(sessions.CSRF{
+				Sessions:       app.SessionManager,
+				TrustedOrigins: app.Config.CSRFTrustedOrigins,
+			}.Middleware)
 
 			// ---------------- Health check ----------------
 			r.Get("/ping", func(w http.ResponseWriter, _ *http.Request) {
@@ -51,28 +66,197 @@ func Routes(app *Application) *chi.Mux {
 			r.Route("/auth", func(r chi.Router) {
 				r.Post("/login", app.AuthHandler.LoginHandler)
 				r.Post("/register", app.AuthHandler.RegisterHandler)
+				r.Get("/registration", app.AuthHandler.RegistrationStatusHandler)
 				r.Post("/logout", app.AuthHandler.LogoutHandler)
+				r.Get("/csrf", app.AuthHandler.CSRFTokenHandler)
+
+				// Password reset
+				r.Post("/password/forgot", app.AuthHandler.ForgotPasswordHandler)
+				r.Post("/password/reset", app.AuthHandler.ResetPasswordHandler)
+
+				// Team invitations
+				r.Post("/invitations/lookup", app.AuthHandler.InvitationLookupHandler)
+				r.Post("/invitations/accept", app.AuthHandler.AcceptInvitationHandler)
 
-				// Google OAuth2
-				r.HandleFunc("/google/login", app.AuthHandler.GoogleLogin)
-				r.HandleFunc("/google/callback", app.AuthHandler.GoogleCallback)
+				// Email verification
+				r.Post("/email/verify", app.AuthHandler.VerifyEmailHandler)
+				r.Post("/email/change/confirm", app.AuthHandler.ConfirmEmailChangeHandler)
+
+				// Second step of a 2FA login (pending token + code)
+				r.Post("/2fa/verify", app.AuthHandler.TwoFactorVerifyHandler)
+
+				// Passwordless magic-link login
+				r.Post("/magic-link", app.AuthHandler.RequestMagicLinkHandler)
+				r.Get("/magic-link/{token}", app.AuthHandler.MagicLinkLoginHandler)
+
+				// Passwordless passkey login
+				r.Post("/passkeys/login/begin", app.AuthHandler.PasskeyLoginBeginHandler)
+				r.Post("/passkeys/login/finish", app.AuthHandler.PasskeyLoginFinishHandler)
+
+				// OpenID Connect single sign-on (google, keycloak, …)
+				r.Get("/providers", app.AuthHandler.ListProvidersHandler)
+				r.Get("/{provider}/login", app.AuthHandler.OAuthLogin)
+				r.Get("/{provider}/callback", app.AuthHandler.OAuthCallback)
 
 				// Front-end uses this once per tab
 				r.Get("/me", app.AuthHandler.GetAuthenticatedUser)
+
+				// Ends an impersonation session started from /admin/users
+				r.With(authz.RequireSession()).Post(
+					"/impersonation/stop", app.AuthHandler.StopImpersonationHandler)
+
+				// Device / session inventory for the signed-in user. These
+				// manage credentials, so Bearer tokens are not accepted and
+				// impersonating administrators are kept out.
+				r.Group(func(r chi.Router) {
+					r.Use(authz.RequireSession())
+					r.Use(authz.DenyImpersonation())
+
+					r.Get("/sessions", app.AuthHandler.ListSessionsHandler)
+					r.Delete("/sessions/others", app.AuthHandler.RevokeOtherSessionsHandler)
+					r.Delete("/sessions/{sessionID}", app.AuthHandler.RevokeSessionHandler)
+
+					r.Post("/email/verify/resend", app.AuthHandler.ResendVerificationHandler)
+
+					// Self-service profile and credentials
+					r.Patch("/me", app.AuthHandler.UpdateProfileHandler)
+					r.Put("/me/avatar", app.AuthHandler.UploadAvatarHandler)
+					r.Delete("/me/avatar", app.AuthHandler.DeleteAvatarHandler)
+					r.Post("/password/change", app.AuthHandler.ChangePasswordHandler)
+					r.Post("/email/change", app.AuthHandler.RequestEmailChangeHandler)
+
+					// TOTP enrolment & management
+					r.Get("/2fa", app.AuthHandler.TwoFactorStatusHandler)
+					r.Post("/2fa/setup", app.AuthHandler.TwoFactorSetupHandler)
+					r.Post("/2fa/confirm", app.AuthHandler.TwoFactorConfirmHandler)
+					r.Post("/2fa/disable", app.AuthHandler.TwoFactorDisableHandler)
+					r.Post("/2fa/recovery-codes", app.AuthHandler.TwoFactorRecoveryCodesHandler)
+
+					// Passkey management
+					r.Get("/passkeys", app.AuthHandler.ListPasskeysHandler)
+					r.Post("/passkeys/register/begin", app.AuthHandler.PasskeyRegisterBeginHandler)
+					r.Post("/passkeys/register/finish", app.AuthHandler.PasskeyRegisterFinishHandler)
+					r.Patch("/passkeys/{passkeyID}", app.AuthHandler.RenamePasskeyHandler)
+					r.Delete("/passkeys/{passkeyID}", app.AuthHandler.DeletePasskeyHandler)
+
+					// Linked single sign-on accounts
+					r.Get("/identities", app.AuthHandler.ListIdentitiesHandler)
+					r.Get("/{provider}/link", app.AuthHandler.OAuthLinkHandler)
+					r.Delete("/identities/{identityID}", app.AuthHandler.UnlinkIdentityHandler)
+
+					// Studios the user belongs to, and the default one
+					r.Get("/studios", app.AuthHandler.ListStudiosHandler)
+					r.Put("/me/studio", app.AuthHandler.SwitchStudioHandler)
+					r.Post("/invitations/join", app.AuthHandler.JoinStudioHandler)
+
+					// Personal API tokens for scripts and integrations
+					r.Get("/tokens", app.AuthHandler.ListAPITokensHandler)
+					r.Post("/tokens", app.AuthHandler.CreateAPITokenHandler)
+					r.Delete("/tokens/{tokenID}", app.AuthHandler.RevokeAPITokenHandler)
+
+					// Personal data access and erasure requests
+					r.Get("/me/exports", app.AuthHandler.ListDataExportsHandler)
+					r.Post("/me/exports", app.AuthHandler.RequestDataExportHandler)
+					r.Get("/me/exports/{exportID}", app.AuthHandler.DownloadDataExportHandler)
+					r.Post("/me/erase", app.AuthHandler.EraseAccountHandler)
+				})
 			})
 
 			// ----------- Protected API group --------------
 			r.Group(func(r chi.Router) {
-				// Session must be valid
-				r.Use(mw.RequireAuth(app.SessionManager))
+				// Session cookie or Bearer API token must be valid
+				r.Use(authz.RequireAuth())
+
+				// Optionally, the email address must be confirmed too
+				if app.Config.RequireEmailVerification {
+					r.Use(authz.RequireVerifiedEmail())
+				}
+
+				// Groups flagged require_2fa must have enrolled
+				r.Use(authz.RequireTwoFactor())
+
+				// Everything below acts on the active studio; repositories
+				// filter with tenant.Where
+				r.Use(tenant.Require())
+
+				r.With(authz.Can("studios.create")).Post(
+					"/studios", app.AuthHandler.CreateStudioHandler)
+
+				// ---------------- Admin -----------------------
+				r.Route("/admin/users", func(r chi.Router) {
+					r.Use(authz.Can("users.manage"))
+
+					r.Get("/", app.AuthHandler.AdminListUsersHandler)
+					r.Post("/", app.AuthHandler.AdminAddMemberHandler)
+
+					r.Route("/{userID}", func(r chi.Router) {
+						// Only members of the active studio can be managed
+						r.Use(app.AuthHandler.RequireStudioMember)
+
+						r.Get("/", app.AuthHandler.AdminGetUserHandler)
+						r.Patch("/", app.AuthHandler.AdminUpdateUserHandler)
+						r.Delete("/", app.AuthHandler.AdminDeleteUserHandler)
+						r.Delete("/membership", app.AuthHandler.AdminRemoveMemberHandler)
+						r.Put("/group", app.AuthHandler.AdminSetUserGroupHandler)
+						r.Post("/disable", app.AuthHandler.AdminDisableUserHandler)
+						r.Post("/enable", app.AuthHandler.AdminEnableUserHandler)
+						r.Post("/impersonate", app.AuthHandler.AdminImpersonateHandler)
+
+						r.Get("/sessions", app.AuthHandler.AdminListSessionsHandler)
+						r.Delete("/sessions", app.AuthHandler.AdminRevokeAllSessionsHandler)
+						r.Delete("/sessions/{sessionID}", app.AuthHandler.AdminRevokeSessionHandler)
+
+						r.Get("/exports", app.AuthHandler.AdminListDataExportsHandler)
+						r.Post("/exports", app.AuthHandler.AdminRequestDataExportHandler)
+						r.Get("/exports/{exportID}", app.AuthHandler.AdminDownloadDataExportHandler)
+						r.Post("/erase", app.AuthHandler.AdminEraseUserHandler)
+					})
+				})
+
+				r.With(authz.Can("users.manage")).Get(
+					"/admin/permissions", app.AuthHandler.AdminListPermissionsHandler)
+
+				r.Route("/admin/groups", func(r chi.Router) {
+					r.Use(authz.Can("users.manage"))
+
+					r.Get("/", app.AuthHandler.AdminListGroupsHandler)
+					r.Post("/", app.AuthHandler.AdminCreateGroupHandler)
+					r.Get("/{groupID}", app.AuthHandler.AdminGetGroupHandler)
+					r.Patch("/{groupID}", app.AuthHandler.AdminUpdateGroupHandler)
+					r.Delete("/{groupID}", app.AuthHandler.AdminDeleteGroupHandler)
+					r.Put("/{groupID}/permissions", app.AuthHandler.AdminSetGroupPermissionsHandler)
+					r.Put("/{groupID}/2fa", app.AuthHandler.AdminSetGroupTwoFactorHandler)
+				})
+
+				r.Route("/admin/invitations", func(r chi.Router) {
+					r.Use(authz.Can("users.invite"))
+
+					r.Get("/", app.AuthHandler.ListInvitationsHandler)
+					r.Post("/", app.AuthHandler.InviteUserHandler)
+					r.Delete("/{invitationID}", app.AuthHandler.RevokeInvitationHandler)
+				})
 
 				// Example of fine-grained authorisation:
 				//
-				// r.With(mw.Can("projects:read")).Get(
+				// r.With(authz.Can("projects:read")).Get(
 				//	   "/projects", app.ProjectHandler.List)
 				//
-				// r.With(mw.CanAny("contacts:read", "contacts:write")).Post(
+				// r.With(authz.CanAny("contacts:read", "contacts:write")).Post(
 				//     "/contacts", app.ContactHandler.Create)
+				//
+				// Row-level rules sit next to Can. With a policy registered as
+				//
+				//   app.Policies.Register("projects.edit", policy.Policy{
+				//       Table:            "crm.projects",
+				//       Permission:       "projects.edit",
+				//       ScopedPermission: "projects.edit.assigned",
+				//       Rule:             policy.Member("crm.project_assignees", "project_id", "user_id"),
+				//   })
+				//
+				// a route only lets through users who may edit that project:
+				//
+				// r.With(app.Policies.Require("projects.edit", "projectID")).Put(
+				//     "/projects/{projectID}", app.ProjectHandler.Update)
 			})
 		})
 	})
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// maxAPITokenDays caps how long an expiring token may live; 0 means the
+// token never expires.
+const maxAPITokenDays = 365
+
+// ListAPITokensHandler returns the signed-in user's personal access tokens.
+func (h *AuthHandler) ListAPITokensHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.Service.ListAPITokens(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to list API tokens")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "API tokens", map[string]any{"tokens": tokens})
+}
+
+// CreateAPITokenHandler issues a personal access token. The raw token is in
+// this response only; it cannot be retrieved again.
+func (h *AuthHandler) CreateAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expiresInDays"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("name", input.Name)
+	v.Check("name", len(strings.TrimSpace(input.Name)) <= 100, "Must be 100 characters or fewer")
+	v.Check("expiresInDays", input.ExpiresInDays >= 0 && input.ExpiresInDays <= maxAPITokenDays, "Must be 365 days or fewer")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresInDays > 0 {
+		t := time.Now().Add(time.Duration(input.ExpiresInDays) * 24 * time.Hour)
+		expiresAt = &t
+	}
+
+	token, raw, err := h.Service.CreateAPIToken(r.Context(), userID, input.Name, input.Scopes, expiresAt)
+	if stdErrors.Is(err, ErrScopeNotHeld) {
+		errResp := errors.BadRequest(err.Error())
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to create API token")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "API token created", map[string]any{
+		"token":    raw,
+		"apiToken": token,
+	})
+}
+
+// RevokeAPITokenHandler deletes one of the signed-in user's tokens; requests
+// using it fail from then on.
+func (h *AuthHandler) RevokeAPITokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 32)
+	if err != nil || tokenID <= 0 {
+		errResp := errors.BadRequest("Invalid token id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	found, err := h.Service.RevokeAPIToken(r.Context(), userID, int32(tokenID))
+	if err != nil {
+		errResp := errors.Internal("Failed to revoke API token")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("API token not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "API token revoked", nil)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// APITokenRepository persists personal access tokens in auth.api_tokens.
+type APITokenRepository interface {
+	CreateAPIToken(ctx context.Context, userID int32, name, prefix, tokenHash string, scopes []string, expiresAt *time.Time) (*APIToken, error)
+	ListAPITokens(ctx context.Context, userID int32) ([]APIToken, error)
+	GetAPIToken(ctx context.Context, tokenHash string) (*APIToken, error)
+	TouchAPIToken(ctx context.Context, tokenID int32, ip string) error
+	DeleteAPIToken(ctx context.Context, userID, tokenID int32) (bool, error)
+}
+
+// APIToken is the client-facing view of a personal access token. The raw
+// token is only ever returned once, by CreateAPIToken.
+type APIToken struct {
+	ID         int32      `json:"id"`
+	UserID     int32      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	LastUsedIP *string    `json:"lastUsedIp"`
+}
+
+const apiTokenColumns = `id, user_id, name, token_prefix, scopes, expires_at, created_at, last_used_at, last_used_ip`
+
+func scanAPIToken(row pgx.Row) (*APIToken, error) {
+	var t APIToken
+	err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &t.Scopes, &t.ExpiresAt, &t.CreatedAt, &t.LastUsedAt, &t.LastUsedIP)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PgxUserRepository) CreateAPIToken(ctx context.Context, userID int32, name, prefix, tokenHash string, scopes []string, expiresAt *time.Time) (*APIToken, error) {
+	query := `
+		INSERT INTO auth.api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at)
+		VALUES (@user_id, @name, @token_prefix, @token_hash, @scopes, @expires_at)
+		RETURNING ` + apiTokenColumns
+
+	args := pgx.NamedArgs{
+		"user_id":      userID,
+		"name":         name,
+		"token_prefix": prefix,
+		"token_hash":   tokenHash,
+		"scopes":       scopes,
+		"expires_at":   expiresAt,
+	}
+
+	return scanAPIToken(r.DB.QueryRow(ctx, query, args))
+}
+
+func (r *PgxUserRepository) ListAPITokens(ctx context.Context, userID int32) ([]APIToken, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+apiTokenColumns+`
+		FROM auth.api_tokens
+		WHERE user_id = @user_id
+		ORDER BY created_at DESC
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// GetAPIToken returns an unexpired token by hash. pgx.ErrNoRows means it is
+// unknown, revoked or expired.
+func (r *PgxUserRepository) GetAPIToken(ctx context.Context, tokenHash string) (*APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM auth.api_tokens
+		WHERE token_hash = @token_hash AND (expires_at IS NULL OR expires_at > now())
+	`
+
+	return scanAPIToken(r.DB.QueryRow(ctx, query, pgx.NamedArgs{"token_hash": tokenHash}))
+}
+
+func (r *PgxUserRepository) TouchAPIToken(ctx context.Context, tokenID int32, ip string) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.api_tokens SET last_used_at = now(), last_used_ip = @ip
+		WHERE id = @id
+	`, pgx.NamedArgs{"id": tokenID, "ip": ip})
+	return err
+}
+
+func (r *PgxUserRepository) DeleteAPIToken(ctx context.Context, userID, tokenID int32) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM auth.api_tokens
+		WHERE id = @id AND user_id = @user_id
+	`, pgx.NamedArgs{"id": tokenID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
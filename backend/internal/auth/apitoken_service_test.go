@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// tokenRepo holds one member of studio 1 holding perms, and tokens by hash.
+type tokenRepo struct {
+	UserRepository
+	user    User
+	perms   []string
+	tokens  map[string]*APIToken
+	touched int
+}
+
+func (r *tokenRepo) GetAPIToken(_ context.Context, tokenHash string) (*APIToken, error) {
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return token, nil
+}
+
+func (r *tokenRepo) TouchAPIToken(context.Context, int32, string) error {
+	r.touched++
+	return nil
+}
+
+func (r *tokenRepo) GetByID(context.Context, int32) (*User, error) {
+	u := r.user
+	return &u, nil
+}
+
+func (r *tokenRepo) GetMembership(context.Context, int32, string) (*Membership, error) {
+	return &Membership{Studio: tenant.Studio{ID: 1, Slug: "acme"}}, nil
+}
+
+func (r *tokenRepo) GetMemberPermissions(context.Context, int32, int32) ([]string, error) {
+	return r.perms, nil
+}
+
+func TestLoadTokenPrincipal(t *testing.T) {
+	past := time.Now().Add(-time.Second)
+	future := time.Now().Add(time.Hour)
+	recent := time.Now()
+
+	tests := []struct {
+		name      string
+		raw       string
+		token     *APIToken
+		disabled  bool
+		wantNil   bool
+		wantPerms []string
+		wantTouch int
+	}{
+		{
+			name:      "scopes intersect permissions",
+			raw:       "sfp_a",
+			token:     &APIToken{ID: 7, UserID: 1, Scopes: []string{"clients.read", "clients.write", "users.manage"}},
+			wantPerms: []string{"clients.read", "clients.write"},
+			wantTouch: 1,
+		},
+		{
+			name:      "no scopes",
+			raw:       "sfp_b",
+			token:     &APIToken{ID: 7, UserID: 1, Scopes: []string{}},
+			wantPerms: []string{},
+			wantTouch: 1,
+		},
+		{
+			name:      "unexpired",
+			raw:       "sfp_c",
+			token:     &APIToken{ID: 7, UserID: 1, Scopes: []string{"clients.read"}, ExpiresAt: &future, LastUsedAt: &recent},
+			wantPerms: []string{"clients.read"},
+		},
+		{
+			name:    "expired",
+			raw:     "sfp_d",
+			token:   &APIToken{ID: 7, UserID: 1, Scopes: []string{"clients.read"}, ExpiresAt: &past},
+			wantNil: true,
+		},
+		{
+			name:    "unknown token",
+			raw:     "sfp_e",
+			wantNil: true,
+		},
+		{
+			name:    "not a token",
+			raw:     "eyJhbGciOi",
+			token:   &APIToken{ID: 7, UserID: 1, Scopes: []string{"clients.read"}},
+			wantNil: true,
+		},
+		{
+			name:      "disabled user",
+			raw:       "sfp_f",
+			token:     &APIToken{ID: 7, UserID: 1, Scopes: []string{"clients.read"}},
+			disabled:  true,
+			wantNil:   true,
+			wantTouch: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &tokenRepo{
+				user:   User{ID: 1},
+				perms:  []string{"clients.read", "clients.write", "invoices.read"},
+				tokens: map[string]*APIToken{},
+			}
+			if tt.disabled {
+				repo.user.DisabledAt = &past
+			}
+			if tt.token != nil {
+				repo.tokens[hashToken(tt.raw)] = tt.token
+			}
+			s := &AuthServiceImpl{Repo: repo, Principals: NewPrincipalCache(time.Minute)}
+
+			p, err := s.LoadTokenPrincipal(context.Background(), tt.raw, "198.51.100.1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo.touched != tt.wantTouch {
+				t.Errorf("touched %d times, want %d", repo.touched, tt.wantTouch)
+			}
+			if tt.wantNil {
+				if p != nil {
+					t.Fatalf("principal = %+v, want none", p)
+				}
+				return
+			}
+			if p == nil {
+				t.Fatal("no principal")
+			}
+			if p.TokenID != 7 || !p.ViaToken() {
+				t.Errorf("TokenID = %d, want 7", p.TokenID)
+			}
+			if !slices.Equal(p.Permissions, tt.wantPerms) {
+				t.Errorf("permissions = %v, want %v", p.Permissions, tt.wantPerms)
+			}
+
+			// The cached session principal keeps the full set.
+			base, err := s.LoadPrincipal(context.Background(), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(base.Permissions, repo.perms) || base.ViaToken() {
+				t.Errorf("cached principal changed: %+v", base)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Audit actions recorded in auth.audit_log.
+const (
+	AuditImpersonationStart = "impersonation.start"
+	AuditImpersonationStop  = "impersonation.stop"
+)
+
+// AuditRepository appends to auth.audit_log.
+type AuditRepository interface {
+	RecordAudit(ctx context.Context, entry AuditEntry) error
+}
+
+// AuditEntry is one audit log record. ActorID is who acted and
+// TargetUserID whom it concerned; Metadata holds action-specific details.
+type AuditEntry struct {
+	ActorID      int32
+	Action       string
+	TargetUserID *int32
+	IPAddress    string
+	Metadata     map[string]any
+}
+
+func (r *PgxUserRepository) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	metadata := entry.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+
+	query := `
+		INSERT INTO auth.audit_log (actor_id, action, target_user_id, ip_address, metadata)
+		VALUES (@actor_id, @action, @target_user_id, @ip_address, @metadata)
+	`
+
+	args := pgx.NamedArgs{
+		"actor_id":       entry.ActorID,
+		"action":         entry.Action,
+		"target_user_id": entry.TargetUserID,
+		"ip_address":     entry.IPAddress,
+		"metadata":       metadata,
+	}
+
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
@@ -3,27 +3,113 @@ package auth
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	stdErrors "errors"
 	"io"
 	"log/slog"
+	"math"
 	"net/http"
-	"os"
-	"strings"
+	"strconv"
+	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
 	"github.com/iankencruz/sabiflow/internal/shared/response"
 	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
 	"github.com/iankencruz/sabiflow/internal/shared/validators"
 )
 
 // AuthService defines the business logic interface for authentication.
 type AuthService interface {
 	Register(ctx context.Context, firstName, lastName, email, password string) (*User, error)
-	Login(ctx context.Context, email, password string) (*User, error)
+	Login(ctx context.Context, email, password, ip string) (*User, error)
 	Logout(ctx context.Context) error
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
-	CreateUserOAuth(ctx context.Context, firstName, lastName, email string) (*User, error)
+	LoginWithIdentity(ctx context.Context, identity *ExternalIdentity) (*User, error)
 	GetUserByID(ctx context.Context, id int32) (*User, error)
+	RequestPasswordReset(ctx context.Context, email, ip string) error
+	ResetPassword(ctx context.Context, token, password string) (int32, error)
+	SendEmailVerification(ctx context.Context, user *User) error
+	VerifyEmail(ctx context.Context, token string) (int32, error)
+	MarkEmailVerified(ctx context.Context, user *User) error
+
+	TwoFactorSummary(ctx context.Context, userID int32) (*TwoFactorSummary, error)
+	BeginTOTPEnrolment(ctx context.Context, user *User) (secret, uri string, err error)
+	ConfirmTOTPEnrolment(ctx context.Context, userID int32, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userID int32, code, ip string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID int32, code, ip string) ([]string, error)
+	TwoFactorEnabled(ctx context.Context, userID int32) (bool, error)
+	StartSecondFactor(ctx context.Context, userID int32) (string, error)
+	CompleteSecondFactor(ctx context.Context, pendingToken, code, ip string) (*User, error)
+	SetGroupRequire2FA(ctx context.Context, groupID int32, required bool) (bool, error)
+
+	BeginPasskeyRegistration(ctx context.Context, userID int32) (*protocol.CredentialCreation, string, error)
+	FinishPasskeyRegistration(ctx context.Context, userID int32, state, name string, parsed *protocol.ParsedCredentialCreationData) (*Passkey, error)
+	BeginPasskeyLogin(ctx context.Context) (*protocol.CredentialAssertion, string, error)
+	FinishPasskeyLogin(ctx context.Context, state string, parsed *protocol.ParsedCredentialAssertionData) (*User, error)
+	ListPasskeys(ctx context.Context, userID int32) ([]Passkey, error)
+	RenamePasskey(ctx context.Context, userID, passkeyID int32, name string) (bool, error)
+	DeletePasskey(ctx context.Context, userID, passkeyID int32) (bool, error)
+
+	RegistrationOpen(ctx context.Context) (bool, error)
+	InviteUser(ctx context.Context, inviter *User, email string, groupID int32, ttl time.Duration) (*Invitation, error)
+	ListInvitations(ctx context.Context) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, invitationID int32) (bool, error)
+	LookupInvitation(ctx context.Context, token string) (*Invitation, error)
+	AcceptInvitation(ctx context.Context, token, firstName, lastName, password string) (*User, error)
+
+	ListUsers(ctx context.Context, filter UserFilter) (*UserPage, error)
+	UpdateUserProfile(ctx context.Context, userID int32, firstName, lastName, email string) (*User, error)
+	AssignUserGroup(ctx context.Context, userID int32, groupID *int32) (*User, error)
+	SetUserDisabled(ctx context.Context, userID int32, disabled bool) (*User, error)
+	DeleteUser(ctx context.Context, userID int32) error
+
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error)
+	GetPermissionGroup(ctx context.Context, groupID int32) (*PermissionGroup, error)
+	CreatePermissionGroup(ctx context.Context, name, description string, codes []string) (*PermissionGroup, error)
+	UpdatePermissionGroup(ctx context.Context, groupID int32, name, description string) (*PermissionGroup, error)
+	SetGroupPermissions(ctx context.Context, groupID int32, codes []string) (*PermissionGroup, error)
+	DeletePermissionGroup(ctx context.Context, groupID int32) error
+
+	LinkIdentity(ctx context.Context, userID int32, identity *ExternalIdentity) (*Identity, error)
+	ListIdentities(ctx context.Context, userID int32) ([]Identity, error)
+	UnlinkIdentity(ctx context.Context, userID, identityID int32) (bool, error)
+
+	CreateAPIToken(ctx context.Context, userID int32, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error)
+	ListAPITokens(ctx context.Context, userID int32) ([]APIToken, error)
+	RevokeAPIToken(ctx context.Context, userID, tokenID int32) (bool, error)
+
+	UpdateProfile(ctx context.Context, userID int32, firstName, lastName, timezone, locale string) (*User, error)
+	ChangePassword(ctx context.Context, userID int32, reauth Reauth, next string) error
+	RequestEmailChange(ctx context.Context, userID int32, reauth Reauth, newEmail string) error
+	ConfirmEmailChange(ctx context.Context, token string) (int32, error)
+	SetAvatar(ctx context.Context, userID int32, contentType string, image io.Reader) (*User, error)
+	RemoveAvatar(ctx context.Context, userID int32) (*User, error)
+
+	MagicLinkEnabled() bool
+	RequestMagicLink(ctx context.Context, email, ip string) error
+	ConsumeMagicLink(ctx context.Context, token string) (*User, error)
+
+	StartImpersonation(ctx context.Context, adminID, targetID int32, ip string) (*User, error)
+	StopImpersonation(ctx context.Context, adminID, targetID int32, ip string) (*User, error)
+
+	CreateStudio(ctx context.Context, ownerID int32, slug, name string) (*tenant.Studio, error)
+	ListStudios(ctx context.Context, userID int32) ([]Membership, error)
+	SwitchStudio(ctx context.Context, userID, studioID int32) (*Membership, error)
+	IsStudioMember(ctx context.Context, userID int32) (bool, error)
+	AddStudioMember(ctx context.Context, inviter *User, email string, groupID int32, ttl time.Duration) (*Invitation, error)
+	JoinStudio(ctx context.Context, userID int32, token string) (*Membership, error)
+	RemoveStudioMember(ctx context.Context, userID int32) error
+
+	RequestDataExport(ctx context.Context, userID, requestedBy int32) (*DataExport, error)
+	ListDataExports(ctx context.Context, userID int32) ([]DataExport, error)
+	DataExportArchive(ctx context.Context, userID, exportID int32) ([]byte, error)
+	UserDataExports(ctx context.Context, userID int32) ([]DataExport, error)
+	UserDataExportArchive(ctx context.Context, userID, exportID int32) ([]byte, error)
+	EraseAccount(ctx context.Context, userID int32, reauth Reauth) error
+	EraseUser(ctx context.Context, userID int32) error
 }
 
 // AuthHandler handles HTTP requests for authentication-related operations.
@@ -31,6 +117,14 @@ type AuthHandler struct {
 	Service        AuthService
 	SessionManager *sessions.Manager
 	Logger         *slog.Logger
+
+	// FrontendURL is the SPA origin used for browser redirects.
+	FrontendURL string
+	// OAuthSuccessURL is where OAuth and magic-link logins land without a
+	// return_to.
+	OAuthSuccessURL string
+	// Providers holds the configured OpenID Connect providers.
+	Providers *ProviderRegistry
 }
 
 // RegisterHandler handles user registration.
@@ -53,9 +147,7 @@ func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	v.Require("lastName", input.Lastname)
 	v.Require("email", input.Email)
 	v.MatchPattern("email", input.Email, validators.EmailRX, "Must be a valid email address")
-	v.Require("password", input.Password)
-	v.MatchPattern("password", input.Password, validators.UppercaseRX, "Must include at least one uppercase letter")
-	v.MatchPattern("password", input.Password, validators.NumberRX, "Must include at least one number")
+	validatePassword(v, "password", input.Password)
 
 	if !v.Valid() {
 		errResp := errors.BadRequest("Validation failed")
@@ -64,13 +156,30 @@ func (h *AuthHandler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	user, err := h.Service.Register(r.Context(), input.Firstname, input.Lastname, input.Email, input.Password)
+	if writeWeakPassword(w, "password", err) {
+		return
+	}
+	if stdErrors.Is(err, ErrRegistrationClosed) {
+		errResp := errors.Forbidden("Registration is by invitation only").WithReason(ReasonRegistrationClosed)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if stdErrors.Is(err, ErrEmailInUse) {
+		errResp := errors.Conflict("Email already in use")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
 	if err != nil {
-		errResp := errors.Internal(err.Error())
+		errResp := errors.Internal("Failed to register user")
 		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
 		return
 	}
 
-	if err := h.SessionManager.SetUserID(w, r, user.ID); err != nil {
+	if err := h.Service.SendEmailVerification(r.Context(), user); err != nil && h.Logger != nil {
+		h.Logger.Error("Failed to send verification email", "err", err, "user_id", user.ID)
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, user.ID, false); err != nil {
 		errResp := errors.Internal("Failed to set session")
 		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
 		return
@@ -84,6 +193,8 @@ func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// RememberMe keeps the user signed in after the browser closes.
+		RememberMe bool `json:"rememberMe"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -104,14 +215,41 @@ func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Use the service to Check the credentials
-	user, err := h.Service.Login(r.Context(), input.Email, input.Password)
+	user, err := h.Service.Login(r.Context(), input.Email, input.Password, sessions.ClientIP(r))
+	var throttled *LoginThrottledError
+	switch {
+	case stdErrors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+		return
+	case stdErrors.Is(err, ErrInvalidCredentials):
+		errResp := errors.Unauthorized("Invalid email or password")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.Is(err, ErrAccountDisabled):
+		writeAccountDisabled(w)
+		return
+	case err != nil:
+		errResp := errors.Internal("Failed to sign in")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	// Password was right; users with 2FA must still present a code.
+	pending, err := h.startSecondFactorIfEnabled(r, user.ID)
 	if err != nil {
-		errResp := errors.Internal(err.Error())
+		errResp := errors.Internal("Failed to start second factor")
 		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
 		return
 	}
+	if pending != "" {
+		response.WriteJSON(w, http.StatusOK, "Second factor required", map[string]any{
+			"secondFactorRequired": true,
+			"pendingToken":         pending,
+		})
+		return
+	}
 
-	if err := h.SessionManager.SetUserID(w, r, user.ID); err != nil {
+	if err := h.SessionManager.SetUserID(w, r, user.ID, input.RememberMe); err != nil {
 		errResp := errors.Internal("Failed to set session")
 		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
 		return
@@ -120,10 +258,20 @@ func (h *AuthHandler) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	response.WriteJSON(w, http.StatusOK, "Logged in", map[string]any{"user": user})
 }
 
+// ReasonTooManyAttempts tells the SPA that sign-in is temporarily locked;
+// the Retry-After header says for how long.
+const ReasonTooManyAttempts = "too_many_attempts"
+
+func writeLoginThrottled(w http.ResponseWriter, throttled *LoginThrottledError) {
+	seconds := int(math.Ceil(throttled.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+
+	errResp := errors.TooManyRequests("Too many failed sign-in attempts, try again later").WithReason(ReasonTooManyAttempts)
+	response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+}
+
 // LogoutHandler clears the user session.
 func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Println("LogoutHandler called")
-
 	if h.Logger != nil {
 		h.Logger.Info("LogoutHandler called")
 	}
@@ -137,90 +285,64 @@ func (h *AuthHandler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	response.WriteJSON(w, http.StatusOK, "Logged out successfully", nil)
 }
 
-func (h *AuthHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
-	url := GetGoogleAuthURL("state-token") // Replace with dynamic state in future
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
-}
+// GetAuthenticatedUser returns the authenticated user or null if unauthenticated.
+// While an administrator impersonates the user, "impersonator" names them so
+// the SPA can show a banner.
 
-func (h *AuthHandler) GoogleCallback(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		response.WriteJSON(w, http.StatusBadRequest, "Missing code", nil)
-		return
-	}
+func (h *AuthHandler) GetAuthenticatedUser(w http.ResponseWriter, r *http.Request) {
+	userID, impersonatorID, err := h.SessionManager.Identify(r)
+	w.Header().Set("Content-Type", "application/json")
 
-	token, err := ExchangeCode(ctx, code)
-	if err != nil {
-		h.Logger.Error("OAuth token exchange failed", "err", err)
-		response.WriteJSON(w, http.StatusInternalServerError, "OAuth exchange failed", nil)
+	if err != nil || userID == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"user": nil})
 		return
 	}
 
-	resp, err := http.Get("https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + token.AccessToken)
+	user, err := h.Service.GetUserByID(r.Context(), userID)
 	if err != nil {
-		h.Logger.Error("Failed to get user info", "err", err)
-		response.WriteJSON(w, http.StatusInternalServerError, "Google user info failed", nil)
-		return
-	}
-	defer resp.Body.Close()
-
-	var googleUser struct {
-		Email   string `json:"email"`
-		Name    string `json:"name"`
-		Picture string `json:"picture"`
-	}
-	body, _ := io.ReadAll(resp.Body)
-	if err := json.Unmarshal(body, &googleUser); err != nil {
-		h.Logger.Error("User info unmarshal failed", "err", err)
-		response.WriteJSON(w, http.StatusInternalServerError, "Invalid user info", nil)
+		json.NewEncoder(w).Encode(map[string]interface{}{"user": nil})
 		return
 	}
 
-	user, err := h.Service.GetUserByEmail(ctx, googleUser.Email)
+	// Every studio the user can switch to with PUT /auth/me/studio; the
+	// active one is user.studio.
+	studios, err := h.Service.ListStudios(r.Context(), userID)
 	if err != nil {
+		studios = []Membership{}
+	}
 
-		parts := strings.Fields(googleUser.Name)
-		firstName := parts[0]
-		lastName := ""
-		if len(parts) > 1 {
-			lastName = strings.Join(parts[1:], " ")
-		}
-
-		user, err = h.Service.CreateUserOAuth(ctx, firstName, lastName, googleUser.Email)
-
-		if err != nil {
-			h.Logger.Error("Failed to create OAuth user", "err", err)
-			response.WriteJSON(w, http.StatusInternalServerError, "User creation failed", nil)
+	if impersonatorID != 0 {
+		if admin, err := h.Service.GetUserByID(r.Context(), impersonatorID); err == nil {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"user":          user,
+				"studios":       studios,
+				"impersonating": true,
+				"impersonator": map[string]any{
+					"id":        admin.ID,
+					"firstName": admin.FirstName,
+					"lastName":  admin.LastName,
+					"email":     admin.Email,
+				},
+			})
 			return
 		}
 	}
 
-	if err := h.SessionManager.SetUserID(w, r, user.ID); err != nil {
-		h.Logger.Error("Failed to store session", "err", err)
-		response.WriteJSON(w, http.StatusInternalServerError, "Session error", nil)
-		return
-	}
-
-	http.Redirect(w, r, os.Getenv("FRONTEND_SUCCESS_REDIRECT_URL"), http.StatusSeeOther)
+	json.NewEncoder(w).Encode(map[string]interface{}{"user": user, "studios": studios, "impersonating": false})
 }
 
-// GetAuthenticatedUser returns the authenticated user or null if unauthenticated.
+// sessionUserID returns the signed-in user's ID, writing a 401 otherwise.
+// Behind RequireAuth it reads the principal instead of the session again.
+func (h *AuthHandler) sessionUserID(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	if p, ok := middleware.PrincipalFrom(r.Context()); ok {
+		return p.UserID, true
+	}
 
-func (h *AuthHandler) GetAuthenticatedUser(w http.ResponseWriter, r *http.Request) {
 	userID, err := h.SessionManager.GetUserID(r)
-	w.Header().Set("Content-Type", "application/json")
-
 	if err != nil || userID == 0 {
-		json.NewEncoder(w).Encode(map[string]interface{}{"user": nil})
-		return
+		errResp := errors.Unauthorized("unauthorised")
+		response.WriteJSON(w, errResp.Code, errResp.Message, nil)
+		return 0, false
 	}
-
-	user, err := h.Service.GetUserByID(r.Context(), userID)
-	if err != nil {
-		json.NewEncoder(w).Encode(map[string]interface{}{"user": nil})
-		return
-	}
-
-	json.NewEncoder(w).Encode(map[string]interface{}{"user": user})
+	return userID, true
 }
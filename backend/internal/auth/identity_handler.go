@@ -0,0 +1,113 @@
+package auth
+
+import (
+	stdErrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+)
+
+// ReasonLastLoginMethod tells the SPA that a removal was refused because the
+// user would be left with no way to sign in.
+const ReasonLastLoginMethod = "last_login_method"
+
+// ListIdentitiesHandler returns the external providers linked to the
+// signed-in user.
+func (h *AuthHandler) ListIdentitiesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	identities, err := h.Service.ListIdentities(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to list linked accounts")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Linked accounts", map[string]any{"identities": identities})
+}
+
+// OAuthLinkHandler starts the OIDC flow for {provider} on behalf of the
+// signed-in user; the callback links the identity to their account.
+func (h *AuthHandler) OAuthLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	h.startOAuth(w, r, userID)
+}
+
+// UnlinkIdentityHandler removes a linked identity, refusing when it is the
+// user's last way to sign in.
+func (h *AuthHandler) UnlinkIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	identityID, err := strconv.ParseInt(chi.URLParam(r, "identityID"), 10, 32)
+	if err != nil || identityID <= 0 {
+		errResp := errors.BadRequest("Invalid identity id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	found, err := h.Service.UnlinkIdentity(r.Context(), userID, int32(identityID))
+	if stdErrors.Is(err, ErrLastLoginMethod) {
+		errResp := errors.Conflict("Set a password or add a passkey before unlinking this account").WithReason(ReasonLastLoginMethod)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to unlink account")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("Linked account not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Account unlinked", nil)
+}
+
+// finishOAuthLink completes a link started by OAuthLinkHandler. The browser
+// must still be signed in as the user who started it.
+func (h *AuthHandler) finishOAuthLink(w http.ResponseWriter, r *http.Request, attempt *oauthAttempt, identity *ExternalIdentity) {
+	userID, err := h.SessionManager.GetUserID(r)
+	if err != nil || userID == 0 || userID != attempt.LinkUserID {
+		h.oauthFailed(w, r, "oauth_state", ErrOAuthStateMismatch)
+		return
+	}
+
+	if _, err := h.Service.LinkIdentity(r.Context(), userID, identity); err != nil {
+		h.oauthFailed(w, r, identityFailureReason(err), err)
+		return
+	}
+
+	http.Redirect(w, r, h.oauthReturnURL(attempt), http.StatusSeeOther)
+}
+
+// identityFailureReason maps identity errors to the ?error= codes the SPA
+// renders on its login page.
+func identityFailureReason(err error) string {
+	switch {
+	case stdErrors.Is(err, ErrIdentityEmailUnverified):
+		return "oauth_account_exists"
+	case stdErrors.Is(err, ErrIdentityInUse):
+		return "oauth_identity_in_use"
+	case stdErrors.Is(err, ErrRegistrationClosed):
+		return "registration_closed"
+	case stdErrors.Is(err, ErrAccountDisabled):
+		return "account_disabled"
+	default:
+		return "oauth_failed"
+	}
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IdentityRepository persists external provider accounts in auth.identities.
+type IdentityRepository interface {
+	GetByIdentity(ctx context.Context, provider, subject string) (*User, error)
+	LinkIdentity(ctx context.Context, userID int32, identity *ExternalIdentity) (*Identity, error)
+	TouchIdentity(ctx context.Context, provider, subject, email string) error
+	ListIdentities(ctx context.Context, userID int32) ([]Identity, error)
+	DeleteIdentity(ctx context.Context, userID, identityID int32) (bool, error)
+	CountLoginMethods(ctx context.Context, userID int32) (*LoginMethods, error)
+}
+
+// Identity is an external provider account linked to a local user.
+type Identity struct {
+	ID          int32      `json:"id"`
+	Provider    string     `json:"provider"`
+	Email       string     `json:"email"`
+	LinkedAt    time.Time  `json:"linkedAt"`
+	LastLoginAt *time.Time `json:"lastLoginAt"`
+}
+
+// LoginMethods counts the ways a user can still sign in.
+type LoginMethods struct {
+	Password   bool
+	Identities int
+	Passkeys   int
+}
+
+// Total is the number of independent login methods.
+func (m *LoginMethods) Total() int {
+	total := m.Identities + m.Passkeys
+	if m.Password {
+		total++
+	}
+	return total
+}
+
+func (r *PgxUserRepository) GetByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM auth.identities i
+		JOIN ` + userFrom + ` ON u.id = i.user_id
+		WHERE i.provider = @provider AND i.subject = @subject
+	`
+
+	args := pgx.NamedArgs{
+		"provider": provider,
+		"subject":  subject,
+	}
+
+	return scanUser(r.DB.QueryRow(ctx, query, args))
+}
+
+// LinkIdentity attaches identity to userID. When the identity is already
+// linked to someone else pgx.ErrNoRows is returned; linking it again to the
+// same user is a no-op.
+func (r *PgxUserRepository) LinkIdentity(ctx context.Context, userID int32, identity *ExternalIdentity) (*Identity, error) {
+	query := `
+		INSERT INTO auth.identities (user_id, provider, subject, email)
+		VALUES (@user_id, @provider, @subject, @email)
+		ON CONFLICT (provider, subject) DO UPDATE SET email = EXCLUDED.email
+		WHERE auth.identities.user_id = EXCLUDED.user_id
+		RETURNING id, provider, email, linked_at, last_login_at
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":  userID,
+		"provider": identity.Provider,
+		"subject":  identity.Subject,
+		"email":    identity.Email,
+	}
+
+	var i Identity
+	err := r.DB.QueryRow(ctx, query, args).Scan(&i.ID, &i.Provider, &i.Email, &i.LinkedAt, &i.LastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// TouchIdentity records a login and the email the provider currently reports.
+func (r *PgxUserRepository) TouchIdentity(ctx context.Context, provider, subject, email string) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.identities SET last_login_at = now(), email = @email
+		WHERE provider = @provider AND subject = @subject
+	`, pgx.NamedArgs{"provider": provider, "subject": subject, "email": email})
+	return err
+}
+
+func (r *PgxUserRepository) ListIdentities(ctx context.Context, userID int32) ([]Identity, error) {
+	query := `
+		SELECT id, provider, email, linked_at, last_login_at
+		FROM auth.identities
+		WHERE user_id = @user_id
+		ORDER BY linked_at
+	`
+
+	rows, err := r.DB.Query(ctx, query, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.ID, &i.Provider, &i.Email, &i.LinkedAt, &i.LastLoginAt); err != nil {
+			return nil, err
+		}
+		list = append(list, i)
+	}
+	return list, rows.Err()
+}
+
+func (r *PgxUserRepository) DeleteIdentity(ctx context.Context, userID, identityID int32) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM auth.identities
+		WHERE id = @id AND user_id = @user_id
+	`, pgx.NamedArgs{"id": identityID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgxUserRepository) CountLoginMethods(ctx context.Context, userID int32) (*LoginMethods, error) {
+	query := `
+		SELECT
+			u.password <> '',
+			(SELECT count(*) FROM auth.identities WHERE user_id = u.id),
+			(SELECT count(*) FROM auth.webauthn_credentials WHERE user_id = u.id)
+		FROM auth.users u
+		WHERE u.id = @id
+	`
+
+	var m LoginMethods
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"id": userID}).Scan(&m.Password, &m.Identities, &m.Passkeys)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
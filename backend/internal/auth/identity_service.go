@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrIdentityInUse = errors.New("identity is already linked to another account")
+	// ErrIdentityEmailUnverified means an account with the provider's email
+	// exists but ownership is not proven on both sides, so the user must sign
+	// in and link the provider explicitly.
+	ErrIdentityEmailUnverified = errors.New("an account with this email already exists")
+	ErrLastLoginMethod         = errors.New("cannot remove the last way to sign in")
+)
+
+// LoginWithIdentity resolves the local user for an identity asserted by an
+// OIDC provider. A known (provider, subject) pair signs straight in. An
+// unknown one is linked to the account with the same email only when both
+// the provider and the account have verified that address; otherwise a new
+// account is created, or ErrIdentityEmailUnverified is returned.
+func (s *AuthServiceImpl) LoginWithIdentity(ctx context.Context, identity *ExternalIdentity) (*User, error) {
+	user, err := s.Repo.GetByIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		if user.Disabled() {
+			return nil, ErrAccountDisabled
+		}
+		if err := s.Repo.TouchIdentity(ctx, identity.Provider, identity.Subject, identity.Email); err != nil {
+			return nil, err
+		}
+		if identity.EmailVerified && strings.EqualFold(identity.Email, user.Email) {
+			if err := s.MarkEmailVerified(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	user, err = s.Repo.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// Linking on an unverified address on either side would let whoever
+		// registered it first take over the other account.
+		if !identity.EmailVerified || !user.EmailVerified() {
+			return nil, ErrIdentityEmailUnverified
+		}
+		if user.Disabled() {
+			return nil, ErrAccountDisabled
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+		open, err := s.RegistrationOpen(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !open {
+			return nil, ErrRegistrationClosed
+		}
+		user, err = s.Repo.CreateUserOAuth(ctx, identity.FirstName, identity.LastName, identity.Email)
+		if err != nil {
+			return nil, fmt.Errorf("create oauth user: %w", err)
+		}
+		if identity.EmailVerified {
+			if err := s.MarkEmailVerified(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, err
+	}
+
+	if _, err := s.LinkIdentity(ctx, user.ID, identity); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkIdentity attaches identity to a signed-in user.
+func (s *AuthServiceImpl) LinkIdentity(ctx context.Context, userID int32, identity *ExternalIdentity) (*Identity, error) {
+	linked, err := s.Repo.LinkIdentity(ctx, userID, identity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrIdentityInUse
+	}
+	if err != nil {
+		return nil, fmt.Errorf("link identity: %w", err)
+	}
+	return linked, nil
+}
+
+func (s *AuthServiceImpl) ListIdentities(ctx context.Context, userID int32) ([]Identity, error) {
+	return s.Repo.ListIdentities(ctx, userID)
+}
+
+// UnlinkIdentity removes a linked identity unless it is the user's only way
+// to sign in.
+func (s *AuthServiceImpl) UnlinkIdentity(ctx context.Context, userID, identityID int32) (bool, error) {
+	identities, err := s.Repo.ListIdentities(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	found := false
+	for _, i := range identities {
+		if i.ID == identityID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	if err := s.ensureAnotherLoginMethod(ctx, userID); err != nil {
+		return false, err
+	}
+	return s.Repo.DeleteIdentity(ctx, userID, identityID)
+}
+
+// ensureAnotherLoginMethod returns ErrLastLoginMethod when removing one
+// password, identity or passkey would lock the user out.
+func (s *AuthServiceImpl) ensureAnotherLoginMethod(ctx context.Context, userID int32) error {
+	methods, err := s.Repo.CountLoginMethods(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if methods.Total() <= 1 {
+		return ErrLastLoginMethod
+	}
+	return nil
+}
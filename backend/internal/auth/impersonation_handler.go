@@ -0,0 +1,92 @@
+package auth
+
+import (
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+)
+
+// AdminImpersonateHandler swaps the admin's session for one acting as
+// {userID}, so they see exactly what that user sees. Stop with
+// StopImpersonationHandler.
+func (h *AuthHandler) AdminImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := middleware.PrincipalFrom(r.Context())
+	if !ok {
+		errResp := errors.Unauthorized("unauthorised")
+		response.WriteJSON(w, errResp.Code, errResp.Message, nil)
+		return
+	}
+	if p.ViaToken() {
+		errResp := errors.Forbidden("Impersonation needs a browser session")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if p.Impersonating() {
+		errResp := errors.Conflict("Stop the current impersonation first").WithReason(middleware.ReasonImpersonating)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	target, err := h.Service.StartImpersonation(r.Context(), p.UserID, userID, sessions.ClientIP(r))
+	switch {
+	case stdErrors.Is(err, ErrImpersonateSelf), stdErrors.Is(err, ErrImpersonateAdmin):
+		errResp := errors.Forbidden(err.Error())
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.Is(err, ErrAccountDisabled):
+		errResp := errors.Conflict("This account has been disabled").WithReason(ReasonAccountDisabled)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	if err := h.SessionManager.StartImpersonation(w, r, target.ID, p.UserID); err != nil {
+		errResp := errors.Internal("Failed to start impersonation")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Impersonating user", map[string]any{"user": target})
+}
+
+// StopImpersonationHandler ends an impersonation session and signs the
+// administrator back in as themselves.
+func (h *AuthHandler) StopImpersonationHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := middleware.PrincipalFrom(r.Context())
+	if !ok || !p.Impersonating() {
+		errResp := errors.BadRequest("Not impersonating anyone")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	admin, err := h.Service.StopImpersonation(r.Context(), p.ImpersonatorID, p.UserID, sessions.ClientIP(r))
+	if stdErrors.Is(err, ErrAccountDisabled) || stdErrors.Is(err, ErrUserNotFound) {
+		_ = h.SessionManager.Clear(w, r)
+		writeAccountDisabled(w)
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to stop impersonation")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, admin.ID, false); err != nil {
+		errResp := errors.Internal("Failed to set session")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Impersonation stopped", map[string]any{"user": admin})
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+var (
+	ErrImpersonateSelf  = errors.New("you cannot impersonate yourself")
+	ErrImpersonateAdmin = errors.New("users who can manage users cannot be impersonated")
+)
+
+// StartImpersonation checks that adminID may act as targetID and records
+// the start in the audit log. The caller opens the session.
+//
+// Users holding users.manage cannot be impersonated, nor can members of
+// other studios, so impersonation never reaches further than the admin
+// could already manage.
+func (s *AuthServiceImpl) StartImpersonation(ctx context.Context, adminID, targetID int32, ip string) (*User, error) {
+	if adminID == targetID {
+		return nil, ErrImpersonateSelf
+	}
+	if err := s.ensureSoleStudio(ctx, targetID); err != nil {
+		return nil, err
+	}
+
+	target, err := s.GetUserByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if target.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	if slices.Contains(target.Permissions, "users.manage") {
+		return nil, ErrImpersonateAdmin
+	}
+
+	err = s.Repo.RecordAudit(ctx, AuditEntry{
+		ActorID:      adminID,
+		Action:       AuditImpersonationStart,
+		TargetUserID: &targetID,
+		IPAddress:    ip,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// StopImpersonation records the end of an impersonation session and
+// returns the administrator to sign back in, or ErrAccountDisabled if they
+// may no longer sign in.
+func (s *AuthServiceImpl) StopImpersonation(ctx context.Context, adminID, targetID int32, ip string) (*User, error) {
+	err := s.Repo.RecordAudit(ctx, AuditEntry{
+		ActorID:      adminID,
+		Action:       AuditImpersonationStop,
+		TargetUserID: &targetID,
+		IPAddress:    ip,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := s.GetUserByID(ctx, adminID)
+	if err != nil {
+		return nil, err
+	}
+	if admin.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	return admin, nil
+}
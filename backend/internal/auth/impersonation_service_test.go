@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// impersonationRepo is adminRepo with audit entries recorded and some
+// members shared with other studios.
+type impersonationRepo struct {
+	*adminRepo
+	shared map[int32]bool
+	audit  []AuditEntry
+}
+
+func (r *impersonationRepo) CountMemberships(_ context.Context, userID int32) (int64, error) {
+	if r.shared[userID] {
+		return 2, nil
+	}
+	return 1, nil
+}
+
+func (r *impersonationRepo) RecordAudit(_ context.Context, entry AuditEntry) error {
+	r.audit = append(r.audit, entry)
+	return nil
+}
+
+func TestStartImpersonation(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  int32
+		shared  bool
+		wantErr error
+	}{
+		{name: "member", target: 30},
+		{name: "self", target: 20, wantErr: ErrImpersonateSelf},
+		{name: "holds users.manage", target: 10, wantErr: ErrImpersonateAdmin},
+		{name: "shared account", target: 30, shared: true, wantErr: ErrSharedAccount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &impersonationRepo{adminRepo: newAdminRepo(), shared: map[int32]bool{tt.target: tt.shared}}
+			s := &AuthServiceImpl{Repo: repo}
+
+			target, err := s.StartImpersonation(context.Background(), 20, tt.target, "198.51.100.1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if len(repo.audit) != 0 {
+					t.Fatalf("refused impersonation audited: %+v", repo.audit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target.ID != tt.target {
+				t.Fatalf("target = %d, want %d", target.ID, tt.target)
+			}
+			if len(repo.audit) != 1 || repo.audit[0].Action != AuditImpersonationStart || repo.audit[0].ActorID != 20 {
+				t.Fatalf("audit = %+v, want one impersonation start by 20", repo.audit)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// ReasonRegistrationClosed tells the SPA to hide the sign-up form.
+const ReasonRegistrationClosed = "registration_closed"
+
+// maxInvitationDays caps how long an admin may keep an invitation open.
+const maxInvitationDays = 30
+
+// RegistrationStatusHandler tells the SPA whether to offer self sign-up.
+func (h *AuthHandler) RegistrationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	open, err := h.Service.RegistrationOpen(r.Context())
+	if err != nil {
+		errResp := errors.Internal("Failed to load registration status")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Registration status", map[string]any{"open": open})
+}
+
+// InviteUserHandler emails an invitation to join with a permission group.
+func (h *AuthHandler) InviteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email         string `json:"email"`
+		GroupID       int32  `json:"groupId"`
+		ExpiresInDays int    `json:"expiresInDays"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("email", input.Email)
+	v.MatchPattern("email", input.Email, validators.EmailRX, "Must be a valid email address")
+	v.Check("groupId", input.GroupID > 0, "Must be a permission group")
+	v.Check("expiresInDays", input.ExpiresInDays >= 0 && input.ExpiresInDays <= maxInvitationDays, "Must be 30 days or fewer")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	inviter, err := h.Service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to load user")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	ttl := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	inv, err := h.Service.InviteUser(r.Context(), inviter, input.Email, input.GroupID, ttl)
+	switch {
+	case stdErrors.Is(err, ErrEmailInUse):
+		errResp := errors.Conflict("A user with this email already exists; add them to the studio instead")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.Is(err, ErrGroupNotFound):
+		errResp := errors.BadRequest("Permission group not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.Is(err, ErrGroupNotGrantable):
+		errResp := errors.Forbidden("You cannot invite into a group with permissions you do not hold")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		if h.Logger != nil {
+			h.Logger.Error("Failed to send invitation", "err", err, "email", input.Email)
+		}
+		errResp := errors.Internal("Failed to send invitation")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "Invitation sent", map[string]any{"invitation": inv})
+}
+
+// ListInvitationsHandler returns invitations that can still be accepted.
+func (h *AuthHandler) ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.Service.ListInvitations(r.Context())
+	if err != nil {
+		errResp := errors.Internal("Failed to list invitations")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Invitations", map[string]any{"invitations": invitations})
+}
+
+// RevokeInvitationHandler cancels a pending invitation.
+func (h *AuthHandler) RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "invitationID"), 10, 32)
+	if err != nil || id <= 0 {
+		errResp := errors.BadRequest("Invalid invitation id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	found, err := h.Service.RevokeInvitation(r.Context(), int32(id))
+	if err != nil {
+		errResp := errors.Internal("Failed to revoke invitation")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("Invitation not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Invitation revoked", nil)
+}
+
+// InvitationLookupHandler shows the accept page who an invitation is for.
+func (h *AuthHandler) InvitationLookupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	inv, err := h.Service.LookupInvitation(r.Context(), input.Token)
+	if err != nil {
+		h.writeInvitationError(w, err)
+		return
+	}
+
+	// Existing accounts accept by signing in and calling /invitations/join.
+	existing, _ := h.Service.GetUserByEmail(r.Context(), inv.Email)
+
+	response.WriteJSON(w, http.StatusOK, "Invitation", map[string]any{
+		"email":           inv.Email,
+		"studioName":      inv.StudioName,
+		"groupName":       inv.GroupName,
+		"expiresAt":       inv.ExpiresAt,
+		"existingAccount": existing != nil,
+	})
+}
+
+// AcceptInvitationHandler creates the invited account and signs it in.
+func (h *AuthHandler) AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token     string `json:"token"`
+		Firstname string `json:"firstName"`
+		Lastname  string `json:"lastName"`
+		Password  string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("token", input.Token)
+	v.Require("firstName", input.Firstname)
+	v.Require("lastName", input.Lastname)
+	validatePassword(v, "password", input.Password)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	user, err := h.Service.AcceptInvitation(r.Context(), input.Token, input.Firstname, input.Lastname, input.Password)
+	if writeWeakPassword(w, "password", err) {
+		return
+	}
+	if err != nil {
+		h.writeInvitationError(w, err)
+		return
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, user.ID, false); err != nil {
+		errResp := errors.Internal("Failed to set session")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "Invitation accepted", map[string]any{"user": user})
+}
+
+// JoinStudioHandler accepts an invitation addressed to the signed-in
+// account, adding it to the invitation's studio.
+func (h *AuthHandler) JoinStudioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	membership, err := h.Service.JoinStudio(r.Context(), userID, input.Token)
+	switch {
+	case stdErrors.Is(err, ErrInvitationMismatch):
+		errResp := errors.Forbidden("This invitation was sent to a different account")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.Is(err, ErrAlreadyMember):
+		errResp := errors.Conflict("You are already a member of this studio")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		h.writeInvitationError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Joined studio", map[string]any{"studio": membership})
+}
+
+func (h *AuthHandler) writeInvitationError(w http.ResponseWriter, err error) {
+	switch {
+	case stdErrors.Is(err, ErrInvalidToken):
+		errResp := errors.BadRequest("Invitation is invalid or has expired")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrEmailInUse):
+		errResp := errors.Conflict("An account with this email already exists")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	default:
+		if h.Logger != nil {
+			h.Logger.Error("Invitation failed", "err", err)
+		}
+		errResp := errors.Internal("Failed to accept invitation")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	}
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// InvitationRepository persists team invitations in auth.invitations.
+// Creating, listing and revoking act on the active studio; token lookups
+// work across studios because the invitee is not signed in yet.
+type InvitationRepository interface {
+	CountUsers(ctx context.Context) (int64, error)
+	CreateInvitation(ctx context.Context, inv *Invitation, tokenHash string) error
+	ListInvitations(ctx context.Context) ([]Invitation, error)
+	RevokeInvitation(ctx context.Context, invitationID int32) (bool, error)
+	GetInvitation(ctx context.Context, tokenHash string) (*Invitation, error)
+	ConsumeInvitation(ctx context.Context, tokenHash string) (*Invitation, error)
+	SetInvitationUser(ctx context.Context, invitationID, userID int32) error
+}
+
+// Invitation is a pending offer to join a studio with a given permission
+// group.
+type Invitation struct {
+	ID         int32     `json:"id"`
+	Email      string    `json:"email"`
+	StudioID   int32     `json:"studioId"`
+	StudioName string    `json:"studioName"`
+	GroupID    int32     `json:"groupId"`
+	GroupName  string    `json:"groupName"`
+	InvitedBy  *int32    `json:"invitedBy"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// pendingInvitation matches invitations that can still be accepted.
+const pendingInvitation = `i.accepted_at IS NULL AND i.revoked_at IS NULL AND i.expires_at > now()`
+
+func (r *PgxUserRepository) CountUsers(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.DB.QueryRow(ctx, `SELECT count(*) FROM auth.users`).Scan(&n)
+	return n, err
+}
+
+// invitationColumns and invitationFrom select everything scanInvitation
+// expects.
+const (
+	invitationColumns = `i.id, i.email, i.studio_id, s.name, i.group_id, pg.name, i.invited_by, i.expires_at, i.created_at`
+	invitationFrom    = `auth.invitations i
+		JOIN auth.studios s ON s.id = i.studio_id
+		JOIN auth.permission_groups pg ON pg.id = i.group_id`
+)
+
+func scanInvitation(row pgx.Row) (*Invitation, error) {
+	var inv Invitation
+	err := row.Scan(
+		&inv.ID, &inv.Email, &inv.StudioID, &inv.StudioName, &inv.GroupID, &inv.GroupName,
+		&inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// CreateInvitation stores inv in the active studio and fills in its ID,
+// studio, group name and creation time. Earlier pending invitations for the
+// same address to this studio are revoked so only the newest link works.
+// pgx.ErrNoRows means the group is not one of the studio's.
+func (r *PgxUserRepository) CreateInvitation(ctx context.Context, inv *Invitation, tokenHash string) error {
+	args := pgx.NamedArgs{"email": inv.Email}
+	scope, err := tenant.Where(ctx, "i", args)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec(ctx, `
+		UPDATE auth.invitations i
+		SET revoked_at = now()
+		WHERE lower(i.email) = lower(@email) AND `+scope+` AND `+pendingInvitation, args)
+	if err != nil {
+		return err
+	}
+
+	groupScope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH created AS (
+			INSERT INTO auth.invitations (email, studio_id, group_id, token_hash, invited_by, expires_at)
+			SELECT @email, pg.studio_id, pg.id, @token_hash, @invited_by, @expires_at
+			FROM auth.permission_groups pg
+			WHERE pg.id = @group_id AND ` + groupScope + `
+			RETURNING *
+		)
+		SELECT ` + invitationColumns + `
+		FROM created i
+		JOIN auth.studios s ON s.id = i.studio_id
+		JOIN auth.permission_groups pg ON pg.id = i.group_id
+	`
+
+	args["group_id"] = inv.GroupID
+	args["token_hash"] = tokenHash
+	args["invited_by"] = inv.InvitedBy
+	args["expires_at"] = inv.ExpiresAt
+
+	created, err := scanInvitation(r.DB.QueryRow(ctx, query, args))
+	if err != nil {
+		return err
+	}
+	*inv = *created
+	return nil
+}
+
+// ListInvitations returns the active studio's pending invitations.
+func (r *PgxUserRepository) ListInvitations(ctx context.Context) ([]Invitation, error) {
+	args := pgx.NamedArgs{}
+	scope, err := tenant.Where(ctx, "i", args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM ` + invitationFrom + `
+		WHERE ` + scope + ` AND ` + pendingInvitation + `
+		ORDER BY i.created_at DESC
+	`
+
+	rows, err := r.DB.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *inv)
+	}
+	return list, rows.Err()
+}
+
+func (r *PgxUserRepository) RevokeInvitation(ctx context.Context, invitationID int32) (bool, error) {
+	args := pgx.NamedArgs{"id": invitationID}
+	scope, err := tenant.Where(ctx, "i", args)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE auth.invitations i SET revoked_at = now()
+		WHERE i.id = @id AND `+scope+` AND `+pendingInvitation, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetInvitation returns a still-pending invitation without spending it.
+func (r *PgxUserRepository) GetInvitation(ctx context.Context, tokenHash string) (*Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM ` + invitationFrom + `
+		WHERE i.token_hash = @token_hash AND ` + pendingInvitation
+
+	return scanInvitation(r.DB.QueryRow(ctx, query, pgx.NamedArgs{"token_hash": tokenHash}))
+}
+
+// ConsumeInvitation atomically marks a pending invitation accepted.
+// pgx.ErrNoRows means it is unknown, expired, revoked or already used.
+func (r *PgxUserRepository) ConsumeInvitation(ctx context.Context, tokenHash string) (*Invitation, error) {
+	query := `
+		UPDATE auth.invitations i
+		SET accepted_at = now()
+		WHERE i.token_hash = @token_hash AND ` + pendingInvitation + `
+		RETURNING i.id, i.email, i.studio_id, i.group_id, i.invited_by, i.expires_at, i.created_at
+	`
+
+	var inv Invitation
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"token_hash": tokenHash}).Scan(
+		&inv.ID, &inv.Email, &inv.StudioID, &inv.GroupID, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *PgxUserRepository) SetInvitationUser(ctx context.Context, invitationID, userID int32) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.invitations SET accepted_user_id = @user_id WHERE id = @id
+	`, pgx.NamedArgs{"id": invitationID, "user_id": userID})
+	return err
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrEmailInUse         = errors.New("email already in use")
+	ErrRegistrationClosed = errors.New("registration is by invitation only")
+	ErrGroupNotFound      = errors.New("permission group not found")
+	ErrGroupNotGrantable  = errors.New("you cannot grant permissions you do not hold")
+	ErrInvitationMismatch = errors.New("invitation is for a different account")
+)
+
+// RegistrationOpen reports whether anyone may sign up. With open
+// registration disabled, sign-up stays available only until the first
+// (owner) account exists; everyone after that needs an invitation.
+func (s *AuthServiceImpl) RegistrationOpen(ctx context.Context) (bool, error) {
+	if s.OpenRegistration {
+		return true, nil
+	}
+
+	n, err := s.Repo.CountUsers(ctx)
+	if err != nil {
+		return false, err
+	}
+	return n == 0, nil
+}
+
+// InviteUser emails a single-use link that lets email join the active
+// studio in groupID. Existing accounts are added with AddStudioMember
+// instead. A zero ttl uses InvitationTTL.
+//
+// The group may not hold any permission the inviter lacks, so users.invite
+// alone cannot be used to mint administrators.
+func (s *AuthServiceImpl) InviteUser(ctx context.Context, inviter *User, email string, groupID int32, ttl time.Duration) (*Invitation, error) {
+	email = strings.TrimSpace(email)
+	if existing, _ := s.Repo.GetByEmail(ctx, email); existing != nil {
+		return nil, ErrEmailInUse
+	}
+	if err := s.ensureGrantable(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	return s.sendInvitation(ctx, inviter, email, groupID, ttl, false)
+}
+
+// sendInvitation stores an invitation to the active studio and emails its
+// link. Invitations for existing accounts ask the user to sign in and join
+// rather than to create an account.
+func (s *AuthServiceImpl) sendInvitation(ctx context.Context, inviter *User, email string, groupID int32, ttl time.Duration, existing bool) (*Invitation, error) {
+	if ttl <= 0 {
+		ttl = s.InvitationTTL
+	}
+
+	raw, hash, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Invitation{
+		Email:     email,
+		GroupID:   groupID,
+		InvitedBy: &inviter.ID,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.Repo.CreateInvitation(ctx, inv, hash); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrGroupNotFound
+		}
+		return nil, fmt.Errorf("store invitation: %w", err)
+	}
+
+	link := s.FrontendURL + "/invite?token=" + url.QueryEscape(raw)
+	action := "Open the link below to create your account:"
+	if existing {
+		action = "Sign in to your existing account and open the link below to accept:"
+	}
+
+	err = s.Mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "You've been invited to Sabiflow",
+		Body: fmt.Sprintf(
+			"Hi,\n\n%s %s has invited you to join %s on Sabiflow as %s.\n\n"+
+				"%s\n\n%s\n\n"+
+				"The invitation expires on %s.\n",
+			inviter.FirstName, inviter.LastName, inv.StudioName, inv.GroupName, action, link, inv.ExpiresAt.Format(time.RFC1123),
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send invitation: %w", err)
+	}
+
+	return inv, nil
+}
+
+// ensureGrantable returns ErrGroupNotGrantable unless the request's
+// principal holds every permission of groupID.
+func (s *AuthServiceImpl) ensureGrantable(ctx context.Context, groupID int32) error {
+	group, err := s.GetPermissionGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+
+	p, ok := middleware.PrincipalFrom(ctx)
+	if !ok {
+		return ErrGroupNotGrantable
+	}
+	for _, code := range group.Permissions {
+		if !p.Has(code) {
+			return ErrGroupNotGrantable
+		}
+	}
+	return nil
+}
+
+func (s *AuthServiceImpl) ListInvitations(ctx context.Context) ([]Invitation, error) {
+	return s.Repo.ListInvitations(ctx)
+}
+
+func (s *AuthServiceImpl) RevokeInvitation(ctx context.Context, invitationID int32) (bool, error) {
+	return s.Repo.RevokeInvitation(ctx, invitationID)
+}
+
+// LookupInvitation returns the pending invitation for token so the accept
+// page can show who it is for.
+func (s *AuthServiceImpl) LookupInvitation(ctx context.Context, token string) (*Invitation, error) {
+	inv, err := s.Repo.GetInvitation(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return inv, nil
+}
+
+// AcceptInvitation spends token and creates the invited user as a member
+// of the invitation's studio and group, all in one transaction. The address
+// is treated as verified because the link was delivered to it.
+func (s *AuthServiceImpl) AcceptInvitation(ctx context.Context, token, firstName, lastName, password string) (*User, error) {
+	inv, err := s.LookupInvitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if existing, _ := s.Repo.GetByEmail(ctx, inv.Email); existing != nil {
+		return nil, ErrEmailInUse
+	}
+
+	hashed, err := s.hashNewPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		FirstName: firstName,
+		LastName:  lastName,
+		Password:  hashed,
+	}
+	err = s.Repo.WithTx(ctx, func(repo UserRepository) error {
+		inv, err := repo.ConsumeInvitation(ctx, hashToken(token))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		user.Email = inv.Email
+		if err := repo.Create(ctx, user); err != nil {
+			// Someone registered the address, in any case, since the check above.
+			if isUniqueViolation(err) {
+				return ErrEmailInUse
+			}
+			return fmt.Errorf("create invited user: %w", err)
+		}
+
+		if _, err := repo.AddMember(ctx, inv.StudioID, user.ID, &inv.GroupID); err != nil {
+			return err
+		}
+		if err := repo.SetInvitationUser(ctx, inv.ID, user.ID); err != nil {
+			return err
+		}
+		return repo.MarkEmailVerified(ctx, user.ID, user.Email)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return user, nil
+}
+
+// JoinStudio spends token to add the signed-in userID to the invitation's
+// studio and group. It is how existing accounts accept an invitation from
+// AddStudioMember, so no studio can add someone without their consent. The
+// invitation is only spent if the membership is created.
+func (s *AuthServiceImpl) JoinStudio(ctx context.Context, userID int32, token string) (*Membership, error) {
+	inv, err := s.LookupInvitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, inv.Email) {
+		return nil, ErrInvitationMismatch
+	}
+
+	var studioID int32
+	err = s.Repo.WithTx(ctx, func(repo UserRepository) error {
+		inv, err := repo.ConsumeInvitation(ctx, hashToken(token))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+		studioID = inv.StudioID
+
+		added, err := repo.AddMember(ctx, inv.StudioID, userID, &inv.GroupID)
+		if err != nil {
+			return err
+		}
+		if !added {
+			return ErrAlreadyMember
+		}
+		return repo.SetInvitationUser(ctx, inv.ID, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.Principals.Forget(userID)
+
+	return s.membershipIn(ctx, userID, studioID)
+}
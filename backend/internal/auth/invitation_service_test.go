@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/iankencruz/sabiflow/internal/platform/password"
+	"github.com/jackc/pgx/v5"
+)
+
+// inviteState is what inviteRepo stores; WithTx works on a copy and keeps it
+// only when the callback succeeds.
+type inviteState struct {
+	consumed bool
+	users    map[string]int32
+	members  map[int32]bool
+	linked   int32
+	verified bool
+}
+
+type inviteRepo struct {
+	UserRepository
+	state *inviteState
+	inTx  bool
+
+	// failAddMember makes AddMember error inside the transaction.
+	failAddMember bool
+	// writesOutsideTx counts writes that bypassed WithTx.
+	writesOutsideTx int
+}
+
+var testInvitation = Invitation{ID: 7, Email: "new@example.com", StudioID: 1, GroupID: 2}
+
+func newInviteRepo() *inviteRepo {
+	return &inviteRepo{state: &inviteState{
+		users:   map[string]int32{},
+		members: map[int32]bool{},
+	}}
+}
+
+func (r *inviteRepo) write() {
+	if !r.inTx {
+		r.writesOutsideTx++
+	}
+}
+
+func (r *inviteRepo) WithTx(_ context.Context, fn func(UserRepository) error) error {
+	staged := *r.state
+	staged.users = maps.Clone(r.state.users)
+	staged.members = maps.Clone(r.state.members)
+
+	tx := &inviteRepo{state: &staged, inTx: true, failAddMember: r.failAddMember}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	*r.state = staged
+	return nil
+}
+
+func (r *inviteRepo) GetInvitation(context.Context, string) (*Invitation, error) {
+	if r.state.consumed {
+		return nil, pgx.ErrNoRows
+	}
+	inv := testInvitation
+	return &inv, nil
+}
+
+func (r *inviteRepo) ConsumeInvitation(context.Context, string) (*Invitation, error) {
+	r.write()
+	if r.state.consumed {
+		return nil, pgx.ErrNoRows
+	}
+	r.state.consumed = true
+	inv := testInvitation
+	return &inv, nil
+}
+
+func (r *inviteRepo) GetByEmail(_ context.Context, email string) (*User, error) {
+	id, ok := r.state.users[email]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &User{ID: id, Email: email}, nil
+}
+
+func (r *inviteRepo) GetByID(_ context.Context, id int32) (*User, error) {
+	for email, uid := range r.state.users {
+		if uid == id {
+			return &User{ID: id, Email: email}, nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (r *inviteRepo) Create(_ context.Context, user *User) error {
+	r.write()
+	user.ID = int32(len(r.state.users) + 100)
+	r.state.users[user.Email] = user.ID
+	return nil
+}
+
+func (r *inviteRepo) AddMember(_ context.Context, _, userID int32, _ *int32) (bool, error) {
+	r.write()
+	if r.failAddMember {
+		return false, errors.New("add member failed")
+	}
+	if r.state.members[userID] {
+		return false, nil
+	}
+	r.state.members[userID] = true
+	return true, nil
+}
+
+func (r *inviteRepo) SetInvitationUser(_ context.Context, _, userID int32) error {
+	r.write()
+	r.state.linked = userID
+	return nil
+}
+
+func (r *inviteRepo) MarkEmailVerified(context.Context, int32, string) error {
+	r.write()
+	r.state.verified = true
+	return nil
+}
+
+func (r *inviteRepo) ListMemberships(_ context.Context, userID int32) ([]Membership, error) {
+	if !r.state.members[userID] {
+		return nil, nil
+	}
+	m := Membership{}
+	m.ID = testInvitation.StudioID
+	return []Membership{m}, nil
+}
+
+func newInviteService(repo *inviteRepo) *AuthServiceImpl {
+	return &AuthServiceImpl{
+		Repo:      repo,
+		Passwords: password.NewArgon2id(password.Params{Memory: 1024, Iterations: 1, Parallelism: 1}),
+	}
+}
+
+func TestAcceptInvitation(t *testing.T) {
+	repo := newInviteRepo()
+	s := newInviteService(repo)
+
+	user, err := s.AcceptInvitation(context.Background(), "token", "New", "User", "correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.writesOutsideTx != 0 {
+		t.Fatalf("%d writes outside the transaction", repo.writesOutsideTx)
+	}
+	st := repo.state
+	if !st.consumed || !st.members[user.ID] || st.linked != user.ID || !st.verified {
+		t.Fatalf("state = %+v, want consumed, member, linked and verified", *st)
+	}
+	if !user.EmailVerified() {
+		t.Fatal("returned user not marked verified")
+	}
+
+	if _, err := s.AcceptInvitation(context.Background(), "token", "New", "User", "correct horse battery"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("second accept: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestAcceptInvitationRollsBack(t *testing.T) {
+	repo := newInviteRepo()
+	repo.failAddMember = true
+	s := newInviteService(repo)
+
+	if _, err := s.AcceptInvitation(context.Background(), "token", "New", "User", "correct horse battery"); err == nil {
+		t.Fatal("AcceptInvitation succeeded")
+	}
+	if repo.state.consumed {
+		t.Fatal("invitation spent by a failed accept")
+	}
+	if _, ok := repo.state.users[testInvitation.Email]; ok {
+		t.Fatal("user created by a failed accept")
+	}
+}
+
+func TestJoinStudio(t *testing.T) {
+	repo := newInviteRepo()
+	repo.state.users[testInvitation.Email] = 9
+	s := newInviteService(repo)
+
+	if _, err := s.JoinStudio(context.Background(), 9, "token"); err != nil {
+		t.Fatal(err)
+	}
+	if repo.writesOutsideTx != 0 {
+		t.Fatalf("%d writes outside the transaction", repo.writesOutsideTx)
+	}
+	if !repo.state.consumed || !repo.state.members[9] || repo.state.linked != 9 {
+		t.Fatalf("state = %+v, want consumed, member and linked", *repo.state)
+	}
+}
+
+func TestJoinStudioKeepsInvitationWhenAlreadyMember(t *testing.T) {
+	repo := newInviteRepo()
+	repo.state.users[testInvitation.Email] = 9
+	repo.state.members[9] = true
+	s := newInviteService(repo)
+
+	if _, err := s.JoinStudio(context.Background(), 9, "token"); !errors.Is(err, ErrAlreadyMember) {
+		t.Fatalf("err = %v, want ErrAlreadyMember", err)
+	}
+	if repo.state.consumed {
+		t.Fatal("invitation spent although the user was already a member")
+	}
+}
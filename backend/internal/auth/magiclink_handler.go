@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// ReasonMagicLinkDisabled tells the SPA this deployment has no magic links.
+const ReasonMagicLinkDisabled = "magic_link_disabled"
+
+// RequestMagicLinkHandler emails a sign-in link. It answers the same way
+// whether or not the address has an account.
+func (h *AuthHandler) RequestMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("email", input.Email)
+	v.MatchPattern("email", input.Email, validators.EmailRX, "Must be a valid email address")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	err := h.Service.RequestMagicLink(r.Context(), input.Email, sessions.ClientIP(r))
+	var throttled *LoginThrottledError
+	switch {
+	case stdErrors.Is(err, ErrMagicLinkDisabled):
+		errResp := errors.NotFound("Magic-link sign-in is not enabled").WithReason(ReasonMagicLinkDisabled)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+		return
+	case err != nil && h.Logger != nil:
+		// Still answer normally so failures don't reveal the account.
+		h.Logger.Error("Failed to send magic link", "err", err)
+	}
+
+	response.WriteJSON(w, http.StatusOK,
+		"If an account exists for that email, a sign-in link has been sent", nil)
+}
+
+// MagicLinkLoginHandler is the target of the emailed link. It spends the
+// token, starts a session (or the 2FA step) and redirects to the SPA.
+func (h *AuthHandler) MagicLinkLoginHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := h.Service.ConsumeMagicLink(r.Context(), chi.URLParam(r, "token"))
+	switch {
+	case stdErrors.Is(err, ErrMagicLinkDisabled):
+		h.magicLinkFailed(w, r, ReasonMagicLinkDisabled, err)
+		return
+	case stdErrors.Is(err, ErrAccountDisabled):
+		h.magicLinkFailed(w, r, ReasonAccountDisabled, err)
+		return
+	case err != nil:
+		h.magicLinkFailed(w, r, "magic_link_invalid", err)
+		return
+	}
+
+	pending, err := h.startSecondFactorIfEnabled(r, user.ID)
+	if err != nil {
+		h.magicLinkFailed(w, r, "magic_link_failed", err)
+		return
+	}
+	if pending != "" {
+		if err := h.redirectToSecondFactor(w, r, pending); err != nil {
+			h.magicLinkFailed(w, r, "magic_link_failed", err)
+		}
+		return
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, user.ID, false); err != nil {
+		h.magicLinkFailed(w, r, "magic_link_failed", err)
+		return
+	}
+
+	http.Redirect(w, r, h.OAuthSuccessURL, http.StatusSeeOther)
+}
+
+// magicLinkFailed logs err and sends the browser to the SPA's login page
+// with a machine-readable reason.
+func (h *AuthHandler) magicLinkFailed(w http.ResponseWriter, r *http.Request, reason string, err error) {
+	if h.Logger != nil {
+		h.Logger.Info("Magic-link login failed", "reason", reason, "err", err)
+	}
+	http.Redirect(w, r, h.FrontendURL+"/login?error="+url.QueryEscape(reason), http.StatusSeeOther)
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MagicLinkRepository stores single-use sign-in links in auth.magic_links.
+type MagicLinkRepository interface {
+	CreateMagicLink(ctx context.Context, userID int32, email, tokenHash string, expiresAt time.Time) error
+	ConsumeMagicLink(ctx context.Context, tokenHash string) (int32, string, error)
+}
+
+func (r *PgxUserRepository) CreateMagicLink(ctx context.Context, userID int32, email, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO auth.magic_links (user_id, email, token_hash, expires_at)
+		VALUES (@user_id, @email, @token_hash, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":    userID,
+		"email":      email,
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	}
+
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
+
+// ConsumeMagicLink atomically spends a valid link and returns the user and
+// the address it was sent to. Spending one link voids the user's others.
+func (r *PgxUserRepository) ConsumeMagicLink(ctx context.Context, tokenHash string) (int32, string, error) {
+	query := `
+		WITH spent AS (
+			UPDATE auth.magic_links
+			SET used_at = now()
+			WHERE token_hash = @token_hash AND used_at IS NULL AND expires_at > now()
+			RETURNING user_id, email
+		), voided AS (
+			UPDATE auth.magic_links
+			SET used_at = now()
+			WHERE user_id IN (SELECT user_id FROM spent) AND used_at IS NULL
+		)
+		SELECT user_id, email FROM spent
+	`
+
+	var userID int32
+	var email string
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"token_hash": tokenHash}).Scan(&userID, &email)
+	return userID, email, err
+}
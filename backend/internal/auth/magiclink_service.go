@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrMagicLinkDisabled is returned when the deployment has not switched
+// magic-link sign-in on.
+var ErrMagicLinkDisabled = errors.New("magic-link sign-in is disabled")
+
+// MagicLinkSettings configures passwordless sign-in by email link.
+type MagicLinkSettings struct {
+	Enabled bool
+	// TTL is how long an emailed link stays valid.
+	TTL time.Duration
+	// URL is the API endpoint the link points at; the raw token is appended.
+	URL string
+	// At most MaxPerAccount links are mailed to one address, and
+	// MaxPerIP requests accepted from one client, per Window.
+	MaxPerAccount int
+	MaxPerIP      int
+	Window        time.Duration
+}
+
+func (s *AuthServiceImpl) MagicLinkEnabled() bool {
+	return s.MagicLinks.Enabled
+}
+
+// RequestMagicLink emails a sign-in link to email if it belongs to an
+// active account. Unknown addresses and accounts over their limit return
+// nil, so the response never reveals who is registered; only the per-IP
+// limit surfaces, as a *LoginThrottledError. The link is created and sent
+// off the request path so response times do not give accounts away either.
+func (s *AuthServiceImpl) RequestMagicLink(ctx context.Context, email, ip string) error {
+	if !s.MagicLinks.Enabled {
+		return ErrMagicLinkDisabled
+	}
+
+	since := time.Now().Add(-s.MagicLinks.Window)
+
+	requests, err := s.Repo.RecordAttempt(ctx, "magic-ip:"+ip, since)
+	if err != nil {
+		return err
+	}
+	if s.MagicLinks.MaxPerIP > 0 && requests > s.MagicLinks.MaxPerIP {
+		return &LoginThrottledError{RetryAfter: s.MagicLinks.Window}
+	}
+
+	requests, err = s.Repo.RecordAttempt(ctx, "magic-account:"+strings.ToLower(strings.TrimSpace(email)), since)
+	if err != nil {
+		return err
+	}
+	if s.MagicLinks.MaxPerAccount > 0 && requests > s.MagicLinks.MaxPerAccount {
+		return nil
+	}
+
+	user, err := s.Repo.GetByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Disabled() {
+		return nil
+	}
+
+	s.goBackground(ctx, func(ctx context.Context) {
+		if err := s.sendMagicLink(ctx, user); err != nil {
+			s.logError("Failed to send magic link", "err", err, "user_id", user.ID)
+		}
+	})
+	return nil
+}
+
+// sendMagicLink stores a sign-in token for user and emails them the link.
+// It runs off the request path.
+func (s *AuthServiceImpl) sendMagicLink(ctx context.Context, user *User) error {
+	raw, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.CreateMagicLink(ctx, user.ID, user.Email, hash, time.Now().Add(s.MagicLinks.TTL)); err != nil {
+		return err
+	}
+
+	link := s.MagicLinks.URL + url.PathEscape(raw)
+
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Sabiflow sign-in link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to sign in to Sabiflow:\n\n%s\n\n"+
+				"The link works once and expires in %s.\n"+
+				"If you didn't ask for it, you can ignore this email.\n",
+			user.FirstName, link, s.MagicLinks.TTL,
+		),
+	})
+}
+
+// ConsumeMagicLink spends a sign-in link and returns its user. Following
+// the link proves the user reads that inbox, so the address is marked
+// verified.
+func (s *AuthServiceImpl) ConsumeMagicLink(ctx context.Context, token string) (*User, error) {
+	if !s.MagicLinks.Enabled {
+		return nil, ErrMagicLinkDisabled
+	}
+
+	userID, email, err := s.Repo.ConsumeMagicLink(ctx, hashToken(token))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Email != email {
+		return nil, ErrInvalidToken
+	}
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	if err := s.MarkEmailVerified(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/jackc/pgx/v5"
+)
+
+type magicLink struct {
+	userID    int32
+	email     string
+	expiresAt time.Time
+	used      bool
+}
+
+// magicRepo keeps one user and their sign-in links in memory.
+type magicRepo struct {
+	*memThrottle
+
+	mu       sync.Mutex
+	user     User
+	links    map[string]*magicLink
+	verified bool
+}
+
+func (r *magicRepo) GetByEmail(_ context.Context, email string) (*User, error) {
+	if !strings.EqualFold(email, r.user.Email) {
+		return nil, pgx.ErrNoRows
+	}
+	u := r.user
+	return &u, nil
+}
+
+func (r *magicRepo) GetByID(context.Context, int32) (*User, error) {
+	u := r.user
+	return &u, nil
+}
+
+func (r *magicRepo) CreateMagicLink(_ context.Context, userID int32, email, tokenHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.links[tokenHash] = &magicLink{userID: userID, email: email, expiresAt: expiresAt}
+	return nil
+}
+
+func (r *magicRepo) ConsumeMagicLink(_ context.Context, tokenHash string) (int32, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	link, ok := r.links[tokenHash]
+	if !ok || link.used || !link.expiresAt.After(time.Now()) {
+		return 0, "", pgx.ErrNoRows
+	}
+	link.used = true
+	return link.userID, link.email, nil
+}
+
+func (r *magicRepo) MarkEmailVerified(context.Context, int32, string) error {
+	r.verified = true
+	return nil
+}
+
+const magicLinkURL = "https://api.example.com/api/v1/auth/magic-link/"
+
+func newMagicLinkService() (*AuthServiceImpl, *magicRepo, *mail.MemorySender) {
+	repo := &magicRepo{
+		memThrottle: newMemThrottle(),
+		user:        User{ID: 1, FirstName: "Ada", Email: "ada@example.com"},
+		links:       map[string]*magicLink{},
+	}
+	mailer := mail.NewMemorySender()
+	return &AuthServiceImpl{
+		Repo:   repo,
+		Mailer: mailer,
+		MagicLinks: MagicLinkSettings{
+			Enabled:       true,
+			TTL:           15 * time.Minute,
+			URL:           magicLinkURL,
+			MaxPerAccount: 2,
+			MaxPerIP:      3,
+			Window:        time.Hour,
+		},
+	}, repo, mailer
+}
+
+// magicToken extracts the token from the link in a sign-in email.
+func magicToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	for _, field := range strings.Fields(msg.Body) {
+		if token, ok := strings.CutPrefix(field, magicLinkURL); ok {
+			return token
+		}
+	}
+	t.Fatalf("no sign-in link in %q", msg.Body)
+	return ""
+}
+
+func TestMagicLinkSingleUse(t *testing.T) {
+	s, repo, mailer := newMagicLinkService()
+	ctx := context.Background()
+
+	if err := s.RequestMagicLink(ctx, "ada@example.com", "198.51.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	msg, ok := mailer.Last("ada@example.com")
+	if !ok {
+		t.Fatal("no sign-in link sent")
+	}
+	token := magicToken(t, msg)
+
+	user, err := s.ConsumeMagicLink(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != 1 || !repo.verified {
+		t.Fatalf("user = %d, verified = %t", user.ID, repo.verified)
+	}
+
+	if _, err := s.ConsumeMagicLink(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("second use: err = %v, want ErrInvalidToken", err)
+	}
+	if _, err := s.ConsumeMagicLink(ctx, "made-up"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("unknown token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestMagicLinkRequiresCurrentEmail(t *testing.T) {
+	s, repo, mailer := newMagicLinkService()
+	ctx := context.Background()
+
+	if err := s.RequestMagicLink(ctx, "ada@example.com", "198.51.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	msg, _ := mailer.Last("ada@example.com")
+
+	repo.user.Email = "ada@new.example.com"
+	if _, err := s.ConsumeMagicLink(ctx, magicToken(t, msg)); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken for a link to the old address", err)
+	}
+}
+
+func TestRequestMagicLinkLimits(t *testing.T) {
+	s, _, mailer := newMagicLinkService()
+	ctx := context.Background()
+
+	// MaxPerAccount is 2, however many clients ask; the rest are silently
+	// dropped.
+	for i := range 4 {
+		if err := s.RequestMagicLink(ctx, "ada@example.com", fmt.Sprintf("198.51.100.%d", i)); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	s.Wait()
+	if n := len(mailer.Messages()); n != 2 {
+		t.Fatalf("%d links sent, want 2", n)
+	}
+
+	// MaxPerIP is 3; the fourth request from one client is refused.
+	for i := range 3 {
+		if err := s.RequestMagicLink(ctx, fmt.Sprintf("user%d@example.com", i), "203.0.113.9"); err != nil {
+			t.Fatalf("request %d from one IP: %v", i+1, err)
+		}
+	}
+	var throttled *LoginThrottledError
+	if err := s.RequestMagicLink(ctx, "other@example.com", "203.0.113.9"); !errors.As(err, &throttled) {
+		t.Fatalf("err = %v, want LoginThrottledError", err)
+	}
+	s.Wait()
+	if n := len(mailer.Messages()); n != 2 {
+		t.Fatalf("%d links sent, want no more for unknown addresses", n)
+	}
+}
+
+func TestMagicLinkDisabled(t *testing.T) {
+	s, _, _ := newMagicLinkService()
+	s.MagicLinks.Enabled = false
+
+	if err := s.RequestMagicLink(context.Background(), "ada@example.com", "198.51.100.1"); !errors.Is(err, ErrMagicLinkDisabled) {
+		t.Fatalf("request: err = %v, want ErrMagicLinkDisabled", err)
+	}
+	if _, err := s.ConsumeMagicLink(context.Background(), "anything"); !errors.Is(err, ErrMagicLinkDisabled) {
+		t.Fatalf("consume: err = %v, want ErrMagicLinkDisabled", err)
+	}
+}
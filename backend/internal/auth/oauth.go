@@ -2,27 +2,364 @@ package auth
 
 import (
 	"context"
-	"os"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 )
 
-var googleOAuthConfig = &oauth2.Config{
-	ClientID:     os.Getenv("GOOGLE_OAUTH_CLIENT_ID"),
-	ClientSecret: os.Getenv("GOOGLE_OAUTH_CLIENT_SECRET"),
-	RedirectURL:  os.Getenv("GOOGLE_OAUTH_REDIRECT_URL"), // e.g. http://localhost:8080/api/auth/google/callback
-	Scopes: []string{
-		"https://www.googleapis.com/auth/userinfo.email",
-		"https://www.googleapis.com/auth/userinfo.profile",
-	},
-	Endpoint: google.Endpoint,
+// oauthAttemptTTL bounds how long a user may take at the provider's consent
+// screen before the callback is rejected.
+const oauthAttemptTTL = 10 * time.Minute
+
+// oauthAttemptKey is the session data key holding the in-flight attempt.
+const oauthAttemptKey = "oauth.attempt"
+
+// GoogleIssuer is Google's OpenID Connect issuer.
+const GoogleIssuer = "https://accounts.google.com"
+
+var (
+	ErrOAuthStateMismatch   = errors.New("oauth state mismatch")
+	ErrOAuthNonceMismatch   = errors.New("oauth nonce mismatch")
+	ErrOAuthUnknownProvider = errors.New("unknown oauth provider")
+	ErrOAuthMissingEmail    = errors.New("provider did not return an email address")
+)
+
+// -----------------------------------------------------------------------------
+// Provider configuration
+// -----------------------------------------------------------------------------
+
+// ClaimMapping names the claims that carry each user attribute. Providers
+// that deviate from the OIDC standard claims (or put the address in
+// "preferred_username") can be mapped without code changes.
+type ClaimMapping struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+// DefaultClaimMapping returns the standard OIDC claim names.
+func DefaultClaimMapping() ClaimMapping {
+	return ClaimMapping{
+		Subject:       "sub",
+		Email:         "email",
+		EmailVerified: "email_verified",
+		GivenName:     "given_name",
+		FamilyName:    "family_name",
+		Name:          "name",
+	}
+}
+
+// ProviderConfig describes one OpenID Connect issuer.
+type ProviderConfig struct {
+	Name         string // URL slug, e.g. "google" or "keycloak"
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Claims       ClaimMapping
+}
+
+// ExternalIdentity is what a provider asserted about the user, after claim
+// mapping.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+}
+
+// -----------------------------------------------------------------------------
+// Provider
+// -----------------------------------------------------------------------------
+
+// OAuthProvider runs the authorization-code flow against one issuer.
+// Discovery (.well-known/openid-configuration) happens lazily on first use
+// so the API still boots while an identity provider is unreachable.
+type OAuthProvider struct {
+	cfg ProviderConfig
+
+	mu       sync.Mutex
+	oidc     *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth2   *oauth2.Config
+}
+
+func NewOAuthProvider(cfg ProviderConfig) *OAuthProvider {
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	defaults := DefaultClaimMapping()
+	orDefault(&cfg.Claims.Subject, defaults.Subject)
+	orDefault(&cfg.Claims.Email, defaults.Email)
+	orDefault(&cfg.Claims.EmailVerified, defaults.EmailVerified)
+	orDefault(&cfg.Claims.GivenName, defaults.GivenName)
+	orDefault(&cfg.Claims.FamilyName, defaults.FamilyName)
+	orDefault(&cfg.Claims.Name, defaults.Name)
+
+	return &OAuthProvider{cfg: cfg}
+}
+
+func (p *OAuthProvider) Name() string        { return p.cfg.Name }
+func (p *OAuthProvider) DisplayName() string { return p.cfg.DisplayName }
+
+func (p *OAuthProvider) discover(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oidc != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+	if err != nil {
+		return fmt.Errorf("oidc discovery for %s: %w", p.cfg.Name, err)
+	}
+
+	p.oidc = provider
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.cfg.RedirectURL,
+		Scopes:       p.cfg.Scopes,
+		Endpoint:     provider.Endpoint(),
+	}
+	return nil
+}
+
+// AuthCodeURL returns the provider's consent URL for attempt, including the
+// PKCE challenge and nonce.
+func (p *OAuthProvider) AuthCodeURL(ctx context.Context, attempt *oauthAttempt) (string, error) {
+	if err := p.discover(ctx); err != nil {
+		return "", err
+	}
+
+	return p.oauth2.AuthCodeURL(attempt.State,
+		oauth2.S256ChallengeOption(attempt.Verifier),
+		oidc.Nonce(attempt.Nonce),
+	), nil
+}
+
+// Exchange redeems code, verifies the ID token's signature against the
+// issuer's JWKS and its nonce, and maps claims (ID token first, userinfo
+// filling any gaps) to an ExternalIdentity.
+func (p *OAuthProvider) Exchange(ctx context.Context, code string, attempt *oauthAttempt) (*ExternalIdentity, error) {
+	if err := p.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(attempt.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("token exchange: %w", err)
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(attempt.Nonce)) != 1 {
+		return nil, ErrOAuthNonceMismatch
+	}
+
+	claims := map[string]any{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	// The userinfo call goes through the oauth2 client, so the access token
+	// is sent as a bearer header rather than in the URL.
+	if p.oidc.UserInfoEndpoint() != "" {
+		info, err := p.oidc.UserInfo(ctx, p.oauth2.TokenSource(ctx, token))
+		if err == nil && info.Subject == idToken.Subject {
+			extra := map[string]any{}
+			if err := info.Claims(&extra); err == nil {
+				for k, v := range extra {
+					if _, ok := claims[k]; !ok {
+						claims[k] = v
+					}
+				}
+			}
+		}
+	}
+
+	return p.mapClaims(claims)
+}
+
+func (p *OAuthProvider) mapClaims(claims map[string]any) (*ExternalIdentity, error) {
+	m := p.cfg.Claims
+
+	id := &ExternalIdentity{
+		Provider:      p.cfg.Name,
+		Subject:       claimString(claims, m.Subject),
+		Email:         strings.ToLower(claimString(claims, m.Email)),
+		EmailVerified: claimBool(claims, m.EmailVerified),
+		FirstName:     claimString(claims, m.GivenName),
+		LastName:      claimString(claims, m.FamilyName),
+	}
+
+	if id.FirstName == "" && id.LastName == "" {
+		parts := strings.Fields(claimString(claims, m.Name))
+		if len(parts) > 0 {
+			id.FirstName = parts[0]
+		}
+		if len(parts) > 1 {
+			id.LastName = strings.Join(parts[1:], " ")
+		}
+	}
+
+	if id.Subject == "" {
+		return nil, errors.New("provider did not return a subject")
+	}
+	if id.Email == "" {
+		return nil, ErrOAuthMissingEmail
+	}
+	return id, nil
+}
+
+func orDefault(dst *string, def string) {
+	if *dst == "" {
+		*dst = def
+	}
+}
+
+func claimString(claims map[string]any, key string) string {
+	s, _ := claims[key].(string)
+	return strings.TrimSpace(s)
+}
+
+// claimBool accepts both JSON booleans and the "true" strings some
+// providers emit for email_verified.
+func claimBool(claims map[string]any, key string) bool {
+	switch v := claims[key].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// -----------------------------------------------------------------------------
+// Registry
+// -----------------------------------------------------------------------------
+
+// ProviderRegistry holds the configured providers by name.
+type ProviderRegistry struct {
+	providers map[string]*OAuthProvider
+}
+
+func NewProviderRegistry(cfgs []ProviderConfig) *ProviderRegistry {
+	reg := &ProviderRegistry{providers: make(map[string]*OAuthProvider, len(cfgs))}
+	for _, cfg := range cfgs {
+		reg.providers[cfg.Name] = NewOAuthProvider(cfg)
+	}
+	return reg
+}
+
+func (r *ProviderRegistry) Get(name string) (*OAuthProvider, bool) {
+	if r == nil {
+		return nil, false
+	}
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// List returns the providers sorted by name, for the login page.
+func (r *ProviderRegistry) List() []*OAuthProvider {
+	if r == nil {
+		return nil
+	}
+	list := make([]*OAuthProvider, 0, len(r.providers))
+	for _, p := range r.providers {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].cfg.Name < list[j].cfg.Name })
+	return list
+}
+
+// -----------------------------------------------------------------------------
+// Per-attempt state
+// -----------------------------------------------------------------------------
+
+// oauthAttempt is the per-login state bound to the browser's session while
+// the user is away at the provider.
+type oauthAttempt struct {
+	Provider  string    `json:"provider"`
+	State     string    `json:"state"`
+	Verifier  string    `json:"verifier"`
+	Nonce     string    `json:"nonce"`
+	ReturnTo  string    `json:"returnTo"`
+	CreatedAt time.Time `json:"createdAt"`
+	// LinkUserID is set when a signed-in user is linking the provider to
+	// their account rather than logging in.
+	LinkUserID int32 `json:"linkUserId,omitempty"`
+}
+
+// newOAuthAttempt generates a fresh state, PKCE verifier and nonce.
+func newOAuthAttempt(provider, returnTo string) (*oauthAttempt, error) {
+	state, _, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, _, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauthAttempt{
+		Provider:  provider,
+		State:     state,
+		Verifier:  oauth2.GenerateVerifier(),
+		Nonce:     nonce,
+		ReturnTo:  returnTo,
+		CreatedAt: time.Now(),
+	}, nil
 }
 
-func GetGoogleAuthURL(state string) string {
-	return googleOAuthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline)
+// check validates the provider and state echoed back on the callback.
+func (a *oauthAttempt) check(provider, state string) error {
+	if a.Provider != provider || time.Since(a.CreatedAt) > oauthAttemptTTL {
+		return ErrOAuthStateMismatch
+	}
+	if subtle.ConstantTimeCompare([]byte(a.State), []byte(state)) != 1 {
+		return ErrOAuthStateMismatch
+	}
+	return nil
 }
 
-func ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
-	return googleOAuthConfig.Exchange(ctx, code)
+// safeReturnTo accepts only same-site absolute paths ("/projects/42"),
+// rejecting scheme-relative ("//evil.com") and backslash tricks so the
+// parameter cannot be turned into an open redirect.
+func safeReturnTo(path string) string {
+	if path == "" || !strings.HasPrefix(path, "/") {
+		return ""
+	}
+	if strings.HasPrefix(path, "//") || strings.ContainsAny(path, "\\\r\n") {
+		return ""
+	}
+	return path
 }
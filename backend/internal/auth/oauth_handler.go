@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+)
+
+// ListProvidersHandler tells the login page which SSO buttons to render and
+// whether to offer a magic link.
+func (h *AuthHandler) ListProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	type provider struct {
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+		LoginURL    string `json:"loginUrl"`
+	}
+
+	list := []provider{}
+	for _, p := range h.Providers.List() {
+		list = append(list, provider{
+			Name:        p.Name(),
+			DisplayName: p.DisplayName(),
+			LoginURL:    "/api/v1/auth/" + p.Name() + "/login",
+		})
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Providers", map[string]any{
+		"providers": list,
+		"magicLink": h.Service.MagicLinkEnabled(),
+	})
+}
+
+// OAuthLogin starts the OIDC flow for {provider}. A random state, PKCE
+// verifier and nonce are bound to the browser's session before redirecting.
+// An optional ?return_to=/path is honoured after a successful login.
+func (h *AuthHandler) OAuthLogin(w http.ResponseWriter, r *http.Request) {
+	h.startOAuth(w, r, 0)
+}
+
+// startOAuth redirects to {provider}, remembering linkUserID (if any) so the
+// callback links instead of logging in.
+func (h *AuthHandler) startOAuth(w http.ResponseWriter, r *http.Request, linkUserID int32) {
+	name := chi.URLParam(r, "provider")
+
+	provider, ok := h.Providers.Get(name)
+	if !ok {
+		h.oauthFailed(w, r, "oauth_provider", fmt.Errorf("%w: %q", ErrOAuthUnknownProvider, name))
+		return
+	}
+
+	attempt, err := newOAuthAttempt(name, safeReturnTo(r.URL.Query().Get("return_to")))
+	if err != nil {
+		h.oauthFailed(w, r, "oauth_failed", err)
+		return
+	}
+	attempt.LinkUserID = linkUserID
+
+	authURL, err := provider.AuthCodeURL(r.Context(), attempt)
+	if err != nil {
+		h.oauthFailed(w, r, "oauth_unavailable", err)
+		return
+	}
+
+	state, _ := json.Marshal(attempt)
+	if err := h.SessionManager.Put(w, r, oauthAttemptKey, string(state)); err != nil {
+		h.oauthFailed(w, r, "oauth_failed", err)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+}
+
+// OAuthCallback finishes the OIDC flow. Because it is reached by a browser
+// navigation, every failure redirects to the SPA rather than returning JSON.
+func (h *AuthHandler) OAuthCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := chi.URLParam(r, "provider")
+
+	provider, ok := h.Providers.Get(name)
+	if !ok {
+		h.oauthFailed(w, r, "oauth_provider", fmt.Errorf("%w: %q", ErrOAuthUnknownProvider, name))
+		return
+	}
+
+	attempt, err := h.takeOAuthAttempt(r)
+	if err != nil {
+		h.oauthFailed(w, r, "oauth_state", err)
+		return
+	}
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		h.oauthFailed(w, r, "oauth_denied", fmt.Errorf("provider error: %s", e))
+		return
+	}
+
+	if err := attempt.check(name, r.URL.Query().Get("state")); err != nil {
+		h.oauthFailed(w, r, "oauth_state", err)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		h.oauthFailed(w, r, "oauth_failed", fmt.Errorf("missing code"))
+		return
+	}
+
+	identity, err := provider.Exchange(ctx, code, attempt)
+	if err != nil {
+		h.oauthFailed(w, r, "oauth_failed", err)
+		return
+	}
+
+	if attempt.LinkUserID != 0 {
+		h.finishOAuthLink(w, r, attempt, identity)
+		return
+	}
+
+	user, err := h.Service.LoginWithIdentity(ctx, identity)
+	if err != nil {
+		h.oauthFailed(w, r, identityFailureReason(err), err)
+		return
+	}
+
+	pending, err := h.startSecondFactorIfEnabled(r, user.ID)
+	if err != nil {
+		h.oauthFailed(w, r, "oauth_failed", err)
+		return
+	}
+	if pending != "" {
+		if err := h.redirectToSecondFactor(w, r, pending); err != nil {
+			h.oauthFailed(w, r, "oauth_failed", err)
+		}
+		return
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, user.ID, false); err != nil {
+		h.oauthFailed(w, r, "oauth_failed", err)
+		return
+	}
+
+	http.Redirect(w, r, h.oauthReturnURL(attempt), http.StatusSeeOther)
+}
+
+// oauthReturnURL is where the browser goes once the flow succeeds.
+func (h *AuthHandler) oauthReturnURL(attempt *oauthAttempt) string {
+	if attempt.ReturnTo != "" {
+		return h.FrontendURL + attempt.ReturnTo
+	}
+	return h.OAuthSuccessURL
+}
+
+// takeOAuthAttempt loads and deletes the attempt bound to this browser.
+func (h *AuthHandler) takeOAuthAttempt(r *http.Request) (*oauthAttempt, error) {
+	raw, err := h.SessionManager.GetString(r, oauthAttemptKey)
+	if err != nil {
+		return nil, err
+	}
+	_ = h.SessionManager.Remove(r, oauthAttemptKey)
+
+	if raw == "" {
+		return nil, ErrOAuthStateMismatch
+	}
+
+	var attempt oauthAttempt
+	if err := json.Unmarshal([]byte(raw), &attempt); err != nil {
+		return nil, ErrOAuthStateMismatch
+	}
+	return &attempt, nil
+}
+
+// oauthFailed logs err and sends the browser to the SPA's login page with a
+// machine-readable reason it can render.
+func (h *AuthHandler) oauthFailed(w http.ResponseWriter, r *http.Request, reason string, err error) {
+	if h.Logger != nil {
+		h.Logger.Error("OAuth login failed", "reason", reason, "err", err)
+	}
+	http.Redirect(w, r, h.FrontendURL+"/login?error="+url.QueryEscape(reason), http.StatusSeeOther)
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIssuer is a minimal OpenID Connect provider: discovery, JWKS, a token
+// endpoint that enforces PKCE, and userinfo.
+type testIssuer struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	signer *rsa.PrivateKey // signs ID tokens; key unless a test swaps it
+
+	// Set from the consent URL, as the provider would remember them.
+	challenge string
+	nonce     string
+
+	claims   map[string]any // extra ID token claims
+	userinfo map[string]any
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{t: t, key: key, signer: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", iss.discovery)
+	mux.HandleFunc("/jwks", iss.jwks)
+	mux.HandleFunc("/token", iss.token)
+	mux.HandleFunc("/userinfo", iss.userInfo)
+	iss.srv = httptest.NewServer(mux)
+	t.Cleanup(iss.srv.Close)
+	return iss
+}
+
+func (iss *testIssuer) discovery(w http.ResponseWriter, _ *http.Request) {
+	base := iss.srv.URL
+	writeTestJSON(w, map[string]any{
+		"issuer":                                base,
+		"authorization_endpoint":                base + "/authorize",
+		"token_endpoint":                        base + "/token",
+		"userinfo_endpoint":                     base + "/userinfo",
+		"jwks_uri":                              base + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (iss *testIssuer) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeTestJSON(w, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(iss.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(iss.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (iss *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "good-code" {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != iss.challenge {
+		http.Error(w, `{"error":"invalid_grant","error_description":"PKCE verification failed"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := map[string]any{
+		"iss":   iss.srv.URL,
+		"aud":   "client",
+		"sub":   "subject-1",
+		"nonce": iss.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range iss.claims {
+		claims[k] = v
+	}
+
+	writeTestJSON(w, map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     iss.sign(claims),
+	})
+}
+
+func (iss *testIssuer) userInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer access" {
+		http.Error(w, "unauthorised", http.StatusUnauthorized)
+		return
+	}
+	info := map[string]any{"sub": "subject-1"}
+	for k, v := range iss.userinfo {
+		info[k] = v
+	}
+	writeTestJSON(w, info)
+}
+
+// sign returns an RS256 JWT over claims.
+func (iss *testIssuer) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	signing := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, iss.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeTestJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// begin starts an attempt and has the issuer remember the consent URL's
+// PKCE challenge and nonce.
+func (iss *testIssuer) begin(p *OAuthProvider) *oauthAttempt {
+	iss.t.Helper()
+	attempt, err := newOAuthAttempt(p.Name(), "/")
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	raw, err := p.AuthCodeURL(context.Background(), attempt)
+	if err != nil {
+		iss.t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		iss.t.Fatal(err)
+	}
+	iss.challenge = u.Query().Get("code_challenge")
+	iss.nonce = u.Query().Get("nonce")
+	return attempt
+}
+
+func (iss *testIssuer) provider() *OAuthProvider {
+	return NewOAuthProvider(ProviderConfig{
+		Name:        "test",
+		Issuer:      iss.srv.URL,
+		ClientID:    "client",
+		RedirectURL: "https://app.example.com/callback",
+	})
+}
+
+func TestOAuthAuthCodeURL(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+
+	attempt, err := newOAuthAttempt("test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := p.AuthCodeURL(context.Background(), attempt)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := u.Scheme + "://" + u.Host + u.Path; got != iss.srv.URL+"/authorize" {
+		t.Fatalf("authorize endpoint = %s, not the discovered one", got)
+	}
+	q := u.Query()
+	sum := sha256.Sum256([]byte(attempt.Verifier))
+	want := map[string]string{
+		"client_id":             "client",
+		"response_type":         "code",
+		"state":                 attempt.State,
+		"nonce":                 attempt.Nonce,
+		"code_challenge_method": "S256",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if !strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("scope = %q, want openid", q.Get("scope"))
+	}
+}
+
+func TestOAuthDiscoveryFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	p := NewOAuthProvider(ProviderConfig{Name: "down", Issuer: srv.URL, ClientID: "client"})
+	attempt, _ := newOAuthAttempt("down", "/")
+	if _, err := p.AuthCodeURL(context.Background(), attempt); err == nil {
+		t.Fatal("AuthCodeURL succeeded against an unreachable issuer")
+	}
+}
+
+func TestOAuthExchange(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.claims = map[string]any{"email": "Ada@Example.com", "email_verified": true}
+	iss.userinfo = map[string]any{"email": "ignored@example.com", "name": "Ada King Lovelace"}
+	p := iss.provider()
+
+	attempt := iss.begin(p)
+	id, err := p.Exchange(context.Background(), "good-code", attempt)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := ExternalIdentity{
+		Provider:      "test",
+		Subject:       "subject-1",
+		Email:         "ada@example.com", // ID token wins over userinfo
+		EmailVerified: true,
+		FirstName:     "Ada",
+		LastName:      "King Lovelace",
+	}
+	if *id != want {
+		t.Fatalf("identity = %+v, want %+v", *id, want)
+	}
+}
+
+func TestOAuthExchangeRejects(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(iss *testIssuer, a *oauthAttempt)
+		code    string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:    "bad id_token signature",
+			setup:   func(iss *testIssuer, _ *oauthAttempt) { iss.signer = otherKey },
+			wantMsg: "verify id_token",
+		},
+		{
+			name:    "nonce mismatch",
+			setup:   func(iss *testIssuer, _ *oauthAttempt) { iss.nonce = "replayed" },
+			wantErr: ErrOAuthNonceMismatch,
+		},
+		{
+			name:    "PKCE verifier mismatch",
+			setup:   func(_ *testIssuer, a *oauthAttempt) { a.Verifier = "not-the-verifier-used-for-the-challenge" },
+			wantMsg: "token exchange",
+		},
+		{
+			name:    "wrong audience",
+			setup:   func(iss *testIssuer, _ *oauthAttempt) { iss.claims = map[string]any{"aud": "someone-else"} },
+			wantMsg: "verify id_token",
+		},
+		{
+			name: "expired id_token",
+			setup: func(iss *testIssuer, _ *oauthAttempt) {
+				iss.claims = map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}
+			},
+			wantMsg: "verify id_token",
+		},
+		{
+			name:    "no email",
+			wantErr: ErrOAuthMissingEmail,
+		},
+		{
+			name:    "bad code",
+			code:    "stolen-code",
+			wantMsg: "token exchange",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newTestIssuer(t)
+			p := iss.provider()
+			attempt := iss.begin(p)
+			if tt.setup != nil {
+				tt.setup(iss, attempt)
+			}
+			code := tt.code
+			if code == "" {
+				code = "good-code"
+			}
+
+			id, err := p.Exchange(context.Background(), code, attempt)
+			if err == nil {
+				t.Fatalf("Exchange accepted it: %+v", id)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Fatalf("err = %v, want it to mention %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestOAuthAttemptCheck(t *testing.T) {
+	attempt, err := newOAuthAttempt("google", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := *attempt
+	expired.CreatedAt = time.Now().Add(-oauthAttemptTTL - time.Second)
+
+	tests := []struct {
+		name     string
+		attempt  *oauthAttempt
+		provider string
+		state    string
+		ok       bool
+	}{
+		{name: "match", attempt: attempt, provider: "google", state: attempt.State, ok: true},
+		{name: "wrong state", attempt: attempt, provider: "google", state: "forged"},
+		{name: "empty state", attempt: attempt, provider: "google"},
+		{name: "wrong provider", attempt: attempt, provider: "keycloak", state: attempt.State},
+		{name: "expired", attempt: &expired, provider: "google", state: attempt.State},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.attempt.check(tt.provider, tt.state)
+			if tt.ok && err != nil {
+				t.Fatalf("check: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrOAuthStateMismatch) {
+				t.Fatalf("err = %v, want ErrOAuthStateMismatch", err)
+			}
+		})
+	}
+}
+
+func TestNewOAuthAttemptIsUnique(t *testing.T) {
+	a, _ := newOAuthAttempt("google", "/")
+	b, _ := newOAuthAttempt("google", "/")
+	if a.State == b.State || a.Nonce == b.Nonce || a.Verifier == b.Verifier {
+		t.Fatal("attempts share state, nonce or verifier")
+	}
+}
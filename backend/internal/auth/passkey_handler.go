@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// Session data keys holding in-flight WebAuthn ceremony state.
+const (
+	passkeyRegistrationKey = "webauthn.registration"
+	passkeyLoginKey        = "webauthn.login"
+)
+
+// PasskeyRegisterBeginHandler returns PublicKeyCredentialCreationOptions for
+// navigator.credentials.create().
+func (h *AuthHandler) PasskeyRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	creation, state, err := h.Service.BeginPasskeyRegistration(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to start passkey registration")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if err := h.SessionManager.Put(w, r, passkeyRegistrationKey, state); err != nil {
+		errResp := errors.Internal("Failed to store passkey challenge")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Passkey registration started", creation)
+}
+
+// PasskeyRegisterFinishHandler verifies the authenticator response and saves
+// the passkey. The optional ?name= query labels it for the user.
+func (h *AuthHandler) PasskeyRegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	state, ok := h.takeCeremonyState(w, r, passkeyRegistrationKey)
+	if !ok {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponse(r)
+	if err != nil {
+		errResp := errors.BadRequest("Invalid passkey response")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	passkey, err := h.Service.FinishPasskeyRegistration(r.Context(), userID, state, r.URL.Query().Get("name"), parsed)
+	if err != nil {
+		h.writePasskeyError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "Passkey added", map[string]any{"passkey": passkey})
+}
+
+// PasskeyLoginBeginHandler returns PublicKeyCredentialRequestOptions for a
+// username-less login. An anonymous session holds the challenge.
+func (h *AuthHandler) PasskeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	assertion, state, err := h.Service.BeginPasskeyLogin(r.Context())
+	if err != nil {
+		errResp := errors.Internal("Failed to start passkey login")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if err := h.SessionManager.Put(w, r, passkeyLoginKey, state); err != nil {
+		errResp := errors.Internal("Failed to store passkey challenge")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Passkey login started", assertion)
+}
+
+// PasskeyLoginFinishHandler verifies the assertion and signs the user in,
+// ending in the same SetUserID call as the password login.
+func (h *AuthHandler) PasskeyLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	state, ok := h.takeCeremonyState(w, r, passkeyLoginKey)
+	if !ok {
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponse(r)
+	if err != nil {
+		errResp := errors.BadRequest("Invalid passkey response")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	user, err := h.Service.FinishPasskeyLogin(r.Context(), state, parsed)
+	if err != nil {
+		h.writePasskeyError(w, err)
+		return
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, user.ID, false); err != nil {
+		errResp := errors.Internal("Failed to set session")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Logged in", map[string]any{"user": user})
+}
+
+// ListPasskeysHandler lists the signed-in user's passkeys.
+func (h *AuthHandler) ListPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := h.Service.ListPasskeys(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to list passkeys")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Passkeys", map[string]any{"passkeys": list})
+}
+
+// RenamePasskeyHandler changes a passkey's display name.
+func (h *AuthHandler) RenamePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	passkeyID, ok := passkeyIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("name", input.Name)
+	v.Check("name", len(input.Name) <= 64, "Must be at most 64 characters")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	found, err := h.Service.RenamePasskey(r.Context(), userID, passkeyID, input.Name)
+	if err != nil {
+		errResp := errors.Internal("Failed to rename passkey")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("Passkey not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Passkey renamed", nil)
+}
+
+// DeletePasskeyHandler removes a passkey.
+func (h *AuthHandler) DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	passkeyID, ok := passkeyIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	found, err := h.Service.DeletePasskey(r.Context(), userID, passkeyID)
+	if stdErrors.Is(err, ErrLastLoginMethod) {
+		errResp := errors.Conflict("Add another way to sign in before removing this passkey").WithReason(ReasonLastLoginMethod)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to delete passkey")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("Passkey not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Passkey deleted", nil)
+}
+
+// takeCeremonyState reads and removes single-use ceremony state from the
+// session, writing a 400 when there is none.
+func (h *AuthHandler) takeCeremonyState(w http.ResponseWriter, r *http.Request, key string) (string, bool) {
+	state, err := h.SessionManager.GetString(r, key)
+	if err != nil {
+		errResp := errors.Internal("Failed to load passkey challenge")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return "", false
+	}
+	_ = h.SessionManager.Remove(r, key)
+
+	if state == "" {
+		errResp := errors.BadRequest("No passkey ceremony in progress")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return "", false
+	}
+	return state, true
+}
+
+func (h *AuthHandler) writePasskeyError(w http.ResponseWriter, err error) {
+	if stdErrors.Is(err, ErrAccountDisabled) {
+		writeAccountDisabled(w)
+		return
+	}
+
+	if stdErrors.Is(err, ErrPasskeyFailed) || stdErrors.Is(err, ErrPasskeyCloned) {
+		if h.Logger != nil {
+			h.Logger.Warn("Passkey verification failed", "err", err)
+		}
+		errResp := errors.Unauthorized("Passkey verification failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if h.Logger != nil {
+		h.Logger.Error("Passkey operation failed", "err", err)
+	}
+	errResp := errors.Internal("Passkey operation failed")
+	response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+}
+
+func passkeyIDParam(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "passkeyID"), 10, 32)
+	if err != nil || id <= 0 {
+		errResp := errors.BadRequest("Invalid passkey id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return 0, false
+	}
+	return int32(id), true
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/iankencruz/sabiflow/internal/platform/password"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// ForgotPasswordHandler starts the reset flow. It always answers the same
+// way so the endpoint cannot be used to discover registered emails.
+func (h *AuthHandler) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("email", input.Email)
+	v.MatchPattern("email", input.Email, validators.EmailRX, "Must be a valid email address")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	err := h.Service.RequestPasswordReset(r.Context(), input.Email, sessions.ClientIP(r))
+	var throttled *LoginThrottledError
+	switch {
+	case stdErrors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+		return
+	case err != nil && h.Logger != nil:
+		h.Logger.Error("Password reset request failed", "err", err)
+	}
+
+	response.WriteJSON(w, http.StatusOK,
+		"If an account exists for that email, a reset link has been sent", nil)
+}
+
+// ResetPasswordHandler sets a new password from a reset token and signs the
+// user out of every existing session.
+func (h *AuthHandler) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("token", input.Token)
+	validatePassword(v, "password", input.Password)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	userID, err := h.Service.ResetPassword(r.Context(), input.Token, input.Password)
+	if writeWeakPassword(w, "password", err) {
+		return
+	}
+	if stdErrors.Is(err, ErrInvalidToken) {
+		errResp := errors.BadRequest("Reset link is invalid or has expired")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to reset password")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if _, err := h.SessionManager.RevokeAll(r.Context(), userID); err != nil && h.Logger != nil {
+		h.Logger.Error("Failed to revoke sessions after password reset", "err", err, "user_id", userID)
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Password has been reset", nil)
+}
+
+// validatePassword checks a new password is present. The strength rules
+// live in the service's PasswordPolicy; see writeWeakPassword.
+func validatePassword(v *validators.Validator, field, password string) {
+	v.Require(field, password)
+}
+
+// writeWeakPassword reports a password policy failure as a validation error
+// on field, in the same shape as the handler's own checks. It returns false
+// when err is not a policy failure.
+func writeWeakPassword(w http.ResponseWriter, field string, err error) bool {
+	var weak *password.PolicyError
+	if !stdErrors.As(err, &weak) {
+		return false
+	}
+
+	errResp := errors.BadRequest("Validation failed")
+	response.WriteJSON(w, errResp.Code, errResp.Message, map[string]string{field: weak.Message})
+	return true
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/iankencruz/sabiflow/internal/platform/password"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/jackc/pgx/v5"
+)
+
+// resetRepo keeps one user and their reset tokens in memory.
+type resetRepo struct {
+	*memThrottle
+
+	mu         sync.Mutex
+	user       *User
+	resets     map[string]time.Time // token hash -> expiry
+	consumeErr error
+	createErr  error
+}
+
+func (r *resetRepo) GetByEmail(_ context.Context, email string) (*User, error) {
+	if !strings.EqualFold(email, r.user.Email) {
+		return nil, pgx.ErrNoRows
+	}
+	return r.user, nil
+}
+
+func (r *resetRepo) CreatePasswordReset(_ context.Context, _ int32, tokenHash string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.createErr != nil {
+		return r.createErr
+	}
+	r.resets[tokenHash] = expiresAt
+	return nil
+}
+
+func (r *resetRepo) ConsumePasswordReset(_ context.Context, tokenHash string) (int32, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.consumeErr != nil {
+		return 0, r.consumeErr
+	}
+	expiresAt, ok := r.resets[tokenHash]
+	if !ok || !expiresAt.After(time.Now()) {
+		return 0, pgx.ErrNoRows
+	}
+	delete(r.resets, tokenHash)
+	return r.user.ID, nil
+}
+
+func (r *resetRepo) UpdatePassword(_ context.Context, _ int32, hashed string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.user.Password = hashed
+	return nil
+}
+
+func newResetHandler() (*AuthHandler, *resetRepo, *mail.MemorySender) {
+	repo := &resetRepo{
+		memThrottle: newMemThrottle(),
+		user:        &User{ID: 1, FirstName: "Ada", Email: "ada@example.com"},
+		resets:      map[string]time.Time{},
+	}
+	mailer := mail.NewMemorySender()
+	svc := &AuthServiceImpl{
+		Repo:             repo,
+		Mailer:           mailer,
+		FrontendURL:      "https://app.example.com",
+		PasswordResetTTL: time.Hour,
+		PasswordResetLimits: RequestLimits{
+			MaxPerAccount: 2,
+			MaxPerIP:      4,
+			Window:        time.Hour,
+		},
+		Passwords: password.NewArgon2id(password.Params{Memory: 1024, Iterations: 1, Parallelism: 1}),
+	}
+	h := &AuthHandler{
+		Service:        svc,
+		SessionManager: sessions.NewManager(sessions.NewMemoryStore(), sessions.Config{}),
+	}
+	return h, repo, mailer
+}
+
+func postJSON(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// waitForMail waits for the background sender to deliver a message to to.
+func waitForMail(t *testing.T, mailer *mail.MemorySender, to string) mail.Message {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if msg, ok := mailer.Last(to); ok {
+			return msg
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no mail sent to %s", to)
+	return mail.Message{}
+}
+
+// resetToken extracts the token from the link in a reset email.
+func resetToken(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	for _, field := range strings.Fields(msg.Body) {
+		if u, err := url.Parse(field); err == nil && u.Path == "/reset-password" {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatalf("no reset link in %q", msg.Body)
+	return ""
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	h, repo, mailer := newResetHandler()
+
+	w := postJSON(h.ForgotPasswordHandler, `{"email":"ada@example.com"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("forgot: status = %d, want 200", w.Code)
+	}
+	token := resetToken(t, waitForMail(t, mailer, "ada@example.com"))
+
+	w = postJSON(h.ResetPasswordHandler, `{"token":"`+token+`","password":"correct horse battery"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("reset: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	ok, _, err := h.Service.(*AuthServiceImpl).Passwords.Verify(repo.user.Password, "correct horse battery")
+	if err != nil || !ok {
+		t.Fatalf("new password not stored: %t, %v", ok, err)
+	}
+
+	// The link is single-use.
+	w = postJSON(h.ResetPasswordHandler, `{"token":"`+token+`","password":"another password"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("reused token: status = %d, want 400", w.Code)
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	h, _, mailer := newResetHandler()
+
+	known := postJSON(h.ForgotPasswordHandler, `{"email":"ada@example.com"}`)
+	unknown := postJSON(h.ForgotPasswordHandler, `{"email":"nobody@example.com"}`)
+
+	if unknown.Code != known.Code || unknown.Body.String() != known.Body.String() {
+		t.Fatalf("unknown email answered %d %s, known %d %s",
+			unknown.Code, unknown.Body, known.Code, known.Body)
+	}
+
+	waitForMail(t, mailer, "ada@example.com")
+	if _, ok := mailer.Last("nobody@example.com"); ok {
+		t.Fatal("mail sent to an unknown address")
+	}
+}
+
+func TestResetPasswordErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		consumeErr error
+		want       int
+	}{
+		{name: "unknown token", want: http.StatusBadRequest},
+		{name: "database failure", consumeErr: errors.New("connection reset"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, repo, _ := newResetHandler()
+			repo.consumeErr = tt.consumeErr
+
+			w := postJSON(h.ResetPasswordHandler, `{"token":"nope","password":"correct horse battery"}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgotPasswordLimits(t *testing.T) {
+	h, _, mailer := newResetHandler()
+	svc := h.Service.(*AuthServiceImpl)
+
+	// MaxPerAccount is 2: the third request for the address answers the
+	// same but sends nothing.
+	for i := range 3 {
+		if w := postJSON(h.ForgotPasswordHandler, `{"email":"Ada@example.com"}`); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i+1, w.Code)
+		}
+	}
+	svc.Wait()
+	if n := len(mailer.Messages()); n != 2 {
+		t.Fatalf("%d emails sent, want 2", n)
+	}
+
+	// MaxPerIP is 4: the fifth request from the client is refused.
+	if w := postJSON(h.ForgotPasswordHandler, `{"email":"nobody@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("fourth request: status = %d, want 200", w.Code)
+	}
+	w := postJSON(h.ForgotPasswordHandler, `{"email":"nobody@example.com"}`)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("fifth request: status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Fatal("no Retry-After header")
+	}
+}
+
+func TestPasswordResetFailureLogged(t *testing.T) {
+	h, repo, mailer := newResetHandler()
+	repo.createErr = errors.New("connection reset")
+
+	var logs strings.Builder
+	svc := h.Service.(*AuthServiceImpl)
+	svc.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	if w := postJSON(h.ForgotPasswordHandler, `{"email":"ada@example.com"}`); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	svc.Wait()
+
+	if !strings.Contains(logs.String(), "connection reset") {
+		t.Fatalf("failure not logged: %q", logs.String())
+	}
+	if len(mailer.Messages()) != 0 {
+		t.Fatal("mail sent without a stored token")
+	}
+}
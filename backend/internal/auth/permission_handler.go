@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// ReasonSystemGroup tells the SPA that a system group (Admin) was protected.
+const ReasonSystemGroup = "system_group"
+
+// AdminListPermissionsHandler returns the read-only permission catalogue.
+func (h *AuthHandler) AdminListPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	perms, err := h.Service.ListPermissions(r.Context())
+	if err != nil {
+		errResp := errors.Internal("Failed to list permissions")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Permissions", map[string]any{"permissions": perms})
+}
+
+// AdminListGroupsHandler returns every permission group with its codes.
+func (h *AuthHandler) AdminListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.Service.ListPermissionGroups(r.Context())
+	if err != nil {
+		errResp := errors.Internal("Failed to list groups")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Groups", map[string]any{"groups": groups})
+}
+
+// AdminGetGroupHandler returns one permission group.
+func (h *AuthHandler) AdminGetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	group, err := h.Service.GetPermissionGroup(r.Context(), groupID)
+	if err != nil {
+		h.writePermissionError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Group", map[string]any{"group": group})
+}
+
+// AdminCreateGroupHandler creates a custom group, e.g. "Bookkeeper".
+func (h *AuthHandler) AdminCreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("name", input.Name)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	group, err := h.Service.CreatePermissionGroup(r.Context(), input.Name, input.Description, input.Permissions)
+	if err != nil {
+		h.writePermissionError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "Group created", map[string]any{"group": group})
+}
+
+// AdminUpdateGroupHandler renames a group or edits its description.
+func (h *AuthHandler) AdminUpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("name", input.Name)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	group, err := h.Service.UpdatePermissionGroup(r.Context(), groupID, input.Name, input.Description)
+	if err != nil {
+		h.writePermissionError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Group updated", map[string]any{"group": group})
+}
+
+// AdminSetGroupPermissionsHandler replaces a group's permission codes.
+func (h *AuthHandler) AdminSetGroupPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	group, err := h.Service.SetGroupPermissions(r.Context(), groupID, input.Permissions)
+	if err != nil {
+		h.writePermissionError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Group permissions updated", map[string]any{"group": group})
+}
+
+// AdminDeleteGroupHandler deletes a custom group that has no members.
+func (h *AuthHandler) AdminDeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DeletePermissionGroup(r.Context(), groupID); err != nil {
+		h.writePermissionError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Group deleted", nil)
+}
+
+func (h *AuthHandler) writePermissionError(w http.ResponseWriter, err error) {
+	switch {
+	case stdErrors.Is(err, ErrGroupNotFound):
+		errResp := errors.NotFound("Group not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrUnknownPermission):
+		errResp := errors.BadRequest(err.Error())
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrGroupNameTaken), stdErrors.Is(err, ErrGroupInUse):
+		errResp := errors.Conflict(err.Error())
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrSystemGroup):
+		errResp := errors.Forbidden("The Admin group cannot be renamed, deleted or have permissions removed").WithReason(ReasonSystemGroup)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	default:
+		if h.Logger != nil {
+			h.Logger.Error("Permission group operation failed", "err", err)
+		}
+		errResp := errors.Internal("Permission group operation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	}
+}
+
+// groupIDParam reads the {groupID} URL parameter, writing a 400 and
+// returning false when it is not a valid ID.
+func groupIDParam(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "groupID"), 10, 32)
+	if err != nil || id <= 0 {
+		errResp := errors.BadRequest("Invalid group id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return 0, false
+	}
+	return int32(id), true
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// PermissionRepository manages auth.permissions, auth.permission_groups and
+// the auth.group_permissions mapping between them. Permissions are global;
+// groups belong to a studio and are read and written in the active one.
+type PermissionRepository interface {
+	UpsertPermissions(ctx context.Context, defs []PermissionDef) error
+	GrantAllToSystemGroups(ctx context.Context) error
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error)
+	GetPermissionGroup(ctx context.Context, groupID int32) (*PermissionGroup, error)
+	CreatePermissionGroup(ctx context.Context, name, description string) (int32, error)
+	UpdatePermissionGroup(ctx context.Context, groupID int32, name, description string) error
+	SetGroupPermissions(ctx context.Context, groupID int32, codes []string) error
+	DeletePermissionGroup(ctx context.Context, groupID int32) error
+}
+
+// Permission is an entry in the permission catalogue.
+type Permission struct {
+	ID          int32  `json:"id"`
+	Code        string `json:"code"`
+	Description string `json:"description"`
+	// Registered is true when the running code declared this permission
+	// through RegisterPermissions.
+	Registered bool `json:"registered"`
+}
+
+// PermissionGroup is a role studio members are assigned to.
+type PermissionGroup struct {
+	ID          int32    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	System      bool     `json:"system"`
+	Require2FA  bool     `json:"require2fa"`
+	Permissions []string `json:"permissions"`
+	Members     int64    `json:"members"`
+}
+
+const permissionGroupColumns = `
+	pg.id, pg.name, COALESCE(pg.description, ''), pg.is_system, pg.require_2fa,
+	COALESCE((
+		SELECT array_agg(p.code ORDER BY p.code)
+		FROM auth.group_permissions gp
+		JOIN auth.permissions p ON p.id = gp.permission_id
+		WHERE gp.group_id = pg.id
+	), '{}'),
+	(SELECT count(*) FROM auth.studio_members m WHERE m.group_id = pg.id)
+`
+
+func scanPermissionGroup(row pgx.Row) (*PermissionGroup, error) {
+	var g PermissionGroup
+	err := row.Scan(&g.ID, &g.Name, &g.Description, &g.System, &g.Require2FA, &g.Permissions, &g.Members)
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// UpsertPermissions inserts registered codes and refreshes descriptions.
+// Codes that are no longer registered are kept, as groups may still use them.
+func (r *PgxUserRepository) UpsertPermissions(ctx context.Context, defs []PermissionDef) error {
+	codes := make([]string, len(defs))
+	descriptions := make([]string, len(defs))
+	for i, d := range defs {
+		codes[i] = d.Code
+		descriptions[i] = d.Description
+	}
+
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO auth.permissions (code, description)
+		SELECT * FROM unnest(@codes::text[], @descriptions::text[])
+		ON CONFLICT (code) DO UPDATE SET description = EXCLUDED.description
+	`, pgx.NamedArgs{"codes": codes, "descriptions": descriptions})
+	return err
+}
+
+// GrantAllToSystemGroups makes sure system groups hold every permission,
+// including ones registered since the last start.
+func (r *PgxUserRepository) GrantAllToSystemGroups(ctx context.Context) error {
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO auth.group_permissions (group_id, permission_id)
+		SELECT pg.id, p.id
+		FROM auth.permission_groups pg, auth.permissions p
+		WHERE pg.is_system
+		ON CONFLICT DO NOTHING
+	`)
+	return err
+}
+
+func (r *PgxUserRepository) ListPermissions(ctx context.Context) ([]Permission, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id, code, COALESCE(description, '')
+		FROM auth.permissions
+		ORDER BY code
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.ID, &p.Code, &p.Description); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func (r *PgxUserRepository) ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error) {
+	args := pgx.NamedArgs{}
+	scope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+permissionGroupColumns+`
+		FROM auth.permission_groups pg
+		WHERE `+scope+`
+		ORDER BY pg.is_system DESC, pg.name
+	`, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []PermissionGroup{}
+	for rows.Next() {
+		g, err := scanPermissionGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *g)
+	}
+	return list, rows.Err()
+}
+
+func (r *PgxUserRepository) GetPermissionGroup(ctx context.Context, groupID int32) (*PermissionGroup, error) {
+	args := pgx.NamedArgs{"id": groupID}
+	scope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT ` + permissionGroupColumns + ` FROM auth.permission_groups pg WHERE pg.id = @id AND ` + scope
+	return scanPermissionGroup(r.DB.QueryRow(ctx, query, args))
+}
+
+func (r *PgxUserRepository) CreatePermissionGroup(ctx context.Context, name, description string) (int32, error) {
+	args := pgx.NamedArgs{"name": name, "description": description}
+	if err := tenant.Bind(ctx, args); err != nil {
+		return 0, err
+	}
+
+	var id int32
+	err := r.DB.QueryRow(ctx, `
+		INSERT INTO auth.permission_groups (studio_id, name, description)
+		VALUES (@`+tenant.Arg+`, @name, @description)
+		RETURNING id
+	`, args).Scan(&id)
+	return id, err
+}
+
+func (r *PgxUserRepository) UpdatePermissionGroup(ctx context.Context, groupID int32, name, description string) error {
+	args := pgx.NamedArgs{"id": groupID, "name": name, "description": description}
+	scope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec(ctx, `
+		UPDATE auth.permission_groups pg
+		SET name = @name, description = @description
+		WHERE pg.id = @id AND `+scope, args)
+	return err
+}
+
+// SetGroupPermissions replaces the group's permissions with codes in a
+// single statement, so readers never see a half-updated group.
+func (r *PgxUserRepository) SetGroupPermissions(ctx context.Context, groupID int32, codes []string) error {
+	_, err := r.DB.Exec(ctx, `
+		WITH wanted AS (
+			SELECT id FROM auth.permissions WHERE code = ANY(@codes)
+		), removed AS (
+			DELETE FROM auth.group_permissions
+			WHERE group_id = @group_id AND permission_id NOT IN (SELECT id FROM wanted)
+		)
+		INSERT INTO auth.group_permissions (group_id, permission_id)
+		SELECT @group_id, id FROM wanted
+		ON CONFLICT DO NOTHING
+	`, pgx.NamedArgs{"group_id": groupID, "codes": codes})
+	return err
+}
+
+func (r *PgxUserRepository) DeletePermissionGroup(ctx context.Context, groupID int32) error {
+	args := pgx.NamedArgs{"id": groupID}
+	scope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec(ctx, `DELETE FROM auth.permission_groups pg WHERE pg.id = @id AND `+scope, args)
+	return err
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrGroupNameTaken    = errors.New("a permission group with this name already exists")
+	ErrSystemGroup       = errors.New("system permission groups cannot be changed this way")
+	ErrGroupInUse        = errors.New("permission group still has members")
+	ErrUnknownPermission = errors.New("unknown permission code")
+)
+
+// SyncPermissions writes every registered permission to the catalogue and
+// grants them all to system groups. Run it once at startup.
+func (s *AuthServiceImpl) SyncPermissions(ctx context.Context) error {
+	if err := s.Repo.UpsertPermissions(ctx, RegisteredPermissions()); err != nil {
+		return fmt.Errorf("sync permissions: %w", err)
+	}
+	if err := s.Repo.GrantAllToSystemGroups(ctx); err != nil {
+		return fmt.Errorf("grant system groups: %w", err)
+	}
+	s.Principals.Reset()
+	return nil
+}
+
+// ListPermissions returns the catalogue, flagging which codes the running
+// code registered.
+func (s *AuthServiceImpl) ListPermissions(ctx context.Context) ([]Permission, error) {
+	list, err := s.Repo.ListPermissions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	registered := map[string]bool{}
+	for _, d := range RegisteredPermissions() {
+		registered[d.Code] = true
+	}
+	for i := range list {
+		list[i].Registered = registered[list[i].Code]
+	}
+	return list, nil
+}
+
+func (s *AuthServiceImpl) ListPermissionGroups(ctx context.Context) ([]PermissionGroup, error) {
+	return s.Repo.ListPermissionGroups(ctx)
+}
+
+func (s *AuthServiceImpl) GetPermissionGroup(ctx context.Context, groupID int32) (*PermissionGroup, error) {
+	group, err := s.Repo.GetPermissionGroup(ctx, groupID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGroupNotFound
+	}
+	return group, err
+}
+
+// CreatePermissionGroup adds a custom group holding codes.
+func (s *AuthServiceImpl) CreatePermissionGroup(ctx context.Context, name, description string, codes []string) (*PermissionGroup, error) {
+	if err := s.checkPermissionCodes(ctx, codes); err != nil {
+		return nil, err
+	}
+
+	id, err := s.Repo.CreatePermissionGroup(ctx, strings.TrimSpace(name), description)
+	if isUniqueViolation(err) {
+		return nil, ErrGroupNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Repo.SetGroupPermissions(ctx, id, codes); err != nil {
+		return nil, err
+	}
+	return s.GetPermissionGroup(ctx, id)
+}
+
+// UpdatePermissionGroup renames a group or changes its description. System
+// groups keep their name, since code and migrations refer to it.
+func (s *AuthServiceImpl) UpdatePermissionGroup(ctx context.Context, groupID int32, name, description string) (*PermissionGroup, error) {
+	group, err := s.GetPermissionGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if group.System && name != group.Name {
+		return nil, ErrSystemGroup
+	}
+
+	err = s.Repo.UpdatePermissionGroup(ctx, groupID, name, description)
+	if isUniqueViolation(err) {
+		return nil, ErrGroupNameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Principals.Reset()
+	return s.GetPermissionGroup(ctx, groupID)
+}
+
+// SetGroupPermissions replaces a group's permissions. System groups always
+// hold every permission so that nobody can edit Admin into a lockout.
+func (s *AuthServiceImpl) SetGroupPermissions(ctx context.Context, groupID int32, codes []string) (*PermissionGroup, error) {
+	group, err := s.GetPermissionGroup(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if group.System {
+		return nil, ErrSystemGroup
+	}
+
+	if err := s.checkPermissionCodes(ctx, codes); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.SetGroupPermissions(ctx, groupID, codes); err != nil {
+		return nil, err
+	}
+	s.Principals.Reset()
+	return s.GetPermissionGroup(ctx, groupID)
+}
+
+// DeletePermissionGroup removes an empty, non-system group.
+func (s *AuthServiceImpl) DeletePermissionGroup(ctx context.Context, groupID int32) error {
+	group, err := s.GetPermissionGroup(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if group.System {
+		return ErrSystemGroup
+	}
+	if group.Members > 0 {
+		return ErrGroupInUse
+	}
+	if err := s.Repo.DeletePermissionGroup(ctx, groupID); err != nil {
+		return err
+	}
+	s.Principals.Reset()
+	return nil
+}
+
+// checkPermissionCodes returns ErrUnknownPermission for any code missing
+// from the catalogue.
+func (s *AuthServiceImpl) checkPermissionCodes(ctx context.Context, codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	catalogue, err := s.Repo.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{}
+	for _, p := range catalogue {
+		known[p.Code] = true
+	}
+	for _, code := range codes {
+		if !known[code] {
+			return fmt.Errorf("%w: %q", ErrUnknownPermission, code)
+		}
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
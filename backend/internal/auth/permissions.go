@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"sort"
+	"sync"
+)
+
+// PermissionDef declares a permission code that some module checks with
+// mw.Can and friends.
+type PermissionDef struct {
+	Code        string
+	Description string
+}
+
+var permissionRegistry = struct {
+	sync.Mutex
+	defs map[string]PermissionDef
+}{defs: map[string]PermissionDef{}}
+
+// RegisterPermissions declares permission codes owned by a module. Call it
+// from an init function or during startup; AuthService.SyncPermissions then
+// writes them to auth.permissions so the catalogue matches the code.
+func RegisterPermissions(defs ...PermissionDef) {
+	permissionRegistry.Lock()
+	defer permissionRegistry.Unlock()
+
+	for _, d := range defs {
+		permissionRegistry.defs[d.Code] = d
+	}
+}
+
+// RegisteredPermissions returns every registered definition sorted by code.
+func RegisteredPermissions() []PermissionDef {
+	permissionRegistry.Lock()
+	defer permissionRegistry.Unlock()
+
+	defs := make([]PermissionDef, 0, len(permissionRegistry.defs))
+	for _, d := range permissionRegistry.defs {
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Code < defs[j].Code })
+	return defs
+}
+
+func init() {
+	RegisterPermissions(
+		PermissionDef{Code: "users.manage", Description: "Manage users"},
+		PermissionDef{Code: "users.invite", Description: "Invite users"},
+		PermissionDef{Code: "studios.create", Description: "Create studios"},
+	)
+}
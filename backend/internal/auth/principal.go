@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/jackc/pgx/v5"
+)
+
+// PrincipalCache keeps recently loaded principals in memory for a short
+// TTL so permission checks do not hit the database on every request. The
+// service drops entries whenever group membership or group permissions
+// change; the TTL bounds staleness for changes made outside this process.
+// A nil *PrincipalCache disables caching.
+type PrincipalCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[principalCacheKey]principalEntry
+}
+
+// principalCacheKey separates a user's principals per requested studio
+// ("" for their default).
+type principalCacheKey struct {
+	userID int32
+	studio string
+}
+
+type principalEntry struct {
+	principal *middleware.Principal
+	expires   time.Time
+}
+
+func NewPrincipalCache(ttl time.Duration) *PrincipalCache {
+	return &PrincipalCache{ttl: ttl, entries: map[principalCacheKey]principalEntry{}}
+}
+
+func (c *PrincipalCache) get(key principalCacheKey) (*middleware.Principal, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.principal, true
+}
+
+func (c *PrincipalCache) put(key principalCacheKey, p *middleware.Principal) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = principalEntry{principal: p, expires: time.Now().Add(c.ttl)}
+}
+
+// Forget drops one user's cached principals in every studio.
+func (c *PrincipalCache) Forget(userID int32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if key.userID == userID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Reset drops every cached principal, e.g. after a group's permissions change.
+func (c *PrincipalCache) Reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[principalCacheKey]principalEntry{}
+}
+
+// LoadPrincipal implements middleware.AuthStore. Deleted and disabled users
+// yield nil so RequireAuth rejects them. The principal carries the user's
+// membership in the studio the request asked for, or in their default
+// studio.
+func (s *AuthServiceImpl) LoadPrincipal(ctx context.Context, userID int32) (*middleware.Principal, error) {
+	key := principalCacheKey{userID: userID, studio: requestedStudio(ctx)}
+	if p, ok := s.Principals.get(key); ok {
+		return p, nil
+	}
+
+	user, err := s.Repo.GetByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled() {
+		return nil, nil
+	}
+
+	m, perms, err := s.activeMembership(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &middleware.Principal{
+		UserID:      user.ID,
+		Permissions: perms,
+	}
+	if m != nil {
+		p.Studio = &m.Studio
+		p.GroupID = m.GroupID
+		if m.Group != nil {
+			p.Group = *m.Group
+		}
+	}
+
+	s.Principals.put(key, p)
+	return p, nil
+}
+
+// IsEmailVerified implements middleware.AuthStore.
+func (s *AuthServiceImpl) IsEmailVerified(ctx context.Context, userID int32) (bool, error) {
+	return s.Repo.IsEmailVerified(ctx, userID)
+}
+
+// TwoFactorStatus implements middleware.AuthStore.
+func (s *AuthServiceImpl) TwoFactorStatus(ctx context.Context, userID int32) (enabled, required bool, err error) {
+	return s.Repo.TwoFactorStatus(ctx, userID)
+}
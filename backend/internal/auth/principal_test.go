@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+)
+
+func TestPrincipalCacheTTL(t *testing.T) {
+	c := NewPrincipalCache(20 * time.Millisecond)
+	key := principalCacheKey{userID: 1}
+	p := &middleware.Principal{UserID: 1}
+
+	c.put(key, p)
+	if got, ok := c.get(key); !ok || got != p {
+		t.Fatalf("get = %v, %t; want cached principal", got, ok)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.get(key); ok {
+		t.Fatal("entry survived its TTL")
+	}
+}
+
+func TestPrincipalCacheDisabled(t *testing.T) {
+	key := principalCacheKey{userID: 1}
+
+	zero := NewPrincipalCache(0)
+	zero.put(key, &middleware.Principal{UserID: 1})
+	if _, ok := zero.get(key); ok {
+		t.Fatal("zero TTL cached an entry")
+	}
+
+	var none *PrincipalCache
+	none.put(key, &middleware.Principal{UserID: 1})
+	if _, ok := none.get(key); ok {
+		t.Fatal("nil cache returned an entry")
+	}
+	none.Forget(1)
+	none.Reset()
+}
+
+func TestPrincipalCacheForget(t *testing.T) {
+	c := NewPrincipalCache(time.Minute)
+	keys := []principalCacheKey{
+		{userID: 1},
+		{userID: 1, studio: "acme"},
+		{userID: 2},
+	}
+	for _, k := range keys {
+		c.put(k, &middleware.Principal{UserID: k.userID})
+	}
+
+	c.Forget(1)
+
+	for _, k := range keys {
+		_, ok := c.get(k)
+		if want := k.userID != 1; ok != want {
+			t.Errorf("get(%+v) cached = %t, want %t", k, ok, want)
+		}
+	}
+}
+
+func TestPrincipalCacheReset(t *testing.T) {
+	c := NewPrincipalCache(time.Minute)
+	keys := []principalCacheKey{{userID: 1}, {userID: 2, studio: "acme"}}
+	for _, k := range keys {
+		c.put(k, &middleware.Principal{UserID: k.userID})
+	}
+
+	c.Reset()
+
+	for _, k := range keys {
+		if _, ok := c.get(k); ok {
+			t.Errorf("get(%+v) survived Reset", k)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+)
+
+// RequestDataExportHandler starts an archive of the signed-in user's
+// personal data; they are emailed when it can be downloaded.
+func (h *AuthHandler) RequestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := h.Service.RequestDataExport(r.Context(), userID, userID)
+	if err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusAccepted, "Data export started", map[string]any{"export": export})
+}
+
+// ListDataExportsHandler lists the signed-in user's data exports.
+func (h *AuthHandler) ListDataExportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	exports, err := h.Service.ListDataExports(r.Context(), userID)
+	if err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Data exports", map[string]any{"exports": exports})
+}
+
+// DownloadDataExportHandler sends one of the signed-in user's archives.
+func (h *AuthHandler) DownloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	exportID, ok := exportIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	archive, err := h.Service.DataExportArchive(r.Context(), userID, exportID)
+	if err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	writeArchive(w, exportID, archive)
+}
+
+// EraseAccountHandler erases the signed-in user's account after they
+// re-enter {"password": "..."}, then signs them out.
+func (h *AuthHandler) EraseAccountHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if err := h.Service.EraseAccount(r.Context(), userID, h.reauth(r, input.Password)); err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	if err := h.SessionManager.Clear(w, r); err != nil && h.Logger != nil {
+		h.Logger.Error("Failed to clear session after erasure", "err", err, "user_id", userID)
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Account erased", nil)
+}
+
+// AdminRequestDataExportHandler starts an archive of a member's personal
+// data, e.g. to answer an access request received by email.
+func (h *AuthHandler) AdminRequestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := middleware.PrincipalFrom(r.Context())
+	if !ok {
+		errResp := errors.Unauthorized("unauthorised")
+		response.WriteJSON(w, errResp.Code, errResp.Message, nil)
+		return
+	}
+
+	export, err := h.Service.RequestDataExport(r.Context(), userID, p.UserID)
+	if err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusAccepted, "Data export started", map[string]any{"export": export})
+}
+
+// AdminListDataExportsHandler lists a member's data exports.
+func (h *AuthHandler) AdminListDataExportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	exports, err := h.Service.UserDataExports(r.Context(), userID)
+	if err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Data exports", map[string]any{"exports": exports})
+}
+
+// AdminDownloadDataExportHandler sends one of a member's archives.
+func (h *AuthHandler) AdminDownloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	exportID, ok := exportIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	archive, err := h.Service.UserDataExportArchive(r.Context(), userID, exportID)
+	if err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	writeArchive(w, exportID, archive)
+}
+
+// AdminEraseUserHandler erases a member's account and personal data,
+// keeping records that must be retained in anonymised form.
+func (h *AuthHandler) AdminEraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.EraseUser(r.Context(), userID); err != nil {
+		h.writePrivacyError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User erased", nil)
+}
+
+func exportIDParam(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "exportID"), 10, 32)
+	if err != nil || id <= 0 {
+		errResp := errors.BadRequest("Invalid export id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return 0, false
+	}
+	return int32(id), true
+}
+
+// writeArchive sends a data export as a ZIP download.
+func writeArchive(w http.ResponseWriter, exportID int32, archive []byte) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sabiflow-data-export-%d.zip"`, exportID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(archive)
+}
+
+func (h *AuthHandler) writePrivacyError(w http.ResponseWriter, err error) {
+	var throttled *LoginThrottledError
+	switch {
+	case stdErrors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+	case stdErrors.Is(err, ErrExportInProgress):
+		errResp := errors.Conflict("A data export is already being prepared")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrExportNotFound):
+		errResp := errors.NotFound("Data export not found or expired")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrWrongPassword):
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, map[string]string{"password": "Password is incorrect"})
+	case stdErrors.Is(err, ErrReauthRequired):
+		writeReauthRequired(w)
+	default:
+		h.writeUserAdminError(w, err)
+	}
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/privacy"
+	"github.com/jackc/pgx/v5"
+)
+
+// PrivacyRepository keeps data-export archives in auth.data_exports and
+// reads and erases the auth module's share of a person's data.
+type PrivacyRepository interface {
+	CreateDataExport(ctx context.Context, userID, requestedBy int32, staleAfter time.Time) (*DataExport, error)
+	CompleteDataExport(ctx context.Context, exportID int32, archive []byte, expiresAt time.Time) error
+	FailDataExport(ctx context.Context, exportID int32) error
+	ListDataExports(ctx context.Context, userID int32) ([]DataExport, error)
+	GetDataExportArchive(ctx context.Context, userID, exportID int32) ([]byte, error)
+
+	ExportSessions(ctx context.Context, userID int32) (privacy.Table, error)
+	ExportIdentities(ctx context.Context, userID int32) (privacy.Table, error)
+	ExportPasskeys(ctx context.Context, userID int32) (privacy.Table, error)
+	ExportAPITokens(ctx context.Context, userID int32) (privacy.Table, error)
+	ExportAuditLog(ctx context.Context, userID int32) (privacy.Table, error)
+
+	CountSoleAdminStudios(ctx context.Context, userID int32) (int64, error)
+	EraseAccount(ctx context.Context, userID int32) (bool, error)
+}
+
+// Data export states.
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+	// DataExportExpired is reported for ready exports past ExpiresAt,
+	// whose archive can no longer be downloaded.
+	DataExportExpired = "expired"
+)
+
+// DataExport is one requested archive of a user's personal data.
+type DataExport struct {
+	ID     int32 `json:"id"`
+	UserID int32 `json:"userId"`
+	// RequestedBy is the user who asked for it: the user themselves or an
+	// administrator.
+	RequestedBy *int32     `json:"requestedBy"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+const dataExportColumns = `id, user_id, requested_by,
+	CASE WHEN status = 'ready' AND expires_at <= now() THEN 'expired' ELSE status END,
+	created_at, completed_at, expires_at`
+
+func scanDataExport(row pgx.Row) (*DataExport, error) {
+	var e DataExport
+	if err := row.Scan(&e.ID, &e.UserID, &e.RequestedBy, &e.Status, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// CreateDataExport records a pending export. It returns pgx.ErrNoRows while
+// another export for the user has been pending since after staleAfter.
+// Archives that have expired are dropped on the way.
+func (r *PgxUserRepository) CreateDataExport(ctx context.Context, userID, requestedBy int32, staleAfter time.Time) (*DataExport, error) {
+	query := `
+		WITH expired AS (
+			UPDATE auth.data_exports
+			SET archive = NULL
+			WHERE user_id = @user_id AND expires_at <= now() AND archive IS NOT NULL
+		)
+		INSERT INTO auth.data_exports (user_id, requested_by)
+		SELECT @user_id, @requested_by
+		WHERE NOT EXISTS (
+			SELECT 1 FROM auth.data_exports
+			WHERE user_id = @user_id AND status = 'pending' AND created_at > @stale_after
+		)
+		RETURNING ` + dataExportColumns
+
+	args := pgx.NamedArgs{
+		"user_id":      userID,
+		"requested_by": requestedBy,
+		"stale_after":  staleAfter,
+	}
+
+	return scanDataExport(r.DB.QueryRow(ctx, query, args))
+}
+
+func (r *PgxUserRepository) CompleteDataExport(ctx context.Context, exportID int32, archive []byte, expiresAt time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.data_exports
+		SET status = 'ready', archive = @archive, completed_at = now(), expires_at = @expires_at
+		WHERE id = @id
+	`, pgx.NamedArgs{"id": exportID, "archive": archive, "expires_at": expiresAt})
+	return err
+}
+
+func (r *PgxUserRepository) FailDataExport(ctx context.Context, exportID int32) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.data_exports SET status = 'failed', completed_at = now() WHERE id = @id
+	`, pgx.NamedArgs{"id": exportID})
+	return err
+}
+
+func (r *PgxUserRepository) ListDataExports(ctx context.Context, userID int32) ([]DataExport, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+dataExportColumns+`
+		FROM auth.data_exports
+		WHERE user_id = @user_id
+		ORDER BY created_at DESC
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []DataExport{}
+	for rows.Next() {
+		e, err := scanDataExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
+	}
+	return list, rows.Err()
+}
+
+// GetDataExportArchive returns the archive of a ready, unexpired export
+// belonging to userID; pgx.ErrNoRows otherwise.
+func (r *PgxUserRepository) GetDataExportArchive(ctx context.Context, userID, exportID int32) ([]byte, error) {
+	var archive []byte
+	err := r.DB.QueryRow(ctx, `
+		SELECT archive FROM auth.data_exports
+		WHERE id = @id AND user_id = @user_id
+		  AND status = 'ready' AND expires_at > now() AND archive IS NOT NULL
+	`, pgx.NamedArgs{"id": exportID, "user_id": userID}).Scan(&archive)
+	return archive, err
+}
+
+func (r *PgxUserRepository) ExportSessions(ctx context.Context, userID int32) (privacy.Table, error) {
+	return privacy.QueryTable(ctx, r.DB, `
+		SELECT id, ip_address, user_agent, created_at, last_seen_at, expires_at, impersonator_id
+		FROM auth.sessions
+		WHERE user_id = @user_id
+		ORDER BY created_at
+	`, pgx.NamedArgs{"user_id": userID})
+}
+
+func (r *PgxUserRepository) ExportIdentities(ctx context.Context, userID int32) (privacy.Table, error) {
+	return privacy.QueryTable(ctx, r.DB, `
+		SELECT provider, subject, email, linked_at, last_login_at
+		FROM auth.identities
+		WHERE user_id = @user_id
+		ORDER BY linked_at
+	`, pgx.NamedArgs{"user_id": userID})
+}
+
+func (r *PgxUserRepository) ExportPasskeys(ctx context.Context, userID int32) (privacy.Table, error) {
+	return privacy.QueryTable(ctx, r.DB, `
+		SELECT name, array_to_string(transports, ' ') AS transports, created_at, last_used_at
+		FROM auth.webauthn_credentials
+		WHERE user_id = @user_id
+		ORDER BY created_at
+	`, pgx.NamedArgs{"user_id": userID})
+}
+
+func (r *PgxUserRepository) ExportAPITokens(ctx context.Context, userID int32) (privacy.Table, error) {
+	return privacy.QueryTable(ctx, r.DB, `
+		SELECT name, token_prefix, array_to_string(scopes, ' ') AS scopes,
+			created_at, expires_at, last_used_at, last_used_ip
+		FROM auth.api_tokens
+		WHERE user_id = @user_id
+		ORDER BY created_at
+	`, pgx.NamedArgs{"user_id": userID})
+}
+
+// ExportAuditLog returns audit entries the user made or was the subject
+// of. IP addresses are only included for the user's own actions.
+func (r *PgxUserRepository) ExportAuditLog(ctx context.Context, userID int32) (privacy.Table, error) {
+	return privacy.QueryTable(ctx, r.DB, `
+		SELECT id, action, actor_id, target_user_id,
+			CASE WHEN actor_id = @user_id THEN ip_address ELSE '' END AS ip_address,
+			metadata::text AS metadata, created_at
+		FROM auth.audit_log
+		WHERE actor_id = @user_id OR target_user_id = @user_id
+		ORDER BY created_at
+	`, pgx.NamedArgs{"user_id": userID})
+}
+
+// CountSoleAdminStudios returns how many studios would be left without an
+// enabled Admin if the user went.
+func (r *PgxUserRepository) CountSoleAdminStudios(ctx context.Context, userID int32) (int64, error) {
+	query := `
+		SELECT count(*)
+		FROM auth.studio_members m
+		JOIN auth.users u ON u.id = m.user_id
+		JOIN auth.permission_groups pg ON pg.id = m.group_id
+		WHERE m.user_id = @user_id AND pg.name = @admin AND u.disabled_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM auth.studio_members o
+			JOIN auth.users ou ON ou.id = o.user_id
+			WHERE o.studio_id = m.studio_id AND o.group_id = m.group_id
+			  AND o.user_id <> m.user_id AND ou.disabled_at IS NULL
+		  )
+	`
+
+	var n int64
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"user_id": userID, "admin": adminGroupName}).Scan(&n)
+	return n, err
+}
+
+// EraseAccount deletes the user's credentials, sessions, pending tokens,
+// memberships and export archives, scrubs their IP address from the audit
+// log and anonymises the users row, in a single statement. The row itself
+// is kept (disabled) so audit entries and retained records still point
+// somewhere. Running it again is harmless.
+func (r *PgxUserRepository) EraseAccount(ctx context.Context, userID int32) (bool, error) {
+	query := `
+		WITH old AS (
+			SELECT lower(email) AS email FROM auth.users WHERE id = @id
+		), sessions AS (
+			DELETE FROM auth.sessions WHERE user_id = @id OR impersonator_id = @id
+		), identities AS (
+			DELETE FROM auth.identities WHERE user_id = @id
+		), passkeys AS (
+			DELETE FROM auth.webauthn_credentials WHERE user_id = @id
+		), totp AS (
+			DELETE FROM auth.user_totp WHERE user_id = @id
+		), recovery AS (
+			DELETE FROM auth.recovery_codes WHERE user_id = @id
+		), challenges AS (
+			DELETE FROM auth.mfa_challenges WHERE user_id = @id
+		), tokens AS (
+			DELETE FROM auth.api_tokens WHERE user_id = @id
+		), resets AS (
+			DELETE FROM auth.password_resets WHERE user_id = @id
+		), verifications AS (
+			DELETE FROM auth.email_verifications WHERE user_id = @id
+		), email_changes AS (
+			DELETE FROM auth.email_changes WHERE user_id = @id
+		), magic_links AS (
+			DELETE FROM auth.magic_links WHERE user_id = @id
+		), throttle AS (
+			DELETE FROM auth.login_throttle
+			WHERE key IN (SELECT 'account:' || email FROM old UNION SELECT 'magic-account:' || email FROM old)
+		), invitations AS (
+			DELETE FROM auth.invitations
+			WHERE accepted_at IS NULL AND lower(email) IN (SELECT email FROM old)
+		), accepted AS (
+			UPDATE auth.invitations SET email = @erased_email WHERE accepted_user_id = @id
+		), memberships AS (
+			DELETE FROM auth.studio_members WHERE user_id = @id
+		), exports AS (
+			DELETE FROM auth.data_exports WHERE user_id = @id
+		), audit AS (
+			UPDATE auth.audit_log SET ip_address = '' WHERE actor_id = @id
+		)
+		UPDATE auth.users
+		SET first_name = 'Erased',
+			last_name = 'user',
+			email = @erased_email,
+			password = '',
+			email_verified_at = NULL,
+			webauthn_handle = NULL,
+			avatar_url = NULL,
+			timezone = 'UTC',
+			locale = 'en',
+			default_studio_id = NULL,
+			disabled_at = COALESCE(disabled_at, now()),
+			erased_at = COALESCE(erased_at, now()),
+			updated_at = now()
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id":           userID,
+		"erased_email": erasedEmail(userID),
+	}
+
+	tag, err := r.DB.Exec(ctx, query, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/iankencruz/sabiflow/internal/shared/privacy"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrExportInProgress = errors.New("a data export is already being prepared")
+	ErrExportNotFound   = errors.New("data export not found")
+)
+
+// staleExportAfter is how long a pending export blocks new requests; past
+// it the build is assumed to have died with its server.
+const staleExportAfter = time.Hour
+
+// erasedEmail is the placeholder address an erased account is left with.
+// The .invalid TLD can never receive mail.
+func erasedEmail(userID int32) string {
+	return fmt.Sprintf("erased-%d@invalid", userID)
+}
+
+// PersonalDataSources returns what the auth module holds about a person,
+// for registration with the privacy registry. Register it before other
+// modules so the account is erased last.
+func (s *AuthServiceImpl) PersonalDataSources() []privacy.Source {
+	table := func(export func(context.Context, int32) (privacy.Table, error)) func(context.Context, int32) (any, error) {
+		return func(ctx context.Context, userID int32) (any, error) {
+			return export(ctx, userID)
+		}
+	}
+
+	return []privacy.Source{
+		{Name: "profile", Export: s.exportProfile, Erase: s.eraseAccountData},
+		{Name: "sessions", Export: table(s.Repo.ExportSessions)},
+		{Name: "identities", Export: table(s.Repo.ExportIdentities)},
+		{Name: "passkeys", Export: table(s.Repo.ExportPasskeys)},
+		{Name: "api-tokens", Export: table(s.Repo.ExportAPITokens)},
+		{Name: "audit-log", Export: table(s.Repo.ExportAuditLog)},
+	}
+}
+
+// exportProfile returns the account and its studio memberships.
+func (s *AuthServiceImpl) exportProfile(ctx context.Context, userID int32) (any, error) {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	studios, err := s.Repo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"user":    user,
+		"studios": studios,
+	}, nil
+}
+
+// eraseAccountData removes the avatar and anonymises the account.
+func (s *AuthServiceImpl) eraseAccountData(ctx context.Context, userID int32) error {
+	if s.Avatars != nil {
+		if err := s.Avatars.Delete(ctx, userID); err != nil {
+			return err
+		}
+	}
+
+	found, err := s.Repo.EraseAccount(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// RequestDataExport starts building an archive of userID's personal data
+// in the background and emails them when it is ready. requestedBy is the
+// user themselves or an administrator of the active studio, who may only
+// export accounts that belong to no other studio.
+func (s *AuthServiceImpl) RequestDataExport(ctx context.Context, userID, requestedBy int32) (*DataExport, error) {
+	if requestedBy != userID {
+		if err := s.ensureSoleStudio(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := s.Repo.CreateDataExport(ctx, userID, requestedBy, time.Now().Add(-staleExportAfter))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrExportInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.goBackground(ctx, func(ctx context.Context) {
+		s.buildDataExport(ctx, user, export.ID)
+	})
+	return export, nil
+}
+
+// buildDataExport gathers the archive and stores it. It runs off the
+// request path; failures are logged and recorded on the export.
+func (s *AuthServiceImpl) buildDataExport(ctx context.Context, user *User, exportID int32) {
+	var buf bytes.Buffer
+	if err := s.Privacy.Export(ctx, user.ID, &buf); err != nil {
+		s.failDataExport(ctx, exportID, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(s.DataExportTTL)
+	if err := s.Repo.CompleteDataExport(ctx, exportID, buf.Bytes(), expiresAt); err != nil {
+		s.failDataExport(ctx, exportID, err)
+		return
+	}
+
+	err := s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Sabiflow data export is ready",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA copy of the personal data Sabiflow holds about you is ready to download "+
+				"until %s:\n\n%s\n\nIf you didn't ask for this, please contact your studio's administrator.\n",
+			user.FirstName, expiresAt.Format(time.RFC1123), s.FrontendURL+"/account/privacy",
+		),
+	})
+	if err != nil {
+		s.logError("Failed to send data export notice", "err", err, "export_id", exportID)
+	}
+}
+
+// failDataExport logs why exportID could not be built and marks it failed.
+func (s *AuthServiceImpl) failDataExport(ctx context.Context, exportID int32, cause error) {
+	s.logError("Data export failed", "err", cause, "export_id", exportID)
+	if err := s.Repo.FailDataExport(ctx, exportID); err != nil {
+		s.logError("Failed to mark data export failed", "err", err, "export_id", exportID)
+	}
+}
+
+// ListDataExports returns the user's exports, newest first.
+func (s *AuthServiceImpl) ListDataExports(ctx context.Context, userID int32) ([]DataExport, error) {
+	return s.Repo.ListDataExports(ctx, userID)
+}
+
+// DataExportArchive returns the ZIP archive of one of the user's ready
+// exports.
+func (s *AuthServiceImpl) DataExportArchive(ctx context.Context, userID, exportID int32) ([]byte, error) {
+	archive, err := s.Repo.GetDataExportArchive(ctx, userID, exportID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrExportNotFound
+	}
+	return archive, err
+}
+
+// UserDataExports lists a member's exports for an administrator.
+func (s *AuthServiceImpl) UserDataExports(ctx context.Context, userID int32) ([]DataExport, error) {
+	if err := s.ensureSoleStudio(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.Repo.ListDataExports(ctx, userID)
+}
+
+// UserDataExportArchive returns a member's archive for an administrator.
+func (s *AuthServiceImpl) UserDataExportArchive(ctx context.Context, userID, exportID int32) ([]byte, error) {
+	if err := s.ensureSoleStudio(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.DataExportArchive(ctx, userID, exportID)
+}
+
+// EraseAccount erases the signed-in user's own account after checking
+// their password, or a recent sign-in for accounts without one.
+func (s *AuthServiceImpl) EraseAccount(ctx context.Context, userID int32, reauth Reauth) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyReauth(ctx, user, reauth); err != nil {
+		return err
+	}
+	return s.eraseUser(ctx, user)
+}
+
+// EraseUser erases a member of the active studio on an administrator's
+// behalf. Like DeleteUser it refuses accounts shared with other studios.
+func (s *AuthServiceImpl) EraseUser(ctx context.Context, userID int32) error {
+	if err := s.ensureSoleStudio(ctx, userID); err != nil {
+		return err
+	}
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.eraseUser(ctx, user)
+}
+
+// eraseUser runs every registered source's erasure for the user, ending
+// with the account itself, unless that would leave a studio without an
+// Admin. The user is told at their old address.
+func (s *AuthServiceImpl) eraseUser(ctx context.Context, user *User) error {
+	n, err := s.Repo.CountSoleAdminStudios(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrLastAdmin
+	}
+
+	if err := s.Privacy.Erase(ctx, user.ID); err != nil {
+		return err
+	}
+	s.Principals.Forget(user.ID)
+
+	s.goBackground(ctx, func(ctx context.Context) {
+		err := s.Mailer.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: "Your Sabiflow account has been erased",
+			Body: fmt.Sprintf(
+				"Hi %s,\n\nYour Sabiflow account and the personal data linked to it have been erased. "+
+					"Records we must keep by law, such as invoices, are retained without your details.\n",
+				user.FirstName,
+			),
+		})
+		if err != nil {
+			s.logError("Failed to send erasure notice", "err", err, "user_id", user.ID)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,339 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	stdErrors "errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+	_ "time/tzdata" // timezone validation must not depend on the host's zoneinfo
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// ReasonAvatarsDisabled tells the SPA to hide the avatar upload control.
+const ReasonAvatarsDisabled = "avatars_disabled"
+
+// ReasonReauthRequired tells the SPA to send a password-less user through
+// their sign-in method (passkey, SSO or magic link) and then retry.
+const ReasonReauthRequired = "reauth_required"
+
+// maxAvatarBytes caps avatar uploads.
+const maxAvatarBytes = 2 << 20
+
+// avatarTypes are the sniffed content types accepted as avatars.
+var avatarTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// UpdateProfileHandler lets the signed-in user change their name, timezone
+// and locale. Omitted preferences keep their current value.
+func (h *AuthHandler) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Firstname string  `json:"firstName"`
+		Lastname  string  `json:"lastName"`
+		Timezone  *string `json:"timezone"`
+		Locale    *string `json:"locale"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	user, err := h.Service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to load user")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	timezone, locale := user.Timezone, user.Locale
+	if input.Timezone != nil {
+		timezone = *input.Timezone
+	}
+	if input.Locale != nil {
+		locale = *input.Locale
+	}
+
+	v := validators.New()
+	v.Require("firstName", input.Firstname)
+	v.Require("lastName", input.Lastname)
+	v.Check("timezone", validTimezone(timezone), "Must be an IANA timezone such as Australia/Sydney")
+	v.MatchPattern("locale", locale, validators.LocaleRX, "Must be a language tag such as en or en-AU")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	user, err = h.Service.UpdateProfile(r.Context(), userID, input.Firstname, input.Lastname, timezone, locale)
+	if err != nil {
+		errResp := errors.Internal("Failed to update profile")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Profile updated", map[string]any{"user": user})
+}
+
+// ChangePasswordHandler sets a new password after checking the current one,
+// then signs the user out everywhere else and rotates this session.
+func (h *AuthHandler) ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	validatePassword(v, "newPassword", input.NewPassword)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	err := h.Service.ChangePassword(r.Context(), userID, h.reauth(r, input.CurrentPassword), input.NewPassword)
+	if writeWeakPassword(w, "newPassword", err) {
+		return
+	}
+	var throttled *LoginThrottledError
+	if stdErrors.As(err, &throttled) {
+		writeLoginThrottled(w, throttled)
+		return
+	}
+	if stdErrors.Is(err, ErrReauthRequired) {
+		writeReauthRequired(w)
+		return
+	}
+	if stdErrors.Is(err, ErrWrongPassword) {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, map[string]string{"currentPassword": "Current password is incorrect"})
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to change password")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	n, err := h.SessionManager.RevokeOthers(r, userID)
+	if err != nil && h.Logger != nil {
+		h.Logger.Error("Failed to revoke sessions after password change", "err", err, "user_id", userID)
+	}
+	// Rotate this session too, so its old token is worthless.
+	if err := h.SessionManager.Rotate(w, r, userID); err != nil {
+		if h.Logger != nil {
+			h.Logger.Error("Failed to rotate session after password change", "err", err, "user_id", userID)
+		}
+		errResp := errors.Internal("Password changed, but please sign in again")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Password changed", map[string]any{"revoked": n})
+}
+
+// RequestEmailChangeHandler sends a confirmation link to the new address.
+func (h *AuthHandler) RequestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		NewEmail        string `json:"newEmail"`
+		CurrentPassword string `json:"currentPassword"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("newEmail", input.NewEmail)
+	v.MatchPattern("newEmail", input.NewEmail, validators.EmailRX, "Must be a valid email address")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	err := h.Service.RequestEmailChange(r.Context(), userID, h.reauth(r, input.CurrentPassword), input.NewEmail)
+	var throttled *LoginThrottledError
+	switch {
+	case stdErrors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+		return
+	case stdErrors.Is(err, ErrReauthRequired):
+		writeReauthRequired(w)
+		return
+	case stdErrors.Is(err, ErrWrongPassword):
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, map[string]string{"currentPassword": "Current password is incorrect"})
+		return
+	case stdErrors.Is(err, ErrEmailUnchanged):
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, map[string]string{"newEmail": "This is already your email address"})
+		return
+	case stdErrors.Is(err, ErrEmailInUse):
+		errResp := errors.Conflict("Email already in use")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		if h.Logger != nil {
+			h.Logger.Error("Failed to start email change", "err", err, "user_id", userID)
+		}
+		errResp := errors.Internal("Failed to start email change")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Check your new inbox to confirm the change", nil)
+}
+
+// ConfirmEmailChangeHandler applies an email change from the link sent to
+// the new address. It does not need a session, so the link works in any
+// browser.
+func (h *AuthHandler) ConfirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	_, err := h.Service.ConfirmEmailChange(r.Context(), input.Token)
+	switch {
+	case stdErrors.Is(err, ErrInvalidToken):
+		errResp := errors.BadRequest("Confirmation link is invalid or has expired")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case stdErrors.Is(err, ErrEmailInUse):
+		errResp := errors.Conflict("Email already in use")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		errResp := errors.Internal("Failed to change email")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Email address changed", nil)
+}
+
+// UploadAvatarHandler accepts a multipart "avatar" image of up to 2 MiB.
+func (h *AuthHandler) UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBytes+1<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		errResp := errors.BadRequest("Upload an image of at most 2 MB in the avatar field")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes+1))
+	if err != nil || len(data) > maxAvatarBytes {
+		errResp := errors.BadRequest("Upload an image of at most 2 MB in the avatar field")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	// Trust the bytes, not the client's Content-Type.
+	contentType := http.DetectContentType(data)
+	if !slices.Contains(avatarTypes, contentType) {
+		errResp := errors.BadRequest("Avatar must be a PNG, JPEG, GIF or WebP image")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	user, err := h.Service.SetAvatar(r.Context(), userID, contentType, bytes.NewReader(data))
+	if err != nil {
+		h.writeAvatarError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Avatar updated", map[string]any{"user": user})
+}
+
+func (h *AuthHandler) DeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.RemoveAvatar(r.Context(), userID)
+	if err != nil {
+		h.writeAvatarError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Avatar removed", map[string]any{"user": user})
+}
+
+func (h *AuthHandler) writeAvatarError(w http.ResponseWriter, err error) {
+	if stdErrors.Is(err, ErrAvatarsDisabled) {
+		errResp := errors.BadRequest("Avatar uploads are not enabled").WithReason(ReasonAvatarsDisabled)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if h.Logger != nil {
+		h.Logger.Error("Avatar update failed", "err", err)
+	}
+	errResp := errors.Internal("Failed to update avatar")
+	response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+}
+
+// validTimezone reports whether tz is a known IANA zone name.
+func validTimezone(tz string) bool {
+	if tz == "" || tz == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(tz)
+	return err == nil
+}
+
+// reauth collects the proof of presence for a sensitive change: the
+// password the user re-entered, if any, and when this session signed in.
+func (h *AuthHandler) reauth(r *http.Request, password string) Reauth {
+	return Reauth{Password: password, SignedInAt: h.SessionManager.SignedInAt(r), IP: sessions.ClientIP(r)}
+}
+
+func writeReauthRequired(w http.ResponseWriter) {
+	errResp := errors.Forbidden("Please sign in again to confirm this change").WithReason(ReasonReauthRequired)
+	response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/password"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+)
+
+// profileRepo holds one user with a password.
+type profileRepo struct {
+	*memThrottle
+	user *User
+}
+
+func (r *profileRepo) GetByID(context.Context, int32) (*User, error) {
+	u := *r.user
+	return &u, nil
+}
+
+func (r *profileRepo) UpdatePassword(_ context.Context, _ int32, hashed string) error {
+	r.user.Password = hashed
+	return nil
+}
+
+func newProfileHandler(t *testing.T) (*AuthHandler, *profileRepo) {
+	t.Helper()
+
+	hasher := password.NewArgon2id(password.Params{Memory: 1024, Iterations: 1, Parallelism: 1})
+	hashed, err := hasher.Hash("old password here")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &profileRepo{
+		memThrottle: newMemThrottle(),
+		user:        &User{ID: 1, FirstName: "Ada", Email: "ada@example.com", Password: hashed},
+	}
+	svc := &AuthServiceImpl{
+		Repo:      repo,
+		Passwords: hasher,
+		LoginThrottle: LoginThrottle{
+			MaxAttempts:   2,
+			IPMaxAttempts: 100,
+			Window:        time.Hour,
+			Lockout:       time.Minute,
+			MaxLockout:    time.Hour,
+		},
+		OnLoginLocked: func(context.Context, *User, time.Time) {},
+	}
+	return &AuthHandler{
+		Service:        svc,
+		SessionManager: sessions.NewManager(sessions.NewMemoryStore(), sessions.Config{CookieName: "session", AbsoluteLifetime: 24 * time.Hour}),
+	}, repo
+}
+
+// signedInRequest signs user 1 in with a remembered session and returns a
+// request presenting its cookie.
+func signedInRequest(t *testing.T, h *AuthHandler, body string) *http.Request {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := h.SessionManager.SetUserID(w, httptest.NewRequest(http.MethodPost, "/", nil), 1, true); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func sessionCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "session" {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestChangePasswordRotatesSession(t *testing.T) {
+	h, _ := newProfileHandler(t)
+	r := signedInRequest(t, h, `{"currentPassword":"old password here","newPassword":"correct horse battery"}`)
+
+	w := httptest.NewRecorder()
+	h.ChangePasswordHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+
+	rotated := sessionCookie(w)
+	if rotated == nil || rotated.Value == h.SessionManager.Token(r) {
+		t.Fatal("session not rotated")
+	}
+	if rotated.Expires.IsZero() {
+		t.Fatal("remembered session lost its persistent cookie")
+	}
+	if userID, _ := h.SessionManager.GetUserID(r); userID != 0 {
+		t.Fatal("old session token still signed in")
+	}
+
+	next := httptest.NewRequest(http.MethodGet, "/", nil)
+	next.AddCookie(rotated)
+	if userID, err := h.SessionManager.GetUserID(next); err != nil || userID != 1 {
+		t.Fatalf("new session: user = %d, err = %v", userID, err)
+	}
+}
+
+func TestChangePasswordThrottlesWrongPasswords(t *testing.T) {
+	h, repo := newProfileHandler(t)
+
+	wrong := `{"currentPassword":"guess","newPassword":"correct horse battery"}`
+	w := httptest.NewRecorder()
+	h.ChangePasswordHandler(w, signedInRequest(t, h, wrong))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("first guess: status = %d, want 400", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	h.ChangePasswordHandler(w, signedInRequest(t, h, wrong))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second guess: status = %d, want 429", w.Code)
+	}
+
+	// The account stays locked even for the right password.
+	before := repo.user.Password
+	w = httptest.NewRecorder()
+	h.ChangePasswordHandler(w, signedInRequest(t, h, `{"currentPassword":"old password here","newPassword":"correct horse battery"}`))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("while locked: status = %d, want 429", w.Code)
+	}
+	if repo.user.Password != before {
+		t.Fatal("password changed while locked out")
+	}
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ProfileRepository covers the changes users make to their own account.
+type ProfileRepository interface {
+	UpdateProfile(ctx context.Context, userID int32, firstName, lastName, timezone, locale string) (bool, error)
+	SetAvatarURL(ctx context.Context, userID int32, url *string) error
+	CreateEmailChange(ctx context.Context, userID int32, newEmail, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailChange(ctx context.Context, tokenHash string) (int32, string, error)
+	ChangeEmail(ctx context.Context, userID int32, newEmail string) error
+}
+
+func (r *PgxUserRepository) UpdateProfile(ctx context.Context, userID int32, firstName, lastName, timezone, locale string) (bool, error) {
+	query := `
+		UPDATE auth.users
+		SET first_name = @first_name,
+			last_name = @last_name,
+			timezone = @timezone,
+			locale = @locale,
+			updated_at = now()
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id":         userID,
+		"first_name": firstName,
+		"last_name":  lastName,
+		"timezone":   timezone,
+		"locale":     locale,
+	}
+
+	tag, err := r.DB.Exec(ctx, query, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgxUserRepository) SetAvatarURL(ctx context.Context, userID int32, url *string) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.users SET avatar_url = @avatar_url, updated_at = now()
+		WHERE id = @id
+	`, pgx.NamedArgs{"id": userID, "avatar_url": url})
+	return err
+}
+
+// CreateEmailChange stores a confirmation token for newEmail, cancelling
+// any change the user still had pending.
+func (r *PgxUserRepository) CreateEmailChange(ctx context.Context, userID int32, newEmail, tokenHash string, expiresAt time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.email_changes
+		SET used_at = now()
+		WHERE user_id = @user_id AND used_at IS NULL
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth.email_changes (user_id, new_email, token_hash, expires_at)
+		VALUES (@user_id, @new_email, @token_hash, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":    userID,
+		"new_email":  newEmail,
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	}
+
+	_, err = r.DB.Exec(ctx, query, args)
+	return err
+}
+
+// ConsumeEmailChange atomically spends a valid token and returns the user
+// and the address they asked to move to.
+func (r *PgxUserRepository) ConsumeEmailChange(ctx context.Context, tokenHash string) (int32, string, error) {
+	query := `
+		UPDATE auth.email_changes
+		SET used_at = now()
+		WHERE token_hash = @token_hash AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id, new_email
+	`
+
+	var userID int32
+	var email string
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"token_hash": tokenHash}).Scan(&userID, &email)
+	return userID, email, err
+}
+
+// ChangeEmail switches the account to newEmail. The address was confirmed
+// by the change link, so it counts as verified.
+func (r *PgxUserRepository) ChangeEmail(ctx context.Context, userID int32, newEmail string) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.users
+		SET email = @email, email_verified_at = now(), updated_at = now()
+		WHERE id = @id
+	`, pgx.NamedArgs{"id": userID, "email": newEmail})
+	return err
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+)
+
+var (
+	ErrWrongPassword   = errors.New("current password is incorrect")
+	ErrReauthRequired  = errors.New("sign in again to confirm this change")
+	ErrEmailUnchanged  = errors.New("new email is the current email")
+	ErrAvatarsDisabled = errors.New("avatar uploads are not configured")
+)
+
+// AvatarStore keeps profile pictures somewhere clients can load them from
+// (local disk, S3, a CDN, …). Leave AuthServiceImpl.Avatars nil to switch
+// uploads off.
+type AvatarStore interface {
+	// Save stores image, replacing any earlier avatar for userID, and
+	// returns its public URL.
+	Save(ctx context.Context, userID int32, contentType string, image io.Reader) (string, error)
+	Delete(ctx context.Context, userID int32) error
+}
+
+// UpdateProfile changes the signed-in user's own name and preferences. The
+// email address has its own confirmation flow; see RequestEmailChange.
+func (s *AuthServiceImpl) UpdateProfile(ctx context.Context, userID int32, firstName, lastName, timezone, locale string) (*User, error) {
+	found, err := s.Repo.UpdateProfile(ctx, userID, strings.TrimSpace(firstName), strings.TrimSpace(lastName), timezone, locale)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+// ChangePassword replaces the user's password after checking the current
+// one. Accounts that only ever signed in through SSO, passkeys or magic
+// links have no password yet and may set one after a fresh sign-in.
+func (s *AuthServiceImpl) ChangePassword(ctx context.Context, userID int32, reauth Reauth, next string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.verifyReauth(ctx, user, reauth); err != nil {
+		return err
+	}
+
+	hashed, err := s.hashNewPassword(next)
+	if err != nil {
+		return err
+	}
+	return s.Repo.UpdatePassword(ctx, userID, hashed)
+}
+
+// RequestEmailChange emails a confirmation link to newEmail; the account
+// keeps its current address until the link is used. The current address is
+// told about the request so a hijacked session cannot move it quietly.
+func (s *AuthServiceImpl) RequestEmailChange(ctx context.Context, userID int32, reauth Reauth, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrEmailUnchanged
+	}
+	if err := s.verifyReauth(ctx, user, reauth); err != nil {
+		return err
+	}
+	if existing, _ := s.Repo.GetByEmail(ctx, newEmail); existing != nil {
+		return ErrEmailInUse
+	}
+
+	raw, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.CreateEmailChange(ctx, userID, newEmail, hash, time.Now().Add(s.EmailVerificationTTL)); err != nil {
+		return fmt.Errorf("store email change: %w", err)
+	}
+
+	link := s.FrontendURL + "/confirm-email-change?token=" + url.QueryEscape(raw)
+
+	err = s.Mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email for Sabiflow",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to use this address for your Sabiflow account:\n\n%s\n\n"+
+				"The link expires in %s. If you didn't ask for this, you can ignore this email.\n",
+			user.FirstName, link, s.EmailVerificationTTL,
+		),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your Sabiflow email is about to change",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to change the email on your Sabiflow account to %s.\n"+
+				"Nothing changes until the new address is confirmed.\n\n"+
+				"If this wasn't you, reset your password and sign out of other sessions.\n",
+			user.FirstName, newEmail,
+		),
+	})
+}
+
+// ConfirmEmailChange spends a change token and moves the account to the
+// new, now verified, address. It returns the user's ID.
+func (s *AuthServiceImpl) ConfirmEmailChange(ctx context.Context, token string) (int32, error) {
+	userID, newEmail, err := s.Repo.ConsumeEmailChange(ctx, hashToken(token))
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	if err := s.Repo.ChangeEmail(ctx, userID, newEmail); err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrEmailInUse
+		}
+		return 0, err
+	}
+	return userID, nil
+}
+
+// SetAvatar stores a new profile picture through the AvatarStore.
+func (s *AuthServiceImpl) SetAvatar(ctx context.Context, userID int32, contentType string, image io.Reader) (*User, error) {
+	if s.Avatars == nil {
+		return nil, ErrAvatarsDisabled
+	}
+
+	avatarURL, err := s.Avatars.Save(ctx, userID, contentType, image)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.SetAvatarURL(ctx, userID, &avatarURL); err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+func (s *AuthServiceImpl) RemoveAvatar(ctx context.Context, userID int32) (*User, error) {
+	if s.Avatars == nil {
+		return nil, ErrAvatarsDisabled
+	}
+
+	if err := s.Avatars.Delete(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.SetAvatarURL(ctx, userID, nil); err != nil {
+		return nil, err
+	}
+	return s.GetUserByID(ctx, userID)
+}
+
+// Reauth is what a sensitive change offers as proof that the account owner
+// is present: the current password and when the session signed in.
+type Reauth struct {
+	Password   string
+	SignedInAt time.Time
+	// IP is the client address, for the login throttle.
+	IP string
+}
+
+// verifyReauth re-authenticates a sensitive change. Users with a password
+// must re-enter it. Users without one (SSO, passkey or magic-link only)
+// must have signed in within ReauthWindow; otherwise ErrReauthRequired
+// sends them through their sign-in method again.
+//
+// Wrong passwords count as failed sign-ins, so a hijacked session cannot
+// guess the password here faster than at /auth/login.
+func (s *AuthServiceImpl) verifyReauth(ctx context.Context, user *User, reauth Reauth) error {
+	if user.Password == "" {
+		if reauth.SignedInAt.IsZero() || time.Since(reauth.SignedInAt) > s.ReauthWindow {
+			return ErrReauthRequired
+		}
+		return nil
+	}
+
+	if err := s.checkLoginThrottle(ctx, user.Email, reauth.IP); err != nil {
+		return err
+	}
+
+	ok, _, err := s.Passwords.Verify(user.Password, reauth.Password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := s.recordLoginFailure(ctx, user.Email, reauth.IP, user); err != nil {
+			return err
+		}
+		return ErrWrongPassword
+	}
+	return nil
+}
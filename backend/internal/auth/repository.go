@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"time"
 
 	"github.com/iankencruz/sabiflow/internal/platform/database"
 	"github.com/jackc/pgx/v5"
@@ -13,9 +14,44 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id int32) (*User, error)
 	CreateUserOAuth(ctx context.Context, firstName, lastName, email string) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
-	GetGroupPermissions(ctx context.Context, userID int32) ([]string, error)
+	UpdatePassword(ctx context.Context, userID int32, hashed string) error
+	CreatePasswordReset(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (int32, error)
+	MarkEmailVerified(ctx context.Context, userID int32, email string) error
+	IsEmailVerified(ctx context.Context, userID int32) (bool, error)
+	CreateEmailVerification(ctx context.Context, userID int32, email, tokenHash string, expiresAt time.Time) error
+	ConsumeEmailVerification(ctx context.Context, tokenHash string) (int32, string, error)
+	// WithTx runs fn against a repository bound to one transaction,
+	// committing when fn returns nil and rolling back otherwise.
+	WithTx(ctx context.Context, fn func(repo UserRepository) error) error
+
+	TwoFactorRepository
+	WebAuthnRepository
+	IdentityRepository
+	InvitationRepository
+	UserAdminRepository
+	PermissionRepository
+	APITokenRepository
+	ThrottleRepository
+	ProfileRepository
+	MagicLinkRepository
+	AuditRepository
+	StudioRepository
+	PrivacyRepository
 }
 
+// ownerIfFirst makes the very first account an Admin of the first studio so
+// a fresh install always has an owner; later accounts start in no studio.
+// It follows a new_user CTE that inserted the account.
+const ownerIfFirst = `owner AS (
+	INSERT INTO auth.studio_members (studio_id, user_id, group_id)
+	SELECT pg.studio_id, new_user.id, pg.id
+	FROM new_user, auth.permission_groups pg
+	WHERE pg.name = 'Admin' AND pg.is_system
+		AND pg.studio_id = (SELECT min(id) FROM auth.studios)
+		AND NOT EXISTS (SELECT 1 FROM auth.users)
+)`
+
 type PgxUserRepository struct {
 	DB database.DBTX
 }
@@ -24,11 +60,20 @@ func NewUserRepository(db database.DBTX) *PgxUserRepository {
 	return &PgxUserRepository{DB: db}
 }
 
+func (r *PgxUserRepository) WithTx(ctx context.Context, fn func(repo UserRepository) error) error {
+	return pgx.BeginFunc(ctx, r.DB, func(tx pgx.Tx) error {
+		return fn(&PgxUserRepository{DB: tx})
+	})
+}
+
 func (r *PgxUserRepository) Create(ctx context.Context, user *User) error {
 	query := `
-		INSERT INTO auth.users (first_name, last_name, email, password)
-		VALUES (@first_name, @last_name, @email, @password)
-		RETURNING id, created_at, updated_at
+		WITH new_user AS (
+			INSERT INTO auth.users (first_name, last_name, email, password)
+			VALUES (@first_name, @last_name, @email, @password)
+			RETURNING id, created_at, updated_at, timezone, locale
+		), ` + ownerIfFirst + `
+		SELECT id, created_at, updated_at, timezone, locale FROM new_user
 	`
 
 	args := pgx.NamedArgs{
@@ -38,20 +83,20 @@ func (r *PgxUserRepository) Create(ctx context.Context, user *User) error {
 		"password":   user.Password,
 	}
 
-	return r.DB.QueryRow(ctx, query, args).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	return r.DB.QueryRow(ctx, query, args).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt, &user.Timezone, &user.Locale)
 }
 
-func (r *PgxUserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `
-		SELECT id, first_name, last_name, email, password, created_at, updated_at
-		FROM auth.users
-		WHERE email = @email
-	`
-
-	args := pgx.NamedArgs{"email": email}
+// userColumns and userFrom select everything scanUser expects.
+const (
+	userColumns = `u.id, u.first_name, u.last_name, u.email, u.password, u.created_at, u.updated_at,
+		u.email_verified_at, u.disabled_at, u.timezone, u.locale, u.avatar_url`
+	userFrom = `auth.users u`
+)
 
-	var user User
-	err := r.DB.QueryRow(ctx, query, args).Scan(
+// userDest returns scan targets matching userColumns, so queries that add
+// columns can append their own.
+func userDest(user *User) []any {
+	return []any{
 		&user.ID,
 		&user.FirstName,
 		&user.LastName,
@@ -59,46 +104,48 @@ func (r *PgxUserRepository) GetByEmail(ctx context.Context, email string) (*User
 		&user.Password,
 		&user.CreatedAt,
 		&user.UpdatedAt,
-	)
+		&user.EmailVerifiedAt,
+		&user.DisabledAt,
+		&user.Timezone,
+		&user.Locale,
+		&user.AvatarURL,
+	}
+}
 
-	if err != nil {
+func scanUser(row pgx.Row) (*User, error) {
+	var user User
+	if err := row.Scan(userDest(&user)...); err != nil {
 		return nil, err
 	}
-
 	return &user, nil
 }
 
+func (r *PgxUserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `SELECT ` + userColumns + ` FROM ` + userFrom + ` WHERE lower(u.email) = lower(@email)`
+
+	args := pgx.NamedArgs{"email": email}
+
+	return scanUser(r.DB.QueryRow(ctx, query, args))
+}
+
 func (r *PgxUserRepository) GetByID(ctx context.Context, id int32) (*User, error) {
-	query := `
-		SELECT id, first_name, last_name, email, password, created_at, updated_at
-		FROM auth.users
-		WHERE id = @id
-	`
+	query := `SELECT ` + userColumns + ` FROM ` + userFrom + ` WHERE u.id = @id`
 
 	args := pgx.NamedArgs{"id": id}
 
-	var user User
-	err := r.DB.QueryRow(ctx, query, args).Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-
-	return &user, nil
+	return scanUser(r.DB.QueryRow(ctx, query, args))
 }
 
+// CreateUserOAuth inserts a user without a password; they sign in through
+// a linked identity until they set one.
 func (r *PgxUserRepository) CreateUserOAuth(ctx context.Context, firstName, lastName, email string) (*User, error) {
 	query := `
-		INSERT INTO auth.users (first_name, last_name, email, password, provider)
-		VALUES (@first_name, @last_name, @email, '', 'google')
-		RETURNING id, first_name, last_name, email, created_at, updated_at
+		WITH new_user AS (
+			INSERT INTO auth.users (first_name, last_name, email, password)
+			VALUES (@first_name, @last_name, @email, '')
+			RETURNING id, first_name, last_name, email, created_at, updated_at, timezone, locale
+		), ` + ownerIfFirst + `
+		SELECT id, first_name, last_name, email, created_at, updated_at, timezone, locale FROM new_user
 	`
 
 	args := pgx.NamedArgs{
@@ -115,6 +162,8 @@ func (r *PgxUserRepository) CreateUserOAuth(ctx context.Context, firstName, last
 		&user.Email,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.Timezone,
+		&user.Locale,
 	)
 	if err != nil {
 		return nil, err
@@ -127,7 +176,7 @@ func (r *PgxUserRepository) GetUserByEmail(ctx context.Context, email string) (*
 	query := `
 		SELECT id, first_name, last_name, email
 		FROM auth.users
-		WHERE email = @email
+		WHERE lower(email) = lower(@email)
 	`
 	args := pgx.NamedArgs{"email": email}
 	var u User
@@ -138,34 +187,136 @@ func (r *PgxUserRepository) GetUserByEmail(ctx context.Context, email string) (*
 	return &u, nil
 }
 
-func (r *PgxUserRepository) GetGroupPermissions(ctx context.Context, userID int32) ([]string, error) {
+func (r *PgxUserRepository) UpdatePassword(ctx context.Context, userID int32, hashed string) error {
 	query := `
-		SELECT p.code
-		FROM auth.users u
-		JOIN auth.permission_groups pg ON u.group_id = pg.id
-		JOIN auth.group_permissions gp ON gp.group_id = pg.id
-		JOIN auth.permissions p ON p.id = gp.permission_id
-		WHERE u.id = @user_id
+		UPDATE auth.users
+		SET password = @password, updated_at = now()
+		WHERE id = @id
 	`
 
 	args := pgx.NamedArgs{
-		"user_id": userID,
+		"id":       userID,
+		"password": hashed,
 	}
 
-	rows, err := r.DB.Query(ctx, query, args)
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
+
+// CreatePasswordReset stores a new reset token hash. Any older, unused
+// tokens for the same user are invalidated so only the latest link works.
+func (r *PgxUserRepository) CreatePasswordReset(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.password_resets
+		SET used_at = now()
+		WHERE user_id = @user_id AND used_at IS NULL
+	`, pgx.NamedArgs{"user_id": userID})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	var perms []string
-	for rows.Next() {
-		var code string
-		if err := rows.Scan(&code); err != nil {
-			return nil, err
-		}
-		perms = append(perms, code)
+
+	query := `
+		INSERT INTO auth.password_resets (user_id, token_hash, expires_at)
+		VALUES (@user_id, @token_hash, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":    userID,
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
 	}
 
-	return perms, nil
+	_, err = r.DB.Exec(ctx, query, args)
+	return err
+}
+
+// ConsumePasswordReset atomically marks a valid token as used and returns
+// its user. pgx.ErrNoRows means the token is unknown, expired or spent.
+func (r *PgxUserRepository) ConsumePasswordReset(ctx context.Context, tokenHash string) (int32, error) {
+	query := `
+		UPDATE auth.password_resets
+		SET used_at = now()
+		WHERE token_hash = @token_hash AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id
+	`
+
+	args := pgx.NamedArgs{"token_hash": tokenHash}
+
+	var userID int32
+	err := r.DB.QueryRow(ctx, query, args).Scan(&userID)
+	return userID, err
+}
+
+// MarkEmailVerified stamps email_verified_at, but only while the account
+// still uses the address that was verified.
+func (r *PgxUserRepository) MarkEmailVerified(ctx context.Context, userID int32, email string) error {
+	query := `
+		UPDATE auth.users
+		SET email_verified_at = COALESCE(email_verified_at, now()), updated_at = now()
+		WHERE id = @id AND email = @email
+	`
+
+	args := pgx.NamedArgs{
+		"id":    userID,
+		"email": email,
+	}
+
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
+
+func (r *PgxUserRepository) IsEmailVerified(ctx context.Context, userID int32) (bool, error) {
+	query := `
+		SELECT email_verified_at IS NOT NULL
+		FROM auth.users
+		WHERE id = @id
+	`
+
+	var verified bool
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"id": userID}).Scan(&verified)
+	return verified, err
+}
+
+// CreateEmailVerification stores a new verification token hash for email,
+// invalidating earlier unused tokens for the same user.
+func (r *PgxUserRepository) CreateEmailVerification(ctx context.Context, userID int32, email, tokenHash string, expiresAt time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.email_verifications
+		SET used_at = now()
+		WHERE user_id = @user_id AND used_at IS NULL
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO auth.email_verifications (user_id, email, token_hash, expires_at)
+		VALUES (@user_id, @email, @token_hash, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":    userID,
+		"email":      email,
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	}
+
+	_, err = r.DB.Exec(ctx, query, args)
+	return err
+}
+
+// ConsumeEmailVerification atomically spends a valid token and returns the
+// user and the address it was issued for.
+func (r *PgxUserRepository) ConsumeEmailVerification(ctx context.Context, tokenHash string) (int32, string, error) {
+	query := `
+		UPDATE auth.email_verifications
+		SET used_at = now()
+		WHERE token_hash = @token_hash AND used_at IS NULL AND expires_at > now()
+		RETURNING user_id, email
+	`
+
+	var userID int32
+	var email string
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"token_hash": tokenHash}).Scan(&userID, &email)
+	return userID, email, err
 }
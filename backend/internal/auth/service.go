@@ -3,23 +3,144 @@ package auth
 import (
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/iankencruz/sabiflow/internal/platform/encryption"
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+	"github.com/iankencruz/sabiflow/internal/platform/password"
+	"github.com/iankencruz/sabiflow/internal/shared/privacy"
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
 )
 
+// ErrInvalidToken is returned when a single-use token is unknown, expired or
+// has already been consumed.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// ErrInvalidCredentials is returned by Login for an unknown email or a wrong
+// password alike.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
 // AuthServiceImpl implements AuthService.
 type AuthServiceImpl struct {
-	Repo UserRepository
+	Repo   UserRepository
+	Mailer mail.Sender
+	// Logger records failures in work done off the request path, such as
+	// sending email; nil discards them.
+	Logger *slog.Logger
+
+	// FrontendURL is the SPA origin used to build links in emails.
+	FrontendURL string
+	// PasswordResetTTL is how long a reset link stays valid.
+	PasswordResetTTL time.Duration
+	// PasswordResetLimits caps how often reset links are requested.
+	PasswordResetLimits RequestLimits
+	// EmailVerificationTTL is how long a verification link stays valid.
+	EmailVerificationTTL time.Duration
+
+	// Cipher encrypts TOTP secrets at rest.
+	Cipher *encryption.Cipher
+	// TOTPIssuer is the account label shown in authenticator apps.
+	TOTPIssuer string
+	// MFAChallengeTTL is how long a password-verified login may wait for
+	// its second factor.
+	MFAChallengeTTL time.Duration
+
+	// WebAuthn runs passkey registration and login ceremonies.
+	WebAuthn *webauthn.WebAuthn
+
+	// OpenRegistration lets anyone sign up. When false only the first
+	// (owner) account may self-register; everyone else needs an invitation.
+	OpenRegistration bool
+	// InvitationTTL is the default lifetime of an invitation link.
+	InvitationTTL time.Duration
+
+	// Principals caches what RequireAuth loads per user; nil disables it.
+	Principals *PrincipalCache
+
+	// Passwords hashes and verifies passwords; PasswordPolicy is the rule set
+	// every new password must satisfy (nil accepts any non-empty password).
+	Passwords      password.Hasher
+	PasswordPolicy *password.Policy
+	// ReauthWindow is how recently a password-less user must have signed in
+	// to change credentials or erase their account.
+	ReauthWindow time.Duration
+
+	// Avatars stores profile pictures; nil disables uploads.
+	Avatars AvatarStore
+
+	// MagicLinks configures passwordless sign-in by emailed link.
+	MagicLinks MagicLinkSettings
+
+	// LoginThrottle limits password guessing per account and per IP.
+	LoginThrottle LoginThrottle
+	// OnLoginLocked is called when an account is locked out; nil emails the
+	// account owner instead.
+	OnLoginLocked func(ctx context.Context, user *User, until time.Time)
+
+	// Privacy gathers and erases personal data across modules for access
+	// and erasure requests; DataExportTTL is how long an archive can be
+	// downloaded.
+	Privacy       *privacy.Registry
+	DataExportTTL time.Duration
+
+	// background counts work started off the request path; see Wait.
+	background sync.WaitGroup
+}
+
+// RequestLimits caps requests for emailed links: at most MaxPerAccount for
+// one address and MaxPerIP from one client within Window. A zero limit
+// disables that counter.
+type RequestLimits struct {
+	MaxPerAccount int
+	MaxPerIP      int
+	Window        time.Duration
+}
+
+// goBackground runs fn off the request path with ctx's values but not its
+// cancellation, so it outlives the request.
+func (s *AuthServiceImpl) goBackground(ctx context.Context, fn func(ctx context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		fn(context.WithoutCancel(ctx))
+	}()
+}
+
+// Wait blocks until work started off the request path has finished. Call it
+// on shutdown, after the server has drained, so no email is cut off.
+func (s *AuthServiceImpl) Wait() {
+	s.background.Wait()
+}
+
+func (s *AuthServiceImpl) logError(msg string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Error(msg, args...)
+	}
 }
 
 // Register creates a new user with hashed password.
 func (s *AuthServiceImpl) Register(ctx context.Context, firstName, lastName, email, password string) (*User, error) {
+	open, err := s.RegistrationOpen(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !open {
+		return nil, ErrRegistrationClosed
+	}
+
 	existing, _ := s.Repo.GetByEmail(ctx, email)
 	if existing != nil {
-		return nil, errors.New("email already in use")
+		return nil, ErrEmailInUse
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashed, err := s.hashNewPassword(password)
 	if err != nil {
 		return nil, err
 	}
@@ -28,7 +149,7 @@ func (s *AuthServiceImpl) Register(ctx context.Context, firstName, lastName, ema
 		FirstName: firstName,
 		LastName:  lastName,
 		Email:     email,
-		Password:  string(hashed),
+		Password:  hashed,
 	}
 
 	if err := s.Repo.Create(ctx, user); err != nil {
@@ -39,32 +160,254 @@ func (s *AuthServiceImpl) Register(ctx context.Context, firstName, lastName, ema
 }
 
 // Login checks the email and password match.
-func (s *AuthServiceImpl) Login(ctx context.Context, email, password string) (*User, error) {
+func (s *AuthServiceImpl) Login(ctx context.Context, email, password, ip string) (*User, error) {
+	if err := s.checkLoginThrottle(ctx, email, ip); err != nil {
+		return nil, err
+	}
+
 	user, err := s.Repo.GetByEmail(ctx, email)
-	if err != nil || user == nil {
-		return nil, errors.New("invalid email or password")
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	var ok, rehash bool
+	if user != nil && user.Password != "" {
+		ok, rehash, err = s.Passwords.Verify(user.Password, password)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Unknown emails and password-less (SSO only) accounts still pay for
+		// one hash so timing does not reveal which accounts exist.
+		if _, err := s.Passwords.Hash(password); err != nil {
+			return nil, err
+		}
+	}
+
+	if !ok {
+		if err := s.recordLoginFailure(ctx, email, ip, user); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	// With 2FA on, the password alone does not end the attempt: failures
+	// stay counted until CompleteSecondFactor succeeds, so fresh challenges
+	// cannot be used to reset the TOTP guess budget.
+	twoFactor, err := s.TwoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !twoFactor {
+		if err := s.Repo.ClearLoginFailures(ctx, accountThrottleKey(email)); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid email or password")
+	// Upgrade legacy or outdated hashes while the plain password is at hand.
+	// Failing to do so must not block the sign-in; the next one retries.
+	if rehash {
+		if hashed, err := s.Passwords.Hash(password); err == nil {
+			_ = s.Repo.UpdatePassword(ctx, user.ID, hashed)
+		}
+	}
+
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
 	}
 
 	return user, nil
 }
 
+// hashNewPassword enforces PasswordPolicy and hashes password. Policy
+// failures are returned as *password.PolicyError.
+func (s *AuthServiceImpl) hashNewPassword(plain string) (string, error) {
+	if s.PasswordPolicy != nil {
+		if err := s.PasswordPolicy.Check(plain); err != nil {
+			return "", err
+		}
+	}
+	return s.Passwords.Hash(plain)
+}
+
 // Logout is currently a no-op.
 func (s *AuthServiceImpl) Logout(ctx context.Context) error {
 	return nil
 }
 
-func (s *AuthServiceImpl) CreateUserOAuth(ctx context.Context, firstName, lastName, email string) (*User, error) {
-	return s.Repo.CreateUserOAuth(ctx, firstName, lastName, email)
-}
-
+// GetUserByID loads a user together with their studio, group and
+// permissions in the request's studio (see activeMembership). Users who are
+// not a member there come back without them.
 func (s *AuthServiceImpl) GetUserByID(ctx context.Context, id int32) (*User, error) {
-	return s.Repo.GetByID(ctx, id)
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	m, perms, err := s.activeMembership(ctx, id)
+	if err != nil && !errors.Is(err, tenant.ErrNotMember) {
+		return nil, err
+	}
+	if m != nil {
+		user.Studio = &m.Studio
+		user.GroupID = m.GroupID
+		user.Group = m.Group
+	}
+	user.Permissions = perms
+	if user.Permissions == nil {
+		user.Permissions = []string{}
+	}
+	return user, nil
 }
 
 func (s *AuthServiceImpl) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	return s.Repo.GetByEmail(ctx, email)
 }
+
+// RequestPasswordReset emails a single-use reset link if the address belongs
+// to an account. Unknown addresses and addresses over their limit return
+// nil so callers cannot probe which emails are registered; only the per-IP
+// limit surfaces, as a *LoginThrottledError. The link is created and sent
+// off the request path so response times do not tell them apart either.
+func (s *AuthServiceImpl) RequestPasswordReset(ctx context.Context, email, ip string) error {
+	since := time.Now().Add(-s.PasswordResetLimits.Window)
+
+	requests, err := s.Repo.RecordAttempt(ctx, "reset-ip:"+ip, since)
+	if err != nil {
+		return err
+	}
+	if s.PasswordResetLimits.MaxPerIP > 0 && requests > s.PasswordResetLimits.MaxPerIP {
+		return &LoginThrottledError{RetryAfter: s.PasswordResetLimits.Window}
+	}
+
+	requests, err = s.Repo.RecordAttempt(ctx, "reset-account:"+strings.ToLower(strings.TrimSpace(email)), since)
+	if err != nil {
+		return err
+	}
+	if s.PasswordResetLimits.MaxPerAccount > 0 && requests > s.PasswordResetLimits.MaxPerAccount {
+		return nil
+	}
+
+	user, err := s.Repo.GetByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && user == nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.goBackground(ctx, func(ctx context.Context) {
+		if err := s.sendPasswordReset(ctx, user); err != nil {
+			s.logError("Failed to send password reset", "err", err, "user_id", user.ID)
+		}
+	})
+	return nil
+}
+
+// sendPasswordReset stores a reset token for user and emails them the link.
+// It runs off the request path.
+func (s *AuthServiceImpl) sendPasswordReset(ctx context.Context, user *User) error {
+	raw, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.Repo.CreatePasswordReset(ctx, user.ID, hash, time.Now().Add(s.PasswordResetTTL)); err != nil {
+		return err
+	}
+
+	link := s.FrontendURL + "/reset-password?token=" + url.QueryEscape(raw)
+
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Sabiflow password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nSomeone asked to reset the password for your Sabiflow account.\n"+
+				"Use the link below within %s to choose a new one:\n\n%s\n\n"+
+				"If this wasn't you, you can ignore this email.\n",
+			user.FirstName, s.PasswordResetTTL, link,
+		),
+	})
+}
+
+// ResetPassword consumes a reset token and sets a new password. It returns
+// the affected user's ID so the caller can revoke their sessions.
+func (s *AuthServiceImpl) ResetPassword(ctx context.Context, token, password string) (int32, error) {
+	// Check the new password before spending the token so a rejected one
+	// can be retried with the same link.
+	hashed, err := s.hashNewPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := s.Repo.ConsumePasswordReset(ctx, hashToken(token))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.Repo.UpdatePassword(ctx, userID, hashed); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// SendEmailVerification emails the user a link proving they own their
+// address. It is a no-op for users who are already verified.
+func (s *AuthServiceImpl) SendEmailVerification(ctx context.Context, user *User) error {
+	if user.EmailVerified() {
+		return nil
+	}
+
+	raw, hash, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.Repo.CreateEmailVerification(ctx, user.ID, user.Email, hash, time.Now().Add(s.EmailVerificationTTL)); err != nil {
+		return fmt.Errorf("store email verification: %w", err)
+	}
+
+	link := s.FrontendURL + "/verify-email?token=" + url.QueryEscape(raw)
+
+	return s.Mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email for Sabiflow",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm this is your email address by opening the link below:\n\n%s\n\n"+
+				"The link expires in %s.\n",
+			user.FirstName, link, s.EmailVerificationTTL,
+		),
+	})
+}
+
+// VerifyEmail consumes a verification token and marks the address verified.
+func (s *AuthServiceImpl) VerifyEmail(ctx context.Context, token string) (int32, error) {
+	userID, email, err := s.Repo.ConsumeEmailVerification(ctx, hashToken(token))
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	if err := s.Repo.MarkEmailVerified(ctx, userID, email); err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
+
+// MarkEmailVerified records that a trusted party (e.g. an OAuth provider)
+// has verified the user's current address.
+func (s *AuthServiceImpl) MarkEmailVerified(ctx context.Context, user *User) error {
+	if user.EmailVerified() {
+		return nil
+	}
+	if err := s.Repo.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+		return err
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return nil
+}
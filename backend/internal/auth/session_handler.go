@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+)
+
+// CSRFTokenHandler returns the token the SPA must send in the X-CSRF-Token
+// header with unsafe requests. It is also set in the readable csrf_token
+// cookie, which is refreshed on sign-in and sign-out.
+func (h *AuthHandler) CSRFTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := h.SessionManager.CSRFToken(w, r)
+	if err != nil {
+		errResp := errors.Internal("Failed to issue CSRF token")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	response.WriteJSON(w, http.StatusOK, "CSRF token", map[string]any{"csrfToken": token})
+}
+
+// ListSessionsHandler returns the caller's active sessions ("devices").
+func (h *AuthHandler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := h.SessionManager.ListForUser(r, userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to list sessions")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Sessions", map[string]any{"sessions": list})
+}
+
+// RevokeSessionHandler signs the caller out of one of their own sessions.
+func (h *AuthHandler) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		errResp := errors.BadRequest("Invalid session id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	h.revokeSession(w, r, userID, sessionID)
+}
+
+// RevokeOtherSessionsHandler signs the caller out everywhere except here.
+func (h *AuthHandler) RevokeOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := h.SessionManager.RevokeOthers(r, userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to revoke sessions")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Signed out of other sessions", map[string]any{"revoked": n})
+}
+
+// AdminListSessionsHandler lists any user's sessions (users.manage).
+func (h *AuthHandler) AdminListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := h.SessionManager.ListForUser(r, userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to list sessions")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Sessions", map[string]any{"sessions": list})
+}
+
+// AdminRevokeSessionHandler revokes one session of any user (users.manage).
+func (h *AuthHandler) AdminRevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := strconv.ParseInt(chi.URLParam(r, "sessionID"), 10, 64)
+	if err != nil {
+		errResp := errors.BadRequest("Invalid session id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	h.revokeSession(w, r, userID, sessionID)
+}
+
+// AdminRevokeAllSessionsHandler signs a user out of every device (users.manage).
+func (h *AuthHandler) AdminRevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := h.SessionManager.RevokeAll(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to revoke sessions")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Signed out of all sessions", map[string]any{"revoked": n})
+}
+
+func (h *AuthHandler) revokeSession(w http.ResponseWriter, r *http.Request, userID int32, sessionID int64) {
+	found, err := h.SessionManager.Revoke(r.Context(), userID, sessionID)
+	if err != nil {
+		errResp := errors.Internal("Failed to revoke session")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("Session not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Session revoked", nil)
+}
+
+// userIDParam reads the {userID} URL parameter used by admin routes,
+// writing a 400 and returning false when it is not a valid ID.
+func userIDParam(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 32)
+	if err != nil || id <= 0 {
+		errResp := errors.BadRequest("Invalid user id")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return 0, false
+	}
+	return int32(id), true
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// ListStudiosHandler returns the studios the signed-in user belongs to and
+// the one this request acts in.
+func (h *AuthHandler) ListStudiosHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := middleware.PrincipalFrom(r.Context())
+	if !ok {
+		errResp := errors.Unauthorized("unauthorised")
+		response.WriteJSON(w, errResp.Code, errResp.Message, nil)
+		return
+	}
+
+	studios, err := h.Service.ListStudios(r.Context(), p.UserID)
+	if err != nil {
+		errResp := errors.Internal("Failed to list studios")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Studios", map[string]any{
+		"studios": studios,
+		"active":  p.Studio,
+	})
+}
+
+// SwitchStudioHandler makes {"studioId": n} the user's default studio, used
+// whenever a request does not name one.
+func (h *AuthHandler) SwitchStudioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		StudioID int32 `json:"studioId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	membership, err := h.Service.SwitchStudio(r.Context(), userID, input.StudioID)
+	switch {
+	case stdErrors.Is(err, ErrNotStudioMember):
+		errResp := errors.NotFound("Studio not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		errResp := errors.Internal("Failed to switch studio")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Studio switched", map[string]any{"studio": membership})
+}
+
+// CreateStudioHandler adds a studio owned by the caller.
+func (h *AuthHandler) CreateStudioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("name", input.Name)
+	v.Require("slug", input.Slug)
+	v.MatchPattern("slug", input.Slug, validators.SlugRX, "Must be lowercase letters, numbers and dashes")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	studio, err := h.Service.CreateStudio(r.Context(), userID, input.Slug, input.Name)
+	switch {
+	case stdErrors.Is(err, ErrStudioSlugTaken):
+		errResp := errors.Conflict("A studio with this slug already exists")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	case err != nil:
+		errResp := errors.Internal("Failed to create studio")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "Studio created", map[string]any{"studio": studio})
+}
+
+// AdminAddMemberHandler invites an existing account to the active studio
+// with {"email": "...", "groupId": n}. They join once they accept from
+// their own session; new people are invited with InviteUserHandler.
+func (h *AuthHandler) AdminAddMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Email         string `json:"email"`
+		GroupID       int32  `json:"groupId"`
+		ExpiresInDays int    `json:"expiresInDays"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("email", input.Email)
+	v.MatchPattern("email", input.Email, validators.EmailRX, "Must be a valid email address")
+	v.Check("groupId", input.GroupID > 0, "Must be a permission group")
+	v.Check("expiresInDays", input.ExpiresInDays >= 0 && input.ExpiresInDays <= maxInvitationDays, "Must be 30 days or fewer")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	inviter, err := h.Service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to load user")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	ttl := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	inv, err := h.Service.AddStudioMember(r.Context(), inviter, input.Email, input.GroupID, ttl)
+	if stdErrors.Is(err, ErrGroupNotGrantable) {
+		errResp := errors.Forbidden("You cannot invite into a group with permissions you do not hold")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusCreated, "Invitation sent", map[string]any{"invitation": inv})
+}
+
+// AdminRemoveMemberHandler takes a user out of the active studio without
+// deleting their account.
+func (h *AuthHandler) AdminRemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.RemoveStudioMember(r.Context(), userID); err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Member removed", nil)
+}
+
+// RequireStudioMember is middleware for /admin/users/{userID} routes: users
+// outside the active studio are reported as not found, so one studio's
+// admins cannot see or change another studio's people.
+func (h *AuthHandler) RequireStudioMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := userIDParam(w, r)
+		if !ok {
+			return
+		}
+
+		member, err := h.Service.IsStudioMember(r.Context(), userID)
+		if err != nil {
+			errResp := errors.Internal("Failed to load user")
+			response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+			return
+		}
+		if !member {
+			errResp := errors.NotFound("User not found")
+			response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
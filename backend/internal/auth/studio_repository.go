@@ -0,0 +1,228 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// StudioRepository manages auth.studios and the per-studio memberships in
+// auth.studio_members. Methods without a studio argument act on the active
+// studio in ctx.
+type StudioRepository interface {
+	CreateStudio(ctx context.Context, slug, name string, ownerID int32) (*tenant.Studio, error)
+	GetMembership(ctx context.Context, userID int32, slug string) (*Membership, error)
+	ListMemberships(ctx context.Context, userID int32) ([]Membership, error)
+	CountMemberships(ctx context.Context, userID int32) (int64, error)
+	GetMemberPermissions(ctx context.Context, studioID, userID int32) ([]string, error)
+	SetDefaultStudio(ctx context.Context, userID, studioID int32) (bool, error)
+	AddMember(ctx context.Context, studioID, userID int32, groupID *int32) (bool, error)
+	IsMember(ctx context.Context, userID int32) (bool, error)
+	RemoveMember(ctx context.Context, userID int32) (bool, error)
+}
+
+// Membership is a user's place in one studio.
+type Membership struct {
+	tenant.Studio
+	// GroupID and Group name the user's permission group in the studio;
+	// GroupID is nil for members without one.
+	GroupID  *int32    `json:"groupId"`
+	Group    *string   `json:"group"`
+	JoinedAt time.Time `json:"joinedAt"`
+}
+
+const (
+	membershipColumns = `s.id, s.slug, s.name, m.group_id, pg.name, m.joined_at`
+	membershipFrom    = `auth.studio_members m
+		JOIN auth.studios s ON s.id = m.studio_id
+		LEFT JOIN auth.permission_groups pg ON pg.id = m.group_id`
+)
+
+func scanMembership(row pgx.Row) (*Membership, error) {
+	var m Membership
+	if err := row.Scan(&m.ID, &m.Slug, &m.Name, &m.GroupID, &m.Group, &m.JoinedAt); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// CreateStudio adds a studio with its own system Admin group holding every
+// permission, and makes ownerID its first Admin, in a single statement.
+func (r *PgxUserRepository) CreateStudio(ctx context.Context, slug, name string, ownerID int32) (*tenant.Studio, error) {
+	query := `
+		WITH studio AS (
+			INSERT INTO auth.studios (slug, name)
+			VALUES (@slug, @name)
+			RETURNING id, slug, name
+		), admin AS (
+			INSERT INTO auth.permission_groups (studio_id, name, description, is_system)
+			SELECT id, @admin, 'Full access to everything', true FROM studio
+			RETURNING id
+		), grants AS (
+			INSERT INTO auth.group_permissions (group_id, permission_id)
+			SELECT admin.id, p.id FROM admin, auth.permissions p
+		), owner AS (
+			INSERT INTO auth.studio_members (studio_id, user_id, group_id)
+			SELECT studio.id, @owner_id, admin.id FROM studio, admin
+		)
+		SELECT id, slug, name FROM studio
+	`
+
+	args := pgx.NamedArgs{
+		"slug":     slug,
+		"name":     name,
+		"admin":    adminGroupName,
+		"owner_id": ownerID,
+	}
+
+	var s tenant.Studio
+	if err := r.DB.QueryRow(ctx, query, args).Scan(&s.ID, &s.Slug, &s.Name); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetMembership returns the user's membership in the studio with slug. An
+// empty slug picks their default studio, falling back to the one they
+// joined first. pgx.ErrNoRows means no such membership.
+func (r *PgxUserRepository) GetMembership(ctx context.Context, userID int32, slug string) (*Membership, error) {
+	query := `
+		SELECT ` + membershipColumns + `
+		FROM ` + membershipFrom + `
+		JOIN auth.users u ON u.id = m.user_id
+		WHERE m.user_id = @user_id AND (@slug = '' OR s.slug = @slug)
+		ORDER BY s.id IS NOT DISTINCT FROM u.default_studio_id DESC, m.joined_at, s.id
+		LIMIT 1
+	`
+
+	return scanMembership(r.DB.QueryRow(ctx, query, pgx.NamedArgs{"user_id": userID, "slug": slug}))
+}
+
+func (r *PgxUserRepository) ListMemberships(ctx context.Context, userID int32) ([]Membership, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+membershipColumns+`
+		FROM `+membershipFrom+`
+		WHERE m.user_id = @user_id
+		ORDER BY s.name, s.id
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Membership{}
+	for rows.Next() {
+		m, err := scanMembership(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *m)
+	}
+	return list, rows.Err()
+}
+
+func (r *PgxUserRepository) CountMemberships(ctx context.Context, userID int32) (int64, error) {
+	var n int64
+	err := r.DB.QueryRow(ctx, `
+		SELECT count(*) FROM auth.studio_members WHERE user_id = @user_id
+	`, pgx.NamedArgs{"user_id": userID}).Scan(&n)
+	return n, err
+}
+
+// GetMemberPermissions returns the permission codes of the user's group in
+// studioID.
+func (r *PgxUserRepository) GetMemberPermissions(ctx context.Context, studioID, userID int32) ([]string, error) {
+	query := `
+		SELECT p.code
+		FROM auth.studio_members m
+		JOIN auth.group_permissions gp ON gp.group_id = m.group_id
+		JOIN auth.permissions p ON p.id = gp.permission_id
+		WHERE m.studio_id = @studio_id AND m.user_id = @user_id
+	`
+
+	args := pgx.NamedArgs{
+		"studio_id": studioID,
+		"user_id":   userID,
+	}
+
+	rows, err := r.DB.Query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var perms []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		perms = append(perms, code)
+	}
+
+	return perms, rows.Err()
+}
+
+// SetDefaultStudio makes studioID the user's default. It reports false when
+// they are not a member of it.
+func (r *PgxUserRepository) SetDefaultStudio(ctx context.Context, userID, studioID int32) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE auth.users u
+		SET default_studio_id = @studio_id, updated_at = now()
+		WHERE u.id = @user_id AND EXISTS (
+			SELECT 1 FROM auth.studio_members m
+			WHERE m.studio_id = @studio_id AND m.user_id = u.id
+		)
+	`, pgx.NamedArgs{"user_id": userID, "studio_id": studioID})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// AddMember puts the user into studioID with groupID. It reports false when
+// they are already a member.
+func (r *PgxUserRepository) AddMember(ctx context.Context, studioID, userID int32, groupID *int32) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		INSERT INTO auth.studio_members (studio_id, user_id, group_id)
+		VALUES (@studio_id, @user_id, @group_id)
+		ON CONFLICT DO NOTHING
+	`, pgx.NamedArgs{"studio_id": studioID, "user_id": userID, "group_id": groupID})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// IsMember reports whether the user belongs to the active studio.
+func (r *PgxUserRepository) IsMember(ctx context.Context, userID int32) (bool, error) {
+	args := pgx.NamedArgs{"user_id": userID}
+	scope, err := tenant.Where(ctx, "m", args)
+	if err != nil {
+		return false, err
+	}
+
+	var member bool
+	err = r.DB.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM auth.studio_members m WHERE m.user_id = @user_id AND `+scope+`)
+	`, args).Scan(&member)
+	return member, err
+}
+
+// RemoveMember takes the user out of the active studio.
+func (r *PgxUserRepository) RemoveMember(ctx context.Context, userID int32) (bool, error) {
+	args := pgx.NamedArgs{"user_id": userID}
+	scope, err := tenant.Where(ctx, "m", args)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM auth.studio_members m WHERE m.user_id = @user_id AND `+scope, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
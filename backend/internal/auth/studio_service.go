@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrStudioSlugTaken = errors.New("studio slug already in use")
+	ErrNotStudioMember = errors.New("not a member of this studio")
+	ErrAlreadyMember   = errors.New("user is already a member of this studio")
+	ErrSharedAccount   = errors.New("user also belongs to other studios")
+)
+
+// CreateStudio adds a studio owned by ownerID, who becomes a member of its
+// new Admin group.
+func (s *AuthServiceImpl) CreateStudio(ctx context.Context, ownerID int32, slug, name string) (*tenant.Studio, error) {
+	studio, err := s.Repo.CreateStudio(ctx, strings.ToLower(slug), strings.TrimSpace(name), ownerID)
+	if isUniqueViolation(err) {
+		return nil, ErrStudioSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Principals.Forget(ownerID)
+	return studio, nil
+}
+
+// ListStudios returns every studio the user belongs to.
+func (s *AuthServiceImpl) ListStudios(ctx context.Context, userID int32) ([]Membership, error) {
+	return s.Repo.ListMemberships(ctx, userID)
+}
+
+// SwitchStudio makes studioID the studio used when a request names none.
+func (s *AuthServiceImpl) SwitchStudio(ctx context.Context, userID, studioID int32) (*Membership, error) {
+	ok, err := s.Repo.SetDefaultStudio(ctx, userID, studioID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotStudioMember
+	}
+	s.Principals.Forget(userID)
+
+	return s.membershipIn(ctx, userID, studioID)
+}
+
+// membershipIn returns userID's membership in studioID.
+func (s *AuthServiceImpl) membershipIn(ctx context.Context, userID, studioID int32) (*Membership, error) {
+	memberships, err := s.Repo.ListMemberships(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range memberships {
+		if m.ID == studioID {
+			return &m, nil
+		}
+	}
+	return nil, ErrNotStudioMember
+}
+
+// IsStudioMember reports whether userID belongs to the active studio.
+func (s *AuthServiceImpl) IsStudioMember(ctx context.Context, userID int32) (bool, error) {
+	return s.Repo.IsMember(ctx, userID)
+}
+
+// AddStudioMember invites an existing account into the active studio with
+// groupID. The user joins only once they accept with JoinStudio; a zero
+// ttl uses InvitationTTL. New people are invited with InviteUser instead.
+func (s *AuthServiceImpl) AddStudioMember(ctx context.Context, inviter *User, email string, groupID int32, ttl time.Duration) (*Invitation, error) {
+	email = strings.TrimSpace(email)
+	user, err := s.Repo.GetByEmail(ctx, email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	member, err := s.Repo.IsMember(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member {
+		return nil, ErrAlreadyMember
+	}
+	if err := s.ensureGrantable(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	return s.sendInvitation(ctx, inviter, user.Email, groupID, ttl, true)
+}
+
+// RemoveStudioMember takes userID out of the active studio, refusing to
+// remove its last active Admin. The account itself is kept.
+func (s *AuthServiceImpl) RemoveStudioMember(ctx context.Context, userID int32) error {
+	if err := s.ensureNotLastAdmin(ctx, userID); err != nil {
+		return err
+	}
+
+	found, err := s.Repo.RemoveMember(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	s.Principals.Forget(userID)
+	return nil
+}
+
+// activeMembership returns the user's membership in the request's studio:
+// the active one, else the one the request asked for, else their default.
+// It returns tenant.ErrNotMember when the request named a studio the user
+// does not belong to, and a nil membership when they belong to none.
+func (s *AuthServiceImpl) activeMembership(ctx context.Context, userID int32) (*Membership, []string, error) {
+	slug := requestedStudio(ctx)
+
+	m, err := s.Repo.GetMembership(ctx, userID, slug)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if slug != "" {
+			return nil, nil, tenant.ErrNotMember
+		}
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	perms, err := s.Repo.GetMemberPermissions(ctx, m.ID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, perms, nil
+}
+
+// requestedStudio is the slug of the active studio, else the one the
+// request asked for; "" means the user's default.
+func requestedStudio(ctx context.Context) string {
+	if studio, ok := tenant.From(ctx); ok {
+		return studio.Slug
+	}
+	return tenant.Slug(ctx)
+}
+
+// ensureSoleStudio returns ErrSharedAccount when userID also belongs to
+// studios other than the active one. Account-wide actions (editing,
+// disabling, deleting, impersonating) would otherwise reach into studios
+// the caller does not administer.
+func (s *AuthServiceImpl) ensureSoleStudio(ctx context.Context, userID int32) error {
+	n, err := s.Repo.CountMemberships(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if n > 1 {
+		return ErrSharedAccount
+	}
+	return nil
+}
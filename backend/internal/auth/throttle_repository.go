@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ThrottleRepository keeps failed sign-in counters in auth.login_throttle so
+// every instance behind the load balancer sees the same numbers. Keys are
+// "<kind>:<value>"; other rate limits (magic-link requests) count with
+// RecordAttempt under their own kinds.
+type ThrottleRepository interface {
+	LoginLockedUntil(ctx context.Context, keys []string) (*time.Time, error)
+	RecordLoginFailure(ctx context.Context, key string, since time.Time) (int, error)
+	RecordAttempt(ctx context.Context, key string, since time.Time) (int, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ClearLoginFailures(ctx context.Context, key string) error
+}
+
+// LoginLockedUntil returns the latest lockout still in force for any of
+// keys, or nil when none is.
+func (r *PgxUserRepository) LoginLockedUntil(ctx context.Context, keys []string) (*time.Time, error) {
+	var until *time.Time
+	err := r.DB.QueryRow(ctx, `
+		SELECT max(locked_until) FROM auth.login_throttle
+		WHERE key = ANY(@keys) AND locked_until > now()
+	`, pgx.NamedArgs{"keys": keys}).Scan(&until)
+	return until, err
+}
+
+// RecordLoginFailure counts a failed sign-in against key and returns the new
+// total; see RecordAttempt.
+func (r *PgxUserRepository) RecordLoginFailure(ctx context.Context, key string, since time.Time) (int, error) {
+	return r.RecordAttempt(ctx, key, since)
+}
+
+// RecordAttempt counts one rate-limited action against key and returns the
+// new total. Counters whose last attempt is older than since start again
+// from one, and stale rows for other keys of the same kind are pruned in
+// the same statement (kinds may use different windows).
+func (r *PgxUserRepository) RecordAttempt(ctx context.Context, key string, since time.Time) (int, error) {
+	query := `
+		WITH pruned AS (
+			DELETE FROM auth.login_throttle
+			WHERE key <> @key AND last_failure_at < @since
+			  AND split_part(key, ':', 1) = split_part(@key, ':', 1)
+			  AND (locked_until IS NULL OR locked_until < now())
+		)
+		INSERT INTO auth.login_throttle (key, failures, last_failure_at)
+		VALUES (@key, 1, now())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE
+				WHEN auth.login_throttle.last_failure_at < @since THEN 1
+				ELSE auth.login_throttle.failures + 1
+			END,
+			last_failure_at = now()
+		RETURNING failures
+	`
+
+	var attempts int
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"key": key, "since": since}).Scan(&attempts)
+	return attempts, err
+}
+
+func (r *PgxUserRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.login_throttle SET locked_until = @until WHERE key = @key
+	`, pgx.NamedArgs{"key": key, "until": until})
+	return err
+}
+
+func (r *PgxUserRepository) ClearLoginFailures(ctx context.Context, key string) error {
+	_, err := r.DB.Exec(ctx, `
+		DELETE FROM auth.login_throttle WHERE key = @key
+	`, pgx.NamedArgs{"key": key})
+	return err
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+)
+
+// memThrottle is an in-memory ThrottleRepository for fakes to embed. It
+// ignores the window: every attempt counts.
+type memThrottle struct {
+	UserRepository
+
+	mu       sync.Mutex
+	attempts map[string]int
+	locks    map[string]time.Time
+}
+
+func newMemThrottle() *memThrottle {
+	return &memThrottle{attempts: map[string]int{}, locks: map[string]time.Time{}}
+}
+
+func (m *memThrottle) LoginLockedUntil(_ context.Context, keys []string) (*time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var latest *time.Time
+	for _, k := range keys {
+		if until, ok := m.locks[k]; ok && until.After(time.Now()) && (latest == nil || until.After(*latest)) {
+			latest = &until
+		}
+	}
+	return latest, nil
+}
+
+func (m *memThrottle) RecordLoginFailure(ctx context.Context, key string, since time.Time) (int, error) {
+	return m.RecordAttempt(ctx, key, since)
+}
+
+func (m *memThrottle) RecordAttempt(_ context.Context, key string, _ time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts[key]++
+	return m.attempts[key], nil
+}
+
+func (m *memThrottle) LockLogin(_ context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.locks[key] = until
+	return nil
+}
+
+func (m *memThrottle) ClearLoginFailures(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	delete(m.locks, key)
+	return nil
+}
+
+func (m *memThrottle) count(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.attempts[key]
+}
+
+func TestLockoutFor(t *testing.T) {
+	throttle := LoginThrottle{Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+
+	want := []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute,
+		10 * time.Minute, 10 * time.Minute, 10 * time.Minute,
+	}
+	for extra, d := range want {
+		if got := throttle.lockoutFor(extra); got != d {
+			t.Errorf("lockoutFor(%d) = %s, want %s", extra, got, d)
+		}
+	}
+	if got := throttle.lockoutFor(1000); got != 10*time.Minute {
+		t.Errorf("lockoutFor(1000) = %s, want the cap", got)
+	}
+
+	// Without a cap the lockout stays fixed rather than growing unbounded.
+	fixed := LoginThrottle{Lockout: time.Minute}
+	if got := fixed.lockoutFor(3); got != time.Minute {
+		t.Errorf("lockoutFor(3) without MaxLockout = %s, want 1m", got)
+	}
+}
+
+func TestRecordLoginFailure(t *testing.T) {
+	repo := newMemThrottle()
+	mailer := mail.NewMemorySender()
+	s := &AuthServiceImpl{
+		Repo:   repo,
+		Mailer: mailer,
+		LoginThrottle: LoginThrottle{
+			MaxAttempts:   3,
+			IPMaxAttempts: 5,
+			Window:        time.Hour,
+			Lockout:       time.Minute,
+			MaxLockout:    time.Hour,
+		},
+	}
+	ctx := context.Background()
+	user := &User{ID: 1, FirstName: "Ada", Email: "ada@example.com"}
+
+	for i := 1; i <= 2; i++ {
+		if err := s.recordLoginFailure(ctx, "Ada@Example.com", "198.51.100.1", user); err != nil {
+			t.Fatalf("failure %d: %v", i, err)
+		}
+	}
+	if err := s.checkLoginThrottle(ctx, "ada@example.com", "198.51.100.1"); err != nil {
+		t.Fatalf("locked before the limit: %v", err)
+	}
+
+	// The third failure locks the account for Lockout, then each further
+	// one doubles it.
+	var throttled *LoginThrottledError
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		err := s.recordLoginFailure(ctx, "ada@example.com", "198.51.100.1", user)
+		if !errors.As(err, &throttled) {
+			t.Fatalf("failure %d: err = %v, want LoginThrottledError", i+3, err)
+		}
+		if d := throttled.RetryAfter; d > want || d < want-time.Second {
+			t.Fatalf("failure %d: RetryAfter = %s, want %s", i+3, d, want)
+		}
+	}
+
+	// Locked by account, so a different IP is refused too.
+	if err := s.checkLoginThrottle(ctx, "ada@example.com", "203.0.113.9"); !errors.As(err, &throttled) {
+		t.Fatalf("account lock ignored from another IP: %v", err)
+	}
+	// The IP has failed five times, which locks it for other accounts.
+	if err := s.checkLoginThrottle(ctx, "someone@example.com", "198.51.100.1"); !errors.As(err, &throttled) {
+		t.Fatalf("IP lock ignored for another account: %v", err)
+	}
+
+	s.Wait()
+	if n := len(mailer.Messages()); n != 1 {
+		t.Fatalf("%d lockout notices sent, want 1", n)
+	}
+}
+
+func TestRecordLoginFailureUnknownAccount(t *testing.T) {
+	var notified int
+	s := &AuthServiceImpl{
+		Repo:          newMemThrottle(),
+		LoginThrottle: LoginThrottle{MaxAttempts: 1, Window: time.Hour, Lockout: time.Minute},
+		OnLoginLocked: func(context.Context, *User, time.Time) { notified++ },
+	}
+
+	var throttled *LoginThrottledError
+	if err := s.recordLoginFailure(context.Background(), "nobody@example.com", "198.51.100.1", nil); !errors.As(err, &throttled) {
+		t.Fatalf("err = %v, want LoginThrottledError", err)
+	}
+	s.Wait()
+	if notified != 0 {
+		t.Fatal("notified about an account that does not exist")
+	}
+}
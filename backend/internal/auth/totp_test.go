@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 4226 Appendix D: HOTP values for the key "12345678901234567890".
+func TestHOTPVectors(t *testing.T) {
+	want := []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+
+	key := []byte("12345678901234567890")
+	for counter, code := range want {
+		if got := hotp(key, uint64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// RFC 6238 Appendix B, SHA-1 rows, cut to our six digits.
+func TestValidateTOTPVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		step, ok := validateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0))
+		if !ok {
+			t.Errorf("T=%d: %s rejected", tt.unix, tt.code)
+			continue
+		}
+		if want := tt.unix / totpPeriod; step != want {
+			t.Errorf("T=%d: step = %d, want %d", tt.unix, step, want)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	key, err := b32.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+
+	for offset := int64(-3); offset <= 3; offset++ {
+		code := hotp(key, uint64(step+offset))
+		got, ok := validateTOTP(rfcSecret, code, now)
+
+		if want := offset >= -totpSkew && offset <= totpSkew; ok != want {
+			t.Errorf("offset %d: accepted = %t, want %t", offset, ok, want)
+		}
+		if ok && got != step+offset {
+			t.Errorf("offset %d: step = %d, want %d", offset, got, step+offset)
+		}
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := validateTOTP(rfcSecret, code, now); ok {
+			t.Errorf("%q accepted", code)
+		}
+	}
+	if _, ok := validateTOTP("not base32!", hotp(key, uint64(step)), now); ok {
+		t.Error("code accepted for an undecodable secret")
+	}
+}
+
+func TestSecondFactorRejectsReplay(t *testing.T) {
+	s, _ := newTOTPService(t)
+	ctx := context.Background()
+	code := currentCode(t)
+
+	if err := s.verifySecondFactor(ctx, 1, code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := s.verifySecondFactor(ctx, 1, code); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("replay: err = %v, want ErrInvalidCode", err)
+	}
+}
+
+func TestRecoveryCodeNormalisation(t *testing.T) {
+	want := hashRecoveryCode("abcde-fghij")
+	for _, in := range []string{"ABCDE-FGHIJ", "abcdefghij", "abcde fghij", "AbCdE - fGhIj"} {
+		if got := hashRecoveryCode(in); got != want {
+			t.Errorf("hashRecoveryCode(%q) differs from the canonical form", in)
+		}
+	}
+	if hashRecoveryCode("abcde-fghik") == want {
+		t.Error("different codes hash alike")
+	}
+}
+
+func TestRecoveryCodesSingleUse(t *testing.T) {
+	s, _ := newTOTPService(t)
+	ctx := context.Background()
+
+	codes, err := s.issueRecoveryCodes(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	typed := " " + strings.ToUpper(codes[0]) + " "
+	if err := s.verifySecondFactor(ctx, 1, typed); err != nil {
+		t.Fatalf("recovery code %q: %v", typed, err)
+	}
+	if err := s.verifySecondFactor(ctx, 1, codes[0]); !errors.Is(err, ErrInvalidCode) {
+		t.Fatalf("reused recovery code: err = %v, want ErrInvalidCode", err)
+	}
+}
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// TwoFactorStatusHandler reports whether 2FA is on for the signed-in user.
+func (h *AuthHandler) TwoFactorStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	summary, err := h.Service.TwoFactorSummary(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to load two-factor status")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Two-factor status", map[string]any{"twoFactor": summary})
+}
+
+// TwoFactorSetupHandler starts TOTP enrolment and returns the secret and
+// otpauth:// URI for the authenticator app.
+func (h *AuthHandler) TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to load user")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	secret, uri, err := h.Service.BeginTOTPEnrolment(r.Context(), user)
+	if stdErrors.Is(err, ErrTwoFactorAlreadyEnabled) {
+		errResp := errors.BadRequest(err.Error())
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		errResp := errors.Internal("Failed to start two-factor setup")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Scan the code with your authenticator app", map[string]any{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// TwoFactorConfirmHandler finishes enrolment with the first code from the
+// app and returns the one-time recovery codes.
+func (h *AuthHandler) TwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.Service.ConfirmTOTPEnrolment(r.Context(), userID, code)
+	if err != nil {
+		h.writeTwoFactorError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Two-factor authentication enabled", map[string]any{
+		"recoveryCodes": codes,
+	})
+}
+
+// TwoFactorDisableHandler turns 2FA off after checking a current code.
+func (h *AuthHandler) TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DisableTOTP(r.Context(), userID, code, sessions.ClientIP(r)); err != nil {
+		h.writeTwoFactorError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Two-factor authentication disabled", nil)
+}
+
+// TwoFactorRecoveryCodesHandler replaces the user's recovery codes.
+func (h *AuthHandler) TwoFactorRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	code, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := h.Service.RegenerateRecoveryCodes(r.Context(), userID, code, sessions.ClientIP(r))
+	if err != nil {
+		h.writeTwoFactorError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Recovery codes regenerated", map[string]any{
+		"recoveryCodes": codes,
+	})
+}
+
+// TwoFactorVerifyHandler completes a login that is waiting on its second
+// factor, exchanging the pending token and a code for a real session.
+func (h *AuthHandler) TwoFactorVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		// PendingToken comes from /auth/login. OAuth and magic-link logins
+		// leave it empty; theirs is held in the session.
+		PendingToken string `json:"pendingToken"`
+		Code         string `json:"code"`
+		// RememberMe repeats the choice made at /auth/login.
+		RememberMe bool `json:"rememberMe"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if input.PendingToken == "" {
+		pending, err := h.SessionManager.GetString(r, pendingSecondFactorKey)
+		if err != nil {
+			errResp := errors.Internal("Failed to load login attempt")
+			response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+			return
+		}
+		input.PendingToken = pending
+	}
+
+	v := validators.New()
+	v.Require("pendingToken", input.PendingToken)
+	v.Require("code", input.Code)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	user, err := h.Service.CompleteSecondFactor(r.Context(), input.PendingToken, input.Code, sessions.ClientIP(r))
+	var throttled *LoginThrottledError
+	if stdErrors.As(err, &throttled) {
+		writeLoginThrottled(w, throttled)
+		return
+	}
+	if stdErrors.Is(err, ErrInvalidToken) {
+		_ = h.SessionManager.Remove(r, pendingSecondFactorKey)
+		errResp := errors.Unauthorized("Login attempt expired, please sign in again")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if err != nil {
+		h.writeTwoFactorError(w, err)
+		return
+	}
+
+	if err := h.SessionManager.SetUserID(w, r, user.ID, input.RememberMe); err != nil {
+		errResp := errors.Internal("Failed to set session")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Logged in", map[string]any{"user": user})
+}
+
+// AdminSetGroupTwoFactorHandler makes 2FA mandatory (or optional) for every
+// member of a permission group.
+func (h *AuthHandler) AdminSetGroupTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, ok := groupIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Required bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	found, err := h.Service.SetGroupRequire2FA(r.Context(), groupID, input.Required)
+	if err != nil {
+		errResp := errors.Internal("Failed to update group")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+	if !found {
+		errResp := errors.NotFound("Group not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Group updated", map[string]any{"require2fa": input.Required})
+}
+
+// pendingSecondFactorKey is the session data key holding the pending token
+// of an OAuth or magic-link login that is waiting on its second factor.
+const pendingSecondFactorKey = "login.pending_2fa"
+
+// redirectToSecondFactor parks pending in the browser's session and sends
+// the browser to the SPA's 2FA page. The token stays out of the URL, where
+// history, logs and Referer headers would leak it.
+func (h *AuthHandler) redirectToSecondFactor(w http.ResponseWriter, r *http.Request, pending string) error {
+	if err := h.SessionManager.Put(w, r, pendingSecondFactorKey, pending); err != nil {
+		return err
+	}
+	http.Redirect(w, r, h.FrontendURL+"/login/2fa", http.StatusSeeOther)
+	return nil
+}
+
+// startSecondFactorIfEnabled returns a pending token when userID has 2FA
+// turned on, or "" when the login can complete immediately.
+func (h *AuthHandler) startSecondFactorIfEnabled(r *http.Request, userID int32) (string, error) {
+	enabled, err := h.Service.TwoFactorEnabled(r.Context(), userID)
+	if err != nil || !enabled {
+		return "", err
+	}
+	return h.Service.StartSecondFactor(r.Context(), userID)
+}
+
+func (h *AuthHandler) writeTwoFactorError(w http.ResponseWriter, err error) {
+	var throttled *LoginThrottledError
+	switch {
+	case stdErrors.As(err, &throttled):
+		writeLoginThrottled(w, throttled)
+	case stdErrors.Is(err, ErrAccountDisabled):
+		writeAccountDisabled(w)
+	case stdErrors.Is(err, ErrInvalidCode),
+		stdErrors.Is(err, ErrTwoFactorNotEnabled),
+		stdErrors.Is(err, ErrTwoFactorAlreadyEnabled):
+		errResp := errors.BadRequest(err.Error())
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	default:
+		if h.Logger != nil {
+			h.Logger.Error("Two-factor operation failed", "err", err)
+		}
+		errResp := errors.Internal("Two-factor operation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	}
+}
+
+// decodeCode reads {"code": "..."} from the body, writing a 400 on failure.
+func decodeCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return "", false
+	}
+
+	v := validators.New()
+	v.Require("code", input.Code)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return "", false
+	}
+	return input.Code, true
+}
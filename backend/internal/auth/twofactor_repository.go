@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// TwoFactorRepository persists TOTP secrets, recovery codes and pending
+// second-factor challenges.
+type TwoFactorRepository interface {
+	UpsertPendingTOTP(ctx context.Context, userID int32, secretEncrypted []byte) error
+	GetTOTP(ctx context.Context, userID int32) (*TOTPRecord, error)
+	ConfirmTOTP(ctx context.Context, userID int32, step int64) error
+	AdvanceTOTPStep(ctx context.Context, userID int32, step int64) (bool, error)
+	DeleteTOTP(ctx context.Context, userID int32) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int32, hashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID int32, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int32) (int, error)
+	CreateMFAChallenge(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error
+	GetMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (int32, error)
+	RecordMFAFailure(ctx context.Context, tokenHash string) error
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+	TwoFactorStatus(ctx context.Context, userID int32) (enabled, required bool, err error)
+	SetGroupRequire2FA(ctx context.Context, groupID int32, required bool) (bool, error)
+}
+
+// TOTPRecord is a row of auth.user_totp.
+type TOTPRecord struct {
+	UserID          int32
+	SecretEncrypted []byte
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
+}
+
+// Confirmed reports whether enrolment finished and 2FA is active.
+func (t *TOTPRecord) Confirmed() bool {
+	return t.ConfirmedAt != nil
+}
+
+// UpsertPendingTOTP stores a new, unconfirmed secret. A confirmed secret is
+// never overwritten; the user must disable 2FA first.
+func (r *PgxUserRepository) UpsertPendingTOTP(ctx context.Context, userID int32, secretEncrypted []byte) error {
+	query := `
+		INSERT INTO auth.user_totp (user_id, secret_encrypted)
+		VALUES (@user_id, @secret)
+		ON CONFLICT (user_id) DO UPDATE
+			SET secret_encrypted = EXCLUDED.secret_encrypted, created_at = now()
+			WHERE auth.user_totp.confirmed_at IS NULL
+	`
+
+	args := pgx.NamedArgs{
+		"user_id": userID,
+		"secret":  secretEncrypted,
+	}
+
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
+
+func (r *PgxUserRepository) GetTOTP(ctx context.Context, userID int32) (*TOTPRecord, error) {
+	query := `
+		SELECT user_id, secret_encrypted, confirmed_at, last_used_step
+		FROM auth.user_totp
+		WHERE user_id = @user_id
+	`
+
+	var t TOTPRecord
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"user_id": userID}).Scan(
+		&t.UserID,
+		&t.SecretEncrypted,
+		&t.ConfirmedAt,
+		&t.LastUsedStep,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PgxUserRepository) ConfirmTOTP(ctx context.Context, userID int32, step int64) error {
+	query := `
+		UPDATE auth.user_totp
+		SET confirmed_at = now(), last_used_step = @step
+		WHERE user_id = @user_id
+	`
+
+	_, err := r.DB.Exec(ctx, query, pgx.NamedArgs{"user_id": userID, "step": step})
+	return err
+}
+
+// AdvanceTOTPStep records step as used. It returns false when step is not
+// newer than the last accepted one, i.e. the code is being replayed.
+func (r *PgxUserRepository) AdvanceTOTPStep(ctx context.Context, userID int32, step int64) (bool, error) {
+	query := `
+		UPDATE auth.user_totp
+		SET last_used_step = @step
+		WHERE user_id = @user_id AND last_used_step < @step
+	`
+
+	tag, err := r.DB.Exec(ctx, query, pgx.NamedArgs{"user_id": userID, "step": step})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// DeleteTOTP removes the secret and all recovery codes in one statement.
+func (r *PgxUserRepository) DeleteTOTP(ctx context.Context, userID int32) error {
+	_, err := r.DB.Exec(ctx, `
+		WITH codes AS (
+			DELETE FROM auth.recovery_codes WHERE user_id = @user_id
+		)
+		DELETE FROM auth.user_totp WHERE user_id = @user_id
+	`, pgx.NamedArgs{"user_id": userID})
+	return err
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for hashes in one
+// transaction, so a failure never leaves them without any.
+func (r *PgxUserRepository) ReplaceRecoveryCodes(ctx context.Context, userID int32, hashes []string) error {
+	return pgx.BeginFunc(ctx, r.DB, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			DELETE FROM auth.recovery_codes WHERE user_id = @user_id
+		`, pgx.NamedArgs{"user_id": userID})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO auth.recovery_codes (user_id, code_hash)
+			SELECT @user_id, unnest(@hashes::text[])
+		`, pgx.NamedArgs{
+			"user_id": userID,
+			"hashes":  hashes,
+		})
+		return err
+	})
+}
+
+// ConsumeRecoveryCode spends a recovery code, reporting whether it was valid.
+func (r *PgxUserRepository) ConsumeRecoveryCode(ctx context.Context, userID int32, hash string) (bool, error) {
+	query := `
+		UPDATE auth.recovery_codes
+		SET used_at = now()
+		WHERE user_id = @user_id AND code_hash = @code_hash AND used_at IS NULL
+	`
+
+	tag, err := r.DB.Exec(ctx, query, pgx.NamedArgs{"user_id": userID, "code_hash": hash})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgxUserRepository) CountRecoveryCodes(ctx context.Context, userID int32) (int, error) {
+	query := `
+		SELECT count(*) FROM auth.recovery_codes
+		WHERE user_id = @user_id AND used_at IS NULL
+	`
+
+	var n int
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"user_id": userID}).Scan(&n)
+	return n, err
+}
+
+func (r *PgxUserRepository) CreateMFAChallenge(ctx context.Context, userID int32, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO auth.mfa_challenges (token_hash, user_id, expires_at)
+		VALUES (@token_hash, @user_id, @expires_at)
+	`
+
+	args := pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"user_id":    userID,
+		"expires_at": expiresAt,
+	}
+
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
+
+// GetMFAChallenge returns the user behind a live challenge. Expired or
+// exhausted challenges yield pgx.ErrNoRows.
+func (r *PgxUserRepository) GetMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (int32, error) {
+	query := `
+		SELECT user_id FROM auth.mfa_challenges
+		WHERE token_hash = @token_hash AND expires_at > now() AND attempts < @max_attempts
+	`
+
+	var userID int32
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{
+		"token_hash":   tokenHash,
+		"max_attempts": maxAttempts,
+	}).Scan(&userID)
+	return userID, err
+}
+
+func (r *PgxUserRepository) RecordMFAFailure(ctx context.Context, tokenHash string) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE auth.mfa_challenges SET attempts = attempts + 1 WHERE token_hash = @token_hash
+	`, pgx.NamedArgs{"token_hash": tokenHash})
+	return err
+}
+
+func (r *PgxUserRepository) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	_, err := r.DB.Exec(ctx, `
+		DELETE FROM auth.mfa_challenges WHERE token_hash = @token_hash
+	`, pgx.NamedArgs{"token_hash": tokenHash})
+	return err
+}
+
+// TwoFactorStatus reports whether the user has active 2FA and whether the
+// permission group of any of their studio memberships requires it.
+func (r *PgxUserRepository) TwoFactorStatus(ctx context.Context, userID int32) (bool, bool, error) {
+	query := `
+		SELECT
+			EXISTS (SELECT 1 FROM auth.user_totp t WHERE t.user_id = u.id AND t.confirmed_at IS NOT NULL),
+			EXISTS (
+				SELECT 1 FROM auth.studio_members m
+				JOIN auth.permission_groups pg ON pg.id = m.group_id
+				WHERE m.user_id = u.id AND pg.require_2fa
+			)
+		FROM auth.users u
+		WHERE u.id = @user_id
+	`
+
+	var enabled, required bool
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"user_id": userID}).Scan(&enabled, &required)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, false, nil
+	}
+	return enabled, required, err
+}
+
+// SetGroupRequire2FA toggles enforcement for one of the active studio's
+// permission groups. It reports false when the group does not exist.
+func (r *PgxUserRepository) SetGroupRequire2FA(ctx context.Context, groupID int32, required bool) (bool, error) {
+	args := pgx.NamedArgs{"id": groupID, "required": required}
+	scope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE auth.permission_groups pg SET require_2fa = @required WHERE pg.id = @id AND `+scope, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxMFAAttempts is how many wrong codes a pending login may submit before
+// the user must start again with their password.
+const maxMFAAttempts = 5
+
+var (
+	ErrInvalidCode             = errors.New("invalid authentication code")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+)
+
+// TwoFactorSummary is what the settings page shows about a user's 2FA.
+type TwoFactorSummary struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recoveryCodesRemaining"`
+}
+
+// TwoFactorSummary reports the user's 2FA state.
+func (s *AuthServiceImpl) TwoFactorSummary(ctx context.Context, userID int32) (*TwoFactorSummary, error) {
+	enabled, required, err := s.Repo.TwoFactorStatus(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &TwoFactorSummary{Enabled: enabled, Required: required}
+	if enabled {
+		if summary.RecoveryCodesRemaining, err = s.Repo.CountRecoveryCodes(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// BeginTOTPEnrolment generates a new secret for user and stores it
+// encrypted but unconfirmed. It returns the secret and otpauth:// URI for
+// display as a QR code.
+func (s *AuthServiceImpl) BeginTOTPEnrolment(ctx context.Context, user *User) (string, string, error) {
+	existing, err := s.Repo.GetTOTP(ctx, user.ID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return "", "", err
+	}
+	if existing != nil && existing.Confirmed() {
+		return "", "", ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	sealed, err := s.Cipher.Encrypt([]byte(secret))
+	if err != nil {
+		return "", "", fmt.Errorf("encrypt totp secret: %w", err)
+	}
+
+	if err := s.Repo.UpsertPendingTOTP(ctx, user.ID, sealed); err != nil {
+		return "", "", err
+	}
+
+	return secret, totpURI(s.TOTPIssuer, user.Email, secret), nil
+}
+
+// ConfirmTOTPEnrolment activates 2FA once the user proves their app works
+// and returns freshly generated recovery codes. They are shown only once.
+func (s *AuthServiceImpl) ConfirmTOTPEnrolment(ctx context.Context, userID int32, code string) ([]string, error) {
+	record, err := s.Repo.GetTOTP(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Confirmed() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := s.Cipher.Decrypt(record.SecretEncrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt totp secret: %w", err)
+	}
+
+	step, ok := validateTOTP(string(secret), code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	if err := s.Repo.ConfirmTOTP(ctx, userID, step); err != nil {
+		return nil, err
+	}
+
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// DisableTOTP turns 2FA off after checking a current code or recovery code.
+func (s *AuthServiceImpl) DisableTOTP(ctx context.Context, userID int32, code, ip string) error {
+	if err := s.verifySecondFactorThrottled(ctx, userID, code, ip); err != nil {
+		return err
+	}
+	return s.Repo.DeleteTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current code.
+func (s *AuthServiceImpl) RegenerateRecoveryCodes(ctx context.Context, userID int32, code, ip string) ([]string, error) {
+	if err := s.verifySecondFactorThrottled(ctx, userID, code, ip); err != nil {
+		return nil, err
+	}
+	return s.issueRecoveryCodes(ctx, userID)
+}
+
+// verifySecondFactorThrottled is verifySecondFactor behind the login
+// throttle, so a hijacked session cannot guess codes at the management
+// endpoints faster than at /auth/2fa/verify.
+func (s *AuthServiceImpl) verifySecondFactorThrottled(ctx context.Context, userID int32, code, ip string) error {
+	user, err := s.getUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkLoginThrottle(ctx, user.Email, ip); err != nil {
+		return err
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			if terr := s.recordLoginFailure(ctx, user.Email, ip, user); terr != nil {
+				return terr
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// TwoFactorEnabled reports whether login for userID needs a second step.
+func (s *AuthServiceImpl) TwoFactorEnabled(ctx context.Context, userID int32) (bool, error) {
+	enabled, _, err := s.Repo.TwoFactorStatus(ctx, userID)
+	return enabled, err
+}
+
+// StartSecondFactor records that userID passed the first factor and returns
+// a short-lived pending token to be exchanged at /auth/2fa/verify.
+func (s *AuthServiceImpl) StartSecondFactor(ctx context.Context, userID int32) (string, error) {
+	raw, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.Repo.CreateMFAChallenge(ctx, userID, hash, time.Now().Add(s.MFAChallengeTTL)); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// CompleteSecondFactor exchanges a pending token plus a TOTP or recovery
+// code for the user, consuming the token on success. Wrong codes count as
+// failed sign-ins for the account and ip, under the same LoginThrottle as
+// passwords, and return a *LoginThrottledError once that locks.
+func (s *AuthServiceImpl) CompleteSecondFactor(ctx context.Context, pendingToken, code, ip string) (*User, error) {
+	hash := hashToken(pendingToken)
+
+	userID, err := s.Repo.GetMFAChallenge(ctx, hash, maxMFAAttempts)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	user, err := s.Repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLoginThrottle(ctx, user.Email, ip); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			_ = s.Repo.RecordMFAFailure(ctx, hash)
+			if terr := s.recordLoginFailure(ctx, user.Email, ip, user); terr != nil {
+				return nil, terr
+			}
+		}
+		return nil, err
+	}
+
+	if err := s.Repo.DeleteMFAChallenge(ctx, hash); err != nil {
+		return nil, err
+	}
+	if err := s.Repo.ClearLoginFailures(ctx, accountThrottleKey(user.Email)); err != nil {
+		return nil, err
+	}
+
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+	return user, nil
+}
+
+// SetGroupRequire2FA toggles mandatory 2FA for members of a permission group.
+func (s *AuthServiceImpl) SetGroupRequire2FA(ctx context.Context, groupID int32, required bool) (bool, error) {
+	return s.Repo.SetGroupRequire2FA(ctx, groupID, required)
+}
+
+// verifySecondFactor accepts either a 6-digit TOTP code or a recovery code.
+func (s *AuthServiceImpl) verifySecondFactor(ctx context.Context, userID int32, code string) error {
+	record, err := s.Repo.GetTOTP(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if !record.Confirmed() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+
+	if len(code) == totpDigits {
+		secret, err := s.Cipher.Decrypt(record.SecretEncrypted)
+		if err != nil {
+			return fmt.Errorf("decrypt totp secret: %w", err)
+		}
+
+		step, ok := validateTOTP(string(secret), code, time.Now())
+		if !ok {
+			return ErrInvalidCode
+		}
+
+		fresh, err := s.Repo.AdvanceTOTPStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidCode // replayed code
+		}
+		return nil
+	}
+
+	ok, err := s.Repo.ConsumeRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+func (s *AuthServiceImpl) issueRecoveryCodes(ctx context.Context, userID int32) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/encryption"
+	"github.com/iankencruz/sabiflow/internal/platform/mail"
+)
+
+// rfcSecret is the RFC 6238 SHA-1 test key, "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// totpRepo holds one confirmed TOTP enrolment for user 1.
+type totpRepo struct {
+	*memThrottle
+	secret   []byte
+	lastStep int64
+	recovery map[string]bool
+	deleted  bool
+}
+
+func (r *totpRepo) GetByID(_ context.Context, id int32) (*User, error) {
+	return &User{ID: id, FirstName: "Ada", Email: "ada@example.com"}, nil
+}
+
+func (r *totpRepo) GetTOTP(_ context.Context, userID int32) (*TOTPRecord, error) {
+	confirmed := time.Now()
+	return &TOTPRecord{UserID: userID, SecretEncrypted: r.secret, ConfirmedAt: &confirmed, LastUsedStep: r.lastStep}, nil
+}
+
+func (r *totpRepo) AdvanceTOTPStep(_ context.Context, _ int32, step int64) (bool, error) {
+	if r.lastStep >= step {
+		return false, nil
+	}
+	r.lastStep = step
+	return true, nil
+}
+
+func (r *totpRepo) ConsumeRecoveryCode(_ context.Context, _ int32, hash string) (bool, error) {
+	if !r.recovery[hash] {
+		return false, nil
+	}
+	delete(r.recovery, hash)
+	return true, nil
+}
+
+func (r *totpRepo) ReplaceRecoveryCodes(_ context.Context, _ int32, hashes []string) error {
+	r.recovery = map[string]bool{}
+	for _, h := range hashes {
+		r.recovery[h] = true
+	}
+	return nil
+}
+
+func (r *totpRepo) DeleteTOTP(context.Context, int32) error {
+	r.deleted = true
+	return nil
+}
+
+func newTOTPService(t *testing.T) (*AuthServiceImpl, *totpRepo) {
+	t.Helper()
+
+	key, err := encryption.RandomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := encryption.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := cipher.Encrypt([]byte(rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &totpRepo{memThrottle: newMemThrottle(), secret: secret, recovery: map[string]bool{}}
+	return &AuthServiceImpl{
+		Repo:   repo,
+		Cipher: cipher,
+		Mailer: mail.NewMemorySender(),
+		LoginThrottle: LoginThrottle{
+			MaxAttempts:   3,
+			IPMaxAttempts: 100,
+			Window:        time.Hour,
+			Lockout:       time.Minute,
+			MaxLockout:    time.Hour,
+		},
+	}, repo
+}
+
+// currentCode is the TOTP code for rfcSecret right now.
+func currentCode(t *testing.T) string {
+	t.Helper()
+	key, err := b32.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hotp(key, uint64(time.Now().Unix()/totpPeriod))
+}
+
+// wrongCode is a six-digit code that differs from every code accepted now.
+func wrongCode(t *testing.T) string {
+	t.Helper()
+	for _, c := range []string{"000000", "111111", "222222", "333333"} {
+		if _, ok := validateTOTP(rfcSecret, c, time.Now()); !ok {
+			return c
+		}
+	}
+	t.Fatal("no rejected code found")
+	return ""
+}
+
+func TestDisableTOTPThrottled(t *testing.T) {
+	s, repo := newTOTPService(t)
+	ctx := context.Background()
+	bad := wrongCode(t)
+
+	for i := 1; i < 3; i++ {
+		if err := s.DisableTOTP(ctx, 1, bad, "198.51.100.1"); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d: err = %v, want ErrInvalidCode", i, err)
+		}
+	}
+	var throttled *LoginThrottledError
+	if err := s.DisableTOTP(ctx, 1, bad, "198.51.100.1"); !errors.As(err, &throttled) {
+		t.Fatalf("third failure: err = %v, want LoginThrottledError", err)
+	}
+
+	// Locked out, even the right code from elsewhere is refused unchecked.
+	if err := s.DisableTOTP(ctx, 1, currentCode(t), "203.0.113.5"); !errors.As(err, &throttled) {
+		t.Fatalf("while locked: err = %v, want LoginThrottledError", err)
+	}
+	if _, err := s.RegenerateRecoveryCodes(ctx, 1, currentCode(t), "203.0.113.5"); !errors.As(err, &throttled) {
+		t.Fatalf("regenerate while locked: err = %v, want LoginThrottledError", err)
+	}
+	if repo.deleted {
+		t.Fatal("TOTP deleted while locked out")
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	s, repo := newTOTPService(t)
+
+	if err := s.DisableTOTP(context.Background(), 1, currentCode(t), "198.51.100.1"); err != nil {
+		t.Fatal(err)
+	}
+	if !repo.deleted {
+		t.Fatal("TOTP not deleted")
+	}
+	if n := repo.count(accountThrottleKey("ada@example.com")); n != 0 {
+		t.Fatalf("%d failures recorded for a valid code", n)
+	}
+}
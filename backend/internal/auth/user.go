@@ -1,6 +1,10 @@
 package auth
 
-import "time"
+import (
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+)
 
 // User represents a user entity from the auth.users table.
 type User struct {
@@ -11,4 +15,32 @@ type User struct {
 	Password  string    `json:"-"` // hashed, not exposed
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	DisabledAt      *time.Time `json:"disabledAt"`
+
+	// Timezone is an IANA zone name and Locale a BCP 47 tag; scheduling
+	// and emails use them to speak the user's time and language.
+	Timezone  string  `json:"timezone"`
+	Locale    string  `json:"locale"`
+	AvatarURL *string `json:"avatarUrl"`
+
+	// Studio, GroupID, Group and Permissions describe the user's
+	// membership in one studio. AuthService.GetUserByID fills them in for
+	// the active studio (or the user's default); other lookups leave them
+	// empty.
+	Studio      *tenant.Studio `json:"studio"`
+	GroupID     *int32         `json:"groupId"`
+	Group       *string        `json:"group"`
+	Permissions []string       `json:"permissions,omitempty"`
+}
+
+// EmailVerified reports whether the user has proven ownership of Email.
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// Disabled reports whether an administrator has switched the account off.
+func (u *User) Disabled() bool {
+	return u.DisabledAt != nil
 }
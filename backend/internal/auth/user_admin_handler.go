@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// Machine-readable reasons for admin user management refusals.
+const (
+	ReasonAccountDisabled = "account_disabled"
+	ReasonLastAdmin       = "last_admin"
+	ReasonSharedAccount   = "shared_account"
+)
+
+// AdminListUsersHandler pages through users; ?q= searches name and email,
+// ?page= and ?perPage= select the page.
+func (h *AuthHandler) AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	perPage, _ := strconv.Atoi(q.Get("perPage"))
+
+	result, err := h.Service.ListUsers(r.Context(), UserFilter{
+		Search:  q.Get("q"),
+		Page:    page,
+		PerPage: perPage,
+	})
+	if err != nil {
+		errResp := errors.Internal("Failed to list users")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Users", result)
+}
+
+// AdminGetUserHandler returns one user with their group and permissions.
+func (h *AuthHandler) AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User", map[string]any{"user": user})
+}
+
+// AdminUpdateUserHandler edits a user's name and email.
+func (h *AuthHandler) AdminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Firstname string `json:"firstName"`
+		Lastname  string `json:"lastName"`
+		Email     string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("firstName", input.Firstname)
+	v.Require("lastName", input.Lastname)
+	v.Require("email", input.Email)
+	v.MatchPattern("email", input.Email, validators.EmailRX, "Must be a valid email address")
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	user, err := h.Service.UpdateUserProfile(r.Context(), userID, input.Firstname, input.Lastname, input.Email)
+	if err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User updated", map[string]any{"user": user})
+}
+
+// AdminSetUserGroupHandler assigns {"groupId": n}, or removes the user from
+// their group with {"groupId": null}.
+func (h *AuthHandler) AdminSetUserGroupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		GroupID *int32 `json:"groupId"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	user, err := h.Service.AssignUserGroup(r.Context(), userID, input.GroupID)
+	if err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User group updated", map[string]any{"user": user})
+}
+
+// AdminDisableUserHandler blocks a user from signing in and ends all of
+// their sessions.
+func (h *AuthHandler) AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.SetUserDisabled(r.Context(), userID, true)
+	if err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	if _, err := h.SessionManager.RevokeAll(r.Context(), userID); err != nil {
+		errResp := errors.Internal("User disabled but sessions could not be revoked")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User disabled", map[string]any{"user": user})
+}
+
+// AdminEnableUserHandler lets a disabled user sign in again.
+func (h *AuthHandler) AdminEnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.SetUserDisabled(r.Context(), userID, false)
+	if err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User enabled", map[string]any{"user": user})
+}
+
+// AdminDeleteUserHandler permanently deletes a user.
+func (h *AuthHandler) AdminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.DeleteUser(r.Context(), userID); err != nil {
+		h.writeUserAdminError(w, err)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "User deleted", nil)
+}
+
+func (h *AuthHandler) writeUserAdminError(w http.ResponseWriter, err error) {
+	switch {
+	case stdErrors.Is(err, ErrUserNotFound):
+		errResp := errors.NotFound("User not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrGroupNotFound):
+		errResp := errors.BadRequest("Permission group not found")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrEmailInUse):
+		errResp := errors.Conflict("Email already in use")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrLastAdmin):
+		errResp := errors.Conflict("At least one active Admin must remain").WithReason(ReasonLastAdmin)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrSharedAccount):
+		errResp := errors.Conflict("User also belongs to other studios; remove them from this one instead").WithReason(ReasonSharedAccount)
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrUserOutranks):
+		errResp := errors.Forbidden("You cannot manage a user with permissions you do not hold")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrGroupNotGrantable):
+		errResp := errors.Forbidden("You cannot assign a group with permissions you do not hold")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	case stdErrors.Is(err, ErrAlreadyMember):
+		errResp := errors.Conflict("User is already a member of this studio")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	default:
+		if h.Logger != nil {
+			h.Logger.Error("User management failed", "err", err)
+		}
+		errResp := errors.Internal("User management failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+	}
+}
+
+// writeAccountDisabled answers a sign-in attempt by a disabled user.
+func writeAccountDisabled(w http.ResponseWriter) {
+	errResp := errors.Forbidden("This account has been disabled").WithReason(ReasonAccountDisabled)
+	response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// UserAdminRepository backs the users.manage admin API. Membership and
+// group queries act on the active studio in ctx.
+type UserAdminRepository interface {
+	ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error)
+	UpdateUserProfile(ctx context.Context, userID int32, firstName, lastName, email string) (bool, error)
+	SetMemberGroup(ctx context.Context, userID int32, groupID *int32) (bool, error)
+	SetUserDisabled(ctx context.Context, userID int32, disabled bool) (bool, error)
+	DeleteUser(ctx context.Context, userID int32) (bool, error)
+	PermissionGroupExists(ctx context.Context, groupID int32) (bool, error)
+	ActiveAdminStatus(ctx context.Context, userID int32) (isAdmin bool, activeAdmins int64, err error)
+}
+
+// UserFilter selects one page of the admin user list.
+type UserFilter struct {
+	// Search matches name or email, case-insensitively.
+	Search  string
+	Page    int
+	PerPage int
+}
+
+// adminGroupName is the permission group that must never be left empty.
+const adminGroupName = "Admin"
+
+// ListUsers returns one page of the active studio's members, each with
+// their group there.
+func (r *PgxUserRepository) ListUsers(ctx context.Context, filter UserFilter) ([]User, int64, error) {
+	args := pgx.NamedArgs{
+		"search": filter.Search,
+		"limit":  filter.PerPage,
+		"offset": (filter.Page - 1) * filter.PerPage,
+	}
+
+	scope, err := tenant.Where(ctx, "m", args)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	from := `
+		auth.studio_members m
+		JOIN auth.users u ON u.id = m.user_id
+		LEFT JOIN auth.permission_groups pg ON pg.id = m.group_id
+	`
+	where := `
+		WHERE ` + scope + ` AND (@search = ''
+			OR u.email ILIKE '%' || @search || '%'
+			OR (u.first_name || ' ' || u.last_name) ILIKE '%' || @search || '%')
+	`
+
+	var total int64
+	if err := r.DB.QueryRow(ctx, `SELECT count(*) FROM `+from+where, args).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `SELECT ` + userColumns + `, m.group_id, pg.name FROM ` + from + where + `
+		ORDER BY u.created_at, u.id
+		LIMIT @limit OFFSET @offset
+	`
+
+	rows, err := r.DB.Query(ctx, query, args)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(append(userDest(&user), &user.GroupID, &user.Group)...); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+// UpdateUserProfile changes name and email. A new email must be verified
+// again, so email_verified_at is cleared when the address changes.
+func (r *PgxUserRepository) UpdateUserProfile(ctx context.Context, userID int32, firstName, lastName, email string) (bool, error) {
+	query := `
+		UPDATE auth.users
+		SET first_name = @first_name,
+			last_name = @last_name,
+			email_verified_at = CASE WHEN email = @email THEN email_verified_at END,
+			email = @email,
+			updated_at = now()
+		WHERE id = @id
+	`
+
+	args := pgx.NamedArgs{
+		"id":         userID,
+		"first_name": firstName,
+		"last_name":  lastName,
+		"email":      email,
+	}
+
+	tag, err := r.DB.Exec(ctx, query, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// SetMemberGroup moves the user into groupID within the active studio, or
+// out of any group when nil. It reports false when they are not a member.
+func (r *PgxUserRepository) SetMemberGroup(ctx context.Context, userID int32, groupID *int32) (bool, error) {
+	args := pgx.NamedArgs{"user_id": userID, "group_id": groupID}
+	scope, err := tenant.Where(ctx, "m", args)
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE auth.studio_members m SET group_id = @group_id
+		WHERE m.user_id = @user_id AND `+scope, args)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgxUserRepository) SetUserDisabled(ctx context.Context, userID int32, disabled bool) (bool, error) {
+	query := `
+		UPDATE auth.users
+		SET disabled_at = CASE WHEN @disabled THEN COALESCE(disabled_at, now()) END,
+			updated_at = now()
+		WHERE id = @id
+	`
+
+	tag, err := r.DB.Exec(ctx, query, pgx.NamedArgs{"id": userID, "disabled": disabled})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgxUserRepository) DeleteUser(ctx context.Context, userID int32) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `DELETE FROM auth.users WHERE id = @id`, pgx.NamedArgs{"id": userID})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// PermissionGroupExists reports whether groupID is one of the active
+// studio's groups.
+func (r *PgxUserRepository) PermissionGroupExists(ctx context.Context, groupID int32) (bool, error) {
+	args := pgx.NamedArgs{"id": groupID}
+	scope, err := tenant.Where(ctx, "pg", args)
+	if err != nil {
+		return false, err
+	}
+
+	var exists bool
+	err = r.DB.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM auth.permission_groups pg WHERE pg.id = @id AND `+scope+`)
+	`, args).Scan(&exists)
+	return exists, err
+}
+
+// ActiveAdminStatus reports whether userID is an enabled member of the
+// active studio's Admin group and how many such members it has in total.
+func (r *PgxUserRepository) ActiveAdminStatus(ctx context.Context, userID int32) (bool, int64, error) {
+	args := pgx.NamedArgs{"id": userID, "admin": adminGroupName}
+	scope, err := tenant.Where(ctx, "m", args)
+	if err != nil {
+		return false, 0, err
+	}
+
+	query := `
+		SELECT
+			COALESCE(bool_or(u.id = @id), false),
+			count(*)
+		FROM auth.studio_members m
+		JOIN auth.users u ON u.id = m.user_id
+		JOIN auth.permission_groups pg ON pg.id = m.group_id
+		WHERE ` + scope + ` AND pg.name = @admin AND u.disabled_at IS NULL
+	`
+
+	var isAdmin bool
+	var n int64
+	err = r.DB.QueryRow(ctx, query, args).Scan(&isAdmin, &n)
+	return isAdmin, n, err
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrLastAdmin       = errors.New("the last active Admin cannot be removed")
+	ErrUserOutranks    = errors.New("user holds permissions you do not")
+)
+
+// Pagination bounds for the admin user list.
+const (
+	defaultUsersPerPage = 25
+	maxUsersPerPage     = 100
+)
+
+// UserPage is one page of the admin user list.
+type UserPage struct {
+	Users   []User `json:"users"`
+	Total   int64  `json:"total"`
+	Page    int    `json:"page"`
+	PerPage int    `json:"perPage"`
+}
+
+func (s *AuthServiceImpl) ListUsers(ctx context.Context, filter UserFilter) (*UserPage, error) {
+	filter.Search = strings.TrimSpace(filter.Search)
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PerPage < 1 {
+		filter.PerPage = defaultUsersPerPage
+	}
+	if filter.PerPage > maxUsersPerPage {
+		filter.PerPage = maxUsersPerPage
+	}
+
+	users, total, err := s.Repo.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserPage{Users: users, Total: total, Page: filter.Page, PerPage: filter.PerPage}, nil
+}
+
+// UpdateUserProfile edits a user's name and email. Changing the email
+// clears its verification and sends a fresh link to the new address.
+func (s *AuthServiceImpl) UpdateUserProfile(ctx context.Context, userID int32, firstName, lastName, email string) (*User, error) {
+	if err := s.ensureManageable(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := s.ensureSoleStudio(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	email = strings.TrimSpace(email)
+	if existing, _ := s.Repo.GetByEmail(ctx, email); existing != nil && existing.ID != userID {
+		return nil, ErrEmailInUse
+	}
+
+	found, err := s.Repo.UpdateUserProfile(ctx, userID, firstName, lastName, email)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUserNotFound
+	}
+
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SendEmailVerification(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AssignUserGroup moves a member of the active studio into groupID (nil
+// removes them from any group), refusing to take the last active Admin out
+// of the Admin group. The caller must hold every permission of both the
+// member's current group and the new one.
+func (s *AuthServiceImpl) AssignUserGroup(ctx context.Context, userID int32, groupID *int32) (*User, error) {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureOutranks(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if groupID != nil {
+		exists, err := s.Repo.PermissionGroupExists(ctx, *groupID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrGroupNotFound
+		}
+		if user.GroupID != nil && *user.GroupID == *groupID {
+			return s.GetUserByID(ctx, userID)
+		}
+		if err := s.ensureGrantable(ctx, *groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.ensureNotLastAdmin(ctx, userID); err != nil {
+		return nil, err
+	}
+	found, err := s.Repo.SetMemberGroup(ctx, userID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	s.Principals.Forget(userID)
+	return s.GetUserByID(ctx, userID)
+}
+
+// SetUserDisabled switches an account off or back on. Callers must revoke
+// the user's sessions after disabling.
+func (s *AuthServiceImpl) SetUserDisabled(ctx context.Context, userID int32, disabled bool) (*User, error) {
+	if err := s.ensureManageable(ctx, userID); err != nil {
+		return nil, err
+	}
+	if disabled {
+		if err := s.ensureSoleStudio(ctx, userID); err != nil {
+			return nil, err
+		}
+		if err := s.ensureNotLastAdmin(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	found, err := s.Repo.SetUserDisabled(ctx, userID, disabled)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrUserNotFound
+	}
+	s.Principals.Forget(userID)
+	return s.GetUserByID(ctx, userID)
+}
+
+// DeleteUser permanently removes a user and everything that cascades from
+// them, except the last active Admin.
+func (s *AuthServiceImpl) DeleteUser(ctx context.Context, userID int32) error {
+	if err := s.ensureManageable(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.ensureSoleStudio(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.ensureNotLastAdmin(ctx, userID); err != nil {
+		return err
+	}
+
+	found, err := s.Repo.DeleteUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrUserNotFound
+	}
+	s.Principals.Forget(userID)
+	return nil
+}
+
+// ensureNotLastAdmin returns ErrLastAdmin when userID is the only enabled
+// member of the active studio's Admin group.
+func (s *AuthServiceImpl) ensureNotLastAdmin(ctx context.Context, userID int32) error {
+	isAdmin, admins, err := s.Repo.ActiveAdminStatus(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if isAdmin && admins <= 1 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// ensureManageable returns ErrUserOutranks when userID holds a permission in
+// the active studio that the request's principal lacks, so members with
+// users.manage cannot edit, disable or delete someone above them.
+func (s *AuthServiceImpl) ensureManageable(ctx context.Context, userID int32) error {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return ensureOutranks(ctx, user)
+}
+
+// ensureOutranks is ensureManageable for an already loaded user.
+func ensureOutranks(ctx context.Context, user *User) error {
+	p, ok := middleware.PrincipalFrom(ctx)
+	if !ok {
+		return ErrUserOutranks
+	}
+	for _, code := range user.Permissions {
+		if !p.Has(code) {
+			return ErrUserOutranks
+		}
+	}
+	return nil
+}
+
+// getUser loads a user, mapping a missing row to ErrUserNotFound.
+func (s *AuthServiceImpl) getUser(ctx context.Context, userID int32) (*User, error) {
+	user, err := s.Repo.GetByID(ctx, userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
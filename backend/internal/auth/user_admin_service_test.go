@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iankencruz/sabiflow/internal/shared/middleware"
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+// adminRepo is a single studio with two groups: Admin (1) holds every
+// permission below, Manager (2) only users.manage.
+type adminRepo struct {
+	UserRepository
+	groups  map[int32][]string
+	members map[int32]*int32
+
+	changed bool
+}
+
+func newAdminRepo() *adminRepo {
+	admin, manager := int32(1), int32(2)
+	return &adminRepo{
+		groups: map[int32][]string{
+			1: {"users.manage", "settings.manage"},
+			2: {"users.manage"},
+		},
+		members: map[int32]*int32{10: &admin, 20: &manager, 30: nil},
+	}
+}
+
+func (r *adminRepo) GetByID(_ context.Context, id int32) (*User, error) {
+	if _, ok := r.members[id]; !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &User{ID: id}, nil
+}
+
+func (r *adminRepo) GetByEmail(context.Context, string) (*User, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (r *adminRepo) GetMembership(_ context.Context, userID int32, _ string) (*Membership, error) {
+	groupID, ok := r.members[userID]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &Membership{Studio: tenant.Studio{ID: 1, Slug: "acme"}, GroupID: groupID}, nil
+}
+
+func (r *adminRepo) GetMemberPermissions(_ context.Context, _, userID int32) ([]string, error) {
+	if groupID := r.members[userID]; groupID != nil {
+		return r.groups[*groupID], nil
+	}
+	return nil, nil
+}
+
+func (r *adminRepo) GetPermissionGroup(_ context.Context, groupID int32) (*PermissionGroup, error) {
+	perms, ok := r.groups[groupID]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return &PermissionGroup{ID: groupID, Permissions: perms}, nil
+}
+
+func (r *adminRepo) PermissionGroupExists(_ context.Context, groupID int32) (bool, error) {
+	_, ok := r.groups[groupID]
+	return ok, nil
+}
+
+func (r *adminRepo) CountMemberships(context.Context, int32) (int64, error) { return 1, nil }
+
+func (r *adminRepo) ActiveAdminStatus(context.Context, int32) (bool, int64, error) {
+	return false, 2, nil
+}
+
+func (r *adminRepo) SetMemberGroup(_ context.Context, userID int32, groupID *int32) (bool, error) {
+	r.members[userID] = groupID
+	r.changed = true
+	return true, nil
+}
+
+func (r *adminRepo) SetUserDisabled(context.Context, int32, bool) (bool, error) {
+	r.changed = true
+	return true, nil
+}
+
+func (r *adminRepo) DeleteUser(context.Context, int32) (bool, error) {
+	r.changed = true
+	return true, nil
+}
+
+func (r *adminRepo) UpdateUserProfile(context.Context, int32, string, string, string) (bool, error) {
+	r.changed = true
+	return true, nil
+}
+
+// asManager is a request context for a member of the Manager group.
+func asManager() context.Context {
+	return middleware.WithPrincipal(context.Background(), &middleware.Principal{
+		UserID:      20,
+		Permissions: []string{"users.manage"},
+	})
+}
+
+func TestAssignUserGroupRefusesUngrantedGroup(t *testing.T) {
+	repo := newAdminRepo()
+	s := &AuthServiceImpl{Repo: repo}
+	admin := int32(1)
+
+	if _, err := s.AssignUserGroup(asManager(), 30, &admin); !errors.Is(err, ErrGroupNotGrantable) {
+		t.Fatalf("promote to Admin: err = %v, want ErrGroupNotGrantable", err)
+	}
+	if repo.changed {
+		t.Fatal("group changed")
+	}
+
+	manager := int32(2)
+	if _, err := s.AssignUserGroup(asManager(), 30, &manager); err != nil {
+		t.Fatalf("assign own group: %v", err)
+	}
+}
+
+func TestUserAdminRefusesHigherRankedMember(t *testing.T) {
+	manager := int32(2)
+	actions := map[string]func(s *AuthServiceImpl, ctx context.Context) error{
+		"update profile": func(s *AuthServiceImpl, ctx context.Context) error {
+			_, err := s.UpdateUserProfile(ctx, 10, "A", "B", "admin@example.com")
+			return err
+		},
+		"assign group": func(s *AuthServiceImpl, ctx context.Context) error {
+			_, err := s.AssignUserGroup(ctx, 10, &manager)
+			return err
+		},
+		"remove group": func(s *AuthServiceImpl, ctx context.Context) error {
+			_, err := s.AssignUserGroup(ctx, 10, nil)
+			return err
+		},
+		"disable": func(s *AuthServiceImpl, ctx context.Context) error {
+			_, err := s.SetUserDisabled(ctx, 10, true)
+			return err
+		},
+		"delete": func(s *AuthServiceImpl, ctx context.Context) error {
+			return s.DeleteUser(ctx, 10)
+		},
+	}
+
+	for name, action := range actions {
+		t.Run(name, func(t *testing.T) {
+			repo := newAdminRepo()
+			s := &AuthServiceImpl{Repo: repo}
+
+			if err := action(s, asManager()); !errors.Is(err, ErrUserOutranks) {
+				t.Fatalf("err = %v, want ErrUserOutranks", err)
+			}
+			if repo.changed {
+				t.Fatal("admin was changed")
+			}
+			if err := action(s, context.Background()); !errors.Is(err, ErrUserOutranks) {
+				t.Fatalf("without principal: err = %v, want ErrUserOutranks", err)
+			}
+		})
+	}
+}
+
+func TestUserAdminAllowsPeers(t *testing.T) {
+	repo := newAdminRepo()
+	s := &AuthServiceImpl{Repo: repo}
+
+	if _, err := s.SetUserDisabled(asManager(), 30, true); err != nil {
+		t.Fatalf("disable member without group: %v", err)
+	}
+	if err := s.DeleteUser(asManager(), 20); err != nil {
+		t.Fatalf("delete peer: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"net/http"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// VerifyEmailHandler confirms an email address from the emailed token.
+func (h *AuthHandler) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		errResp := errors.BadRequest("Invalid request payload")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	v := validators.New()
+	v.Require("token", input.Token)
+
+	if !v.Valid() {
+		errResp := errors.BadRequest("Validation failed")
+		response.WriteJSON(w, errResp.Code, errResp.Message, v.Errors)
+		return
+	}
+
+	if _, err := h.Service.VerifyEmail(r.Context(), input.Token); err != nil {
+		if stdErrors.Is(err, ErrInvalidToken) {
+			errResp := errors.BadRequest("Verification link is invalid or has expired")
+			response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+			return
+		}
+		errResp := errors.Internal("Failed to verify email")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Email verified", nil)
+}
+
+// ResendVerificationHandler emails a fresh verification link to the
+// signed-in user.
+func (h *AuthHandler) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.Service.GetUserByID(r.Context(), userID)
+	if err != nil {
+		errResp := errors.Internal("Failed to load user")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	if user.EmailVerified() {
+		response.WriteJSON(w, http.StatusOK, "Email already verified", nil)
+		return
+	}
+
+	if err := h.Service.SendEmailVerification(r.Context(), user); err != nil {
+		if h.Logger != nil {
+			h.Logger.Error("Failed to send verification email", "err", err, "user_id", user.ID)
+		}
+		errResp := errors.Internal("Failed to send verification email")
+		response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+		return
+	}
+
+	response.WriteJSON(w, http.StatusOK, "Verification email sent", nil)
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+)
+
+// WebAuthnRepository persists passkeys in auth.webauthn_credentials.
+type WebAuthnRepository interface {
+	EnsureWebAuthnHandle(ctx context.Context, userID int32, candidate []byte) ([]byte, error)
+	GetByWebAuthnHandle(ctx context.Context, handle []byte) (*User, []byte, error)
+	ListPasskeys(ctx context.Context, userID int32) ([]Passkey, error)
+	ListWebAuthnCredentials(ctx context.Context, userID int32) ([]webauthn.Credential, error)
+	CreateWebAuthnCredential(ctx context.Context, userID int32, name string, cred *webauthn.Credential) (*Passkey, error)
+	UpdateWebAuthnCredentialUse(ctx context.Context, cred *webauthn.Credential) error
+	RenamePasskey(ctx context.Context, userID, passkeyID int32, name string) (bool, error)
+	DeletePasskey(ctx context.Context, userID, passkeyID int32) (bool, error)
+}
+
+// Passkey is the client-facing view of a stored WebAuthn credential.
+type Passkey struct {
+	ID             int32      `json:"id"`
+	Name           string     `json:"name"`
+	BackupEligible bool       `json:"backupEligible"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	LastUsedAt     *time.Time `json:"lastUsedAt"`
+}
+
+// EnsureWebAuthnHandle assigns candidate as the user's handle unless one is
+// already set, and returns whichever handle is in effect.
+func (r *PgxUserRepository) EnsureWebAuthnHandle(ctx context.Context, userID int32, candidate []byte) ([]byte, error) {
+	query := `
+		UPDATE auth.users
+		SET webauthn_handle = COALESCE(webauthn_handle, @handle)
+		WHERE id = @id
+		RETURNING webauthn_handle
+	`
+
+	var handle []byte
+	err := r.DB.QueryRow(ctx, query, pgx.NamedArgs{"id": userID, "handle": candidate}).Scan(&handle)
+	return handle, err
+}
+
+func (r *PgxUserRepository) GetByWebAuthnHandle(ctx context.Context, handle []byte) (*User, []byte, error) {
+	query := `SELECT ` + userColumns + ` FROM ` + userFrom + ` WHERE u.webauthn_handle = @handle`
+
+	user, err := scanUser(r.DB.QueryRow(ctx, query, pgx.NamedArgs{"handle": handle}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, handle, nil
+}
+
+func (r *PgxUserRepository) ListPasskeys(ctx context.Context, userID int32) ([]Passkey, error) {
+	query := `
+		SELECT id, name, backup_eligible, created_at, last_used_at
+		FROM auth.webauthn_credentials
+		WHERE user_id = @user_id
+		ORDER BY created_at
+	`
+
+	rows, err := r.DB.Query(ctx, query, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Passkey{}
+	for rows.Next() {
+		var p Passkey
+		if err := rows.Scan(&p.ID, &p.Name, &p.BackupEligible, &p.CreatedAt, &p.LastUsedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// ListWebAuthnCredentials loads the user's credentials in the shape the
+// webauthn library verifies against.
+func (r *PgxUserRepository) ListWebAuthnCredentials(ctx context.Context, userID int32) ([]webauthn.Credential, error) {
+	query := `
+		SELECT credential_id, public_key, attestation_type, transports, aaguid,
+			sign_count, clone_warning, backup_eligible, backup_state
+		FROM auth.webauthn_credentials
+		WHERE user_id = @user_id
+	`
+
+	rows, err := r.DB.Query(ctx, query, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creds []webauthn.Credential
+	for rows.Next() {
+		var (
+			c          webauthn.Credential
+			transports []string
+			signCount  int64
+		)
+		if err := rows.Scan(
+			&c.ID,
+			&c.PublicKey,
+			&c.AttestationType,
+			&transports,
+			&c.Authenticator.AAGUID,
+			&signCount,
+			&c.Authenticator.CloneWarning,
+			&c.Flags.BackupEligible,
+			&c.Flags.BackupState,
+		); err != nil {
+			return nil, err
+		}
+		c.Authenticator.SignCount = uint32(signCount)
+		for _, t := range transports {
+			c.Transport = append(c.Transport, protocol.AuthenticatorTransport(t))
+		}
+		creds = append(creds, c)
+	}
+	return creds, rows.Err()
+}
+
+func (r *PgxUserRepository) CreateWebAuthnCredential(ctx context.Context, userID int32, name string, cred *webauthn.Credential) (*Passkey, error) {
+	transports := make([]string, 0, len(cred.Transport))
+	for _, t := range cred.Transport {
+		transports = append(transports, string(t))
+	}
+
+	query := `
+		INSERT INTO auth.webauthn_credentials (
+			user_id, credential_id, public_key, attestation_type, transports, aaguid,
+			sign_count, backup_eligible, backup_state, name
+		)
+		VALUES (
+			@user_id, @credential_id, @public_key, @attestation_type, @transports, @aaguid,
+			@sign_count, @backup_eligible, @backup_state, @name
+		)
+		RETURNING id, name, backup_eligible, created_at, last_used_at
+	`
+
+	args := pgx.NamedArgs{
+		"user_id":          userID,
+		"credential_id":    cred.ID,
+		"public_key":       cred.PublicKey,
+		"attestation_type": cred.AttestationType,
+		"transports":       transports,
+		"aaguid":           cred.Authenticator.AAGUID,
+		"sign_count":       int64(cred.Authenticator.SignCount),
+		"backup_eligible":  cred.Flags.BackupEligible,
+		"backup_state":     cred.Flags.BackupState,
+		"name":             name,
+	}
+
+	var p Passkey
+	err := r.DB.QueryRow(ctx, query, args).Scan(&p.ID, &p.Name, &p.BackupEligible, &p.CreatedAt, &p.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// UpdateWebAuthnCredentialUse stores the sign count and flags reported by
+// the authenticator after a successful assertion.
+func (r *PgxUserRepository) UpdateWebAuthnCredentialUse(ctx context.Context, cred *webauthn.Credential) error {
+	query := `
+		UPDATE auth.webauthn_credentials
+		SET sign_count = @sign_count,
+			clone_warning = clone_warning OR @clone_warning,
+			backup_state = @backup_state,
+			last_used_at = now()
+		WHERE credential_id = @credential_id
+	`
+
+	args := pgx.NamedArgs{
+		"credential_id": cred.ID,
+		"sign_count":    int64(cred.Authenticator.SignCount),
+		"clone_warning": cred.Authenticator.CloneWarning,
+		"backup_state":  cred.Flags.BackupState,
+	}
+
+	_, err := r.DB.Exec(ctx, query, args)
+	return err
+}
+
+func (r *PgxUserRepository) RenamePasskey(ctx context.Context, userID, passkeyID int32, name string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE auth.webauthn_credentials SET name = @name
+		WHERE id = @id AND user_id = @user_id
+	`, pgx.NamedArgs{"id": passkeyID, "user_id": userID, "name": name})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *PgxUserRepository) DeletePasskey(ctx context.Context, userID, passkeyID int32) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM auth.webauthn_credentials
+		WHERE id = @id AND user_id = @user_id
+	`, pgx.NamedArgs{"id": passkeyID, "user_id": userID})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
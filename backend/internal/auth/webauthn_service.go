@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var (
+	ErrPasskeyFailed = errors.New("passkey verification failed")
+	ErrPasskeyCloned = errors.New("passkey sign counter went backwards; possible cloned authenticator")
+)
+
+// webauthnUser adapts a User to the webauthn.User interface.
+type webauthnUser struct {
+	user        *User
+	handle      []byte
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return u.handle }
+func (u *webauthnUser) WebAuthnName() string                       { return u.user.Email }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.user.FirstName + " " + u.user.LastName)
+}
+
+// BeginPasskeyRegistration starts a registration ceremony for userID. The
+// returned session state must be stored server-side (see sessions.Manager.Put)
+// and handed back to FinishPasskeyRegistration.
+func (s *AuthServiceImpl) BeginPasskeyRegistration(ctx context.Context, userID int32) (*protocol.CredentialCreation, string, error) {
+	wu, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	creation, session, err := s.WebAuthn.BeginRegistration(wu,
+		webauthn.WithExclusions(webauthn.Credentials(wu.credentials).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, "", err
+	}
+	return creation, string(state), nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's attestation and
+// stores the new credential under name.
+func (s *AuthServiceImpl) FinishPasskeyRegistration(ctx context.Context, userID int32, state, name string, parsed *protocol.ParsedCredentialCreationData) (*Passkey, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(state), &session); err != nil {
+		return nil, ErrPasskeyFailed
+	}
+
+	wu, err := s.loadWebAuthnUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := s.WebAuthn.CreateCredential(wu, session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyFailed, err)
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		name = "Passkey"
+	}
+	return s.Repo.CreateWebAuthnCredential(ctx, userID, name, cred)
+}
+
+// BeginPasskeyLogin starts a discoverable (username-less) login ceremony.
+func (s *AuthServiceImpl) BeginPasskeyLogin(ctx context.Context) (*protocol.CredentialAssertion, string, error) {
+	assertion, session, err := s.WebAuthn.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	state, err := json.Marshal(session)
+	if err != nil {
+		return nil, "", err
+	}
+	return assertion, string(state), nil
+}
+
+// FinishPasskeyLogin verifies an assertion and returns the signed-in user.
+// The stored sign counter is updated; a counter that goes backwards is
+// rejected as a likely cloned authenticator.
+func (s *AuthServiceImpl) FinishPasskeyLogin(ctx context.Context, state string, parsed *protocol.ParsedCredentialAssertionData) (*User, error) {
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(state), &session); err != nil {
+		return nil, ErrPasskeyFailed
+	}
+
+	var found *webauthnUser
+	lookup := func(_, userHandle []byte) (webauthn.User, error) {
+		user, handle, err := s.Repo.GetByWebAuthnHandle(ctx, userHandle)
+		if err != nil {
+			return nil, err
+		}
+		creds, err := s.Repo.ListWebAuthnCredentials(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		found = &webauthnUser{user: user, handle: handle, credentials: creds}
+		return found, nil
+	}
+
+	_, cred, err := s.WebAuthn.ValidatePasskeyLogin(lookup, session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyFailed, err)
+	}
+
+	if err := s.Repo.UpdateWebAuthnCredentialUse(ctx, cred); err != nil {
+		return nil, err
+	}
+	if cred.Authenticator.CloneWarning {
+		return nil, ErrPasskeyCloned
+	}
+
+	if found.user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	return found.user, nil
+}
+
+func (s *AuthServiceImpl) ListPasskeys(ctx context.Context, userID int32) ([]Passkey, error) {
+	return s.Repo.ListPasskeys(ctx, userID)
+}
+
+func (s *AuthServiceImpl) RenamePasskey(ctx context.Context, userID, passkeyID int32, name string) (bool, error) {
+	return s.Repo.RenamePasskey(ctx, userID, passkeyID, name)
+}
+
+// DeletePasskey removes a passkey unless it is the user's only way to sign in.
+func (s *AuthServiceImpl) DeletePasskey(ctx context.Context, userID, passkeyID int32) (bool, error) {
+	if err := s.ensureAnotherLoginMethod(ctx, userID); err != nil {
+		return false, err
+	}
+	return s.Repo.DeletePasskey(ctx, userID, passkeyID)
+}
+
+func (s *AuthServiceImpl) loadWebAuthnUser(ctx context.Context, userID int32) (*webauthnUser, error) {
+	user, err := s.Repo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidate := make([]byte, 32)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, err
+	}
+	handle, err := s.Repo.EnsureWebAuthnHandle(ctx, userID, candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.Repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthnUser{user: user, handle: handle, credentials: creds}, nil
+}
@@ -0,0 +1,360 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+// passkeyRepo keeps one user and their passkeys in memory. Methods the
+// ceremonies do not use fall through to the nil UserRepository and panic.
+type passkeyRepo struct {
+	UserRepository
+
+	user   *User
+	handle []byte
+	creds  []webauthn.Credential
+}
+
+func (r *passkeyRepo) GetByID(_ context.Context, id int32) (*User, error) {
+	if id != r.user.ID {
+		return nil, pgx.ErrNoRows
+	}
+	return r.user, nil
+}
+
+func (r *passkeyRepo) EnsureWebAuthnHandle(_ context.Context, _ int32, candidate []byte) ([]byte, error) {
+	if r.handle == nil {
+		r.handle = candidate
+	}
+	return r.handle, nil
+}
+
+func (r *passkeyRepo) GetByWebAuthnHandle(_ context.Context, handle []byte) (*User, []byte, error) {
+	if r.handle == nil || !bytes.Equal(handle, r.handle) {
+		return nil, nil, pgx.ErrNoRows
+	}
+	return r.user, r.handle, nil
+}
+
+func (r *passkeyRepo) ListWebAuthnCredentials(context.Context, int32) ([]webauthn.Credential, error) {
+	return r.creds, nil
+}
+
+func (r *passkeyRepo) CreateWebAuthnCredential(_ context.Context, _ int32, name string, cred *webauthn.Credential) (*Passkey, error) {
+	r.creds = append(r.creds, *cred)
+	return &Passkey{ID: int32(len(r.creds)), Name: name, CreatedAt: time.Now()}, nil
+}
+
+func (r *passkeyRepo) UpdateWebAuthnCredentialUse(_ context.Context, cred *webauthn.Credential) error {
+	for i := range r.creds {
+		if bytes.Equal(r.creds[i].ID, cred.ID) {
+			r.creds[i].Authenticator = cred.Authenticator
+		}
+	}
+	return nil
+}
+
+// softAuthenticator is a software passkey holding one P-256 key.
+type softAuthenticator struct {
+	t         *testing.T
+	key       *ecdsa.PrivateKey
+	id        []byte
+	userID    []byte
+	signCount uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+func (a *softAuthenticator) authData(flags byte, attested []byte) []byte {
+	rpHash := sha256.Sum256([]byte(testRPID))
+	data := append(rpHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *softAuthenticator) clientData(typ protocol.CeremonyType, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      string(typ),
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+// register answers a registration challenge with a "none" attestation.
+func (a *softAuthenticator) register(creation *protocol.CredentialCreation) *protocol.ParsedCredentialCreationData {
+	a.t.Helper()
+	a.userID = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	cose, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	attested := make([]byte, 16) // zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.id)))
+	attested = append(attested, a.id...)
+	attested = append(attested, cose...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(flagUserPresent|flagUserVerified|flagAttestedData, attested),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	body := a.marshal(map[string]any{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(a.clientData(protocol.CreateCeremony, creation.Response.Challenge.String())),
+			"attestationObject": b64(attestation),
+		},
+	})
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(body)
+	if err != nil {
+		a.t.Fatalf("parse registration: %v", err)
+	}
+	return parsed
+}
+
+// login signs an assertion for challenge, bumping the sign counter.
+func (a *softAuthenticator) login(assertion *protocol.CredentialAssertion) *protocol.ParsedCredentialAssertionData {
+	a.t.Helper()
+	a.signCount++
+
+	authData := a.authData(flagUserPresent|flagUserVerified, nil)
+	clientData := a.clientData(protocol.AssertCeremony, assertion.Response.Challenge.String())
+	clientHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+
+	body := a.marshal(map[string]any{
+		"id":    b64(a.id),
+		"rawId": b64(a.id),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64(clientData),
+			"authenticatorData": b64(authData),
+			"signature":         b64(sig),
+			"userHandle":        b64(a.userID),
+		},
+	})
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(body)
+	if err != nil {
+		a.t.Fatalf("parse assertion: %v", err)
+	}
+	return parsed
+}
+
+func (a *softAuthenticator) marshal(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return data
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newPasskeyService(t *testing.T) (*AuthServiceImpl, *passkeyRepo) {
+	t.Helper()
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Test",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &passkeyRepo{user: &User{ID: 1, Email: "ada@example.com", FirstName: "Ada"}}
+	return &AuthServiceImpl{Repo: repo, WebAuthn: wa}, repo
+}
+
+// registerPasskey runs a full registration ceremony for the repo's user.
+func registerPasskey(t *testing.T, s *AuthServiceImpl, a *softAuthenticator) {
+	t.Helper()
+	ctx := context.Background()
+
+	creation, state, err := s.BeginPasskeyRegistration(ctx, 1)
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	passkey, err := s.FinishPasskeyRegistration(ctx, 1, state, "  ", a.register(creation))
+	if err != nil {
+		t.Fatalf("FinishPasskeyRegistration: %v", err)
+	}
+	if passkey.Name != "Passkey" {
+		t.Fatalf("blank name stored as %q, want Passkey", passkey.Name)
+	}
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	s, repo := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+
+	registerPasskey(t, s, a)
+	if len(repo.creds) != 1 || !bytes.Equal(repo.creds[0].ID, a.id) {
+		t.Fatalf("stored credentials = %+v", repo.creds)
+	}
+
+	// A second registration excludes the passkey already held.
+	creation, _, err := s.BeginPasskeyRegistration(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex := creation.Response.CredentialExcludeList; len(ex) != 1 || !bytes.Equal(ex[0].CredentialID, a.id) {
+		t.Fatalf("exclude list = %+v", ex)
+	}
+
+	for i := range 2 {
+		assertion, state, err := s.BeginPasskeyLogin(ctx)
+		if err != nil {
+			t.Fatalf("BeginPasskeyLogin: %v", err)
+		}
+		user, err := s.FinishPasskeyLogin(ctx, state, a.login(assertion))
+		if err != nil {
+			t.Fatalf("login %d: FinishPasskeyLogin: %v", i, err)
+		}
+		if user.ID != 1 {
+			t.Fatalf("signed in as %d, want 1", user.ID)
+		}
+		if got := repo.creds[0].Authenticator.SignCount; got != a.signCount {
+			t.Fatalf("stored sign count = %d, want %d", got, a.signCount)
+		}
+	}
+}
+
+func TestPasskeyRegistrationRejectsWrongChallenge(t *testing.T) {
+	s, repo := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+
+	creation, _, err := s.BeginPasskeyRegistration(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// State from a different ceremony.
+	_, other, err := s.BeginPasskeyRegistration(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.FinishPasskeyRegistration(ctx, 1, other, "", a.register(creation))
+	if !errors.Is(err, ErrPasskeyFailed) {
+		t.Fatalf("err = %v, want ErrPasskeyFailed", err)
+	}
+	if len(repo.creds) != 0 {
+		t.Fatal("credential stored despite failed ceremony")
+	}
+}
+
+func TestPasskeyLoginRejectsBadSignature(t *testing.T) {
+	s, _ := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+	registerPasskey(t, s, a)
+
+	assertion, state, err := s.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := a.login(assertion)
+	parsed.Response.Signature[len(parsed.Response.Signature)-1] ^= 0xff
+
+	if _, err := s.FinishPasskeyLogin(ctx, state, parsed); !errors.Is(err, ErrPasskeyFailed) {
+		t.Fatalf("err = %v, want ErrPasskeyFailed", err)
+	}
+}
+
+func TestPasskeyLoginDetectsClone(t *testing.T) {
+	s, repo := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+	registerPasskey(t, s, a)
+
+	// The genuine authenticator has already been used more often.
+	repo.creds[0].Authenticator.SignCount = 10
+
+	assertion, state, err := s.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishPasskeyLogin(ctx, state, a.login(assertion)); !errors.Is(err, ErrPasskeyCloned) {
+		t.Fatalf("err = %v, want ErrPasskeyCloned", err)
+	}
+}
+
+func TestPasskeyLoginRejectsDisabledUser(t *testing.T) {
+	s, repo := newPasskeyService(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+	registerPasskey(t, s, a)
+
+	now := time.Now()
+	repo.user.DisabledAt = &now
+
+	assertion, state, err := s.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.FinishPasskeyLogin(ctx, state, a.login(assertion)); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("err = %v, want ErrAccountDisabled", err)
+	}
+}
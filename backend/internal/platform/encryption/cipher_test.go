@@ -0,0 +1,85 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+	key, err := RandomKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+
+	for _, plaintext := range [][]byte{[]byte("GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"), {}} {
+		a, err := c.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := c.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(a, b) {
+			t.Error("two encryptions produced the same ciphertext")
+		}
+
+		got, err := c.Decrypt(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("Decrypt = %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestCipherRejectsTampering(t *testing.T) {
+	c := newTestCipher(t)
+	ciphertext, err := c.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range ciphertext {
+		tampered := bytes.Clone(ciphertext)
+		tampered[i] ^= 0x01
+		if _, err := c.Decrypt(tampered); err == nil {
+			t.Fatalf("flipping byte %d went unnoticed", i)
+		}
+	}
+
+	if _, err := c.Decrypt(ciphertext[:len(ciphertext)-1]); err == nil {
+		t.Error("truncated ciphertext decrypted")
+	}
+	if _, err := c.Decrypt(ciphertext[:4]); !errors.Is(err, ErrCiphertextTooShort) {
+		t.Errorf("short ciphertext: err = %v, want ErrCiphertextTooShort", err)
+	}
+	if _, err := newTestCipher(t).Decrypt(ciphertext); err == nil {
+		t.Error("ciphertext decrypted under another key")
+	}
+}
+
+func TestNewCipherKeys(t *testing.T) {
+	if _, err := NewCipher(make([]byte, 16)); err == nil {
+		t.Error("16-byte key accepted")
+	}
+	if _, err := NewCipherFromBase64("not base64!"); err == nil {
+		t.Error("invalid base64 accepted")
+	}
+	if _, err := NewCipherFromBase64(base64.StdEncoding.EncodeToString(make([]byte, KeySize))); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+}
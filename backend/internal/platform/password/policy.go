@@ -0,0 +1,211 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iankencruz/sabiflow/internal/shared/validators"
+)
+
+// MaxLength bounds the password size so hashing stays cheap to reject.
+const MaxLength = 1024
+
+// MaxBreachedListSize is the largest file LoadBreachedList will read into
+// memory. Bigger lists, such as the full Have I Been Pwned download, are
+// searched on disk with OpenSortedBreachedList instead.
+const MaxBreachedListSize = 64 << 20
+
+// PolicyError explains why a password was rejected; the message is safe to
+// show to the user.
+type PolicyError struct {
+	Message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Message
+}
+
+// Policy is the single set of rules every new password must satisfy.
+type Policy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireNumber  bool
+	RequireSpecial bool
+
+	// breached holds upper-case hex SHA-1 digests of known-leaked
+	// passwords; see LoadBreachedList. sorted is a digest file searched in
+	// place; see OpenSortedBreachedList.
+	breached map[string]struct{}
+	sorted   *io.SectionReader
+}
+
+// Check returns a *PolicyError for the first rule password breaks, or nil.
+func (p *Policy) Check(password string) error {
+	switch {
+	case utf8.RuneCountInString(password) < p.MinLength:
+		return &PolicyError{fmt.Sprintf("Must be at least %d characters", p.MinLength)}
+	case len(password) > MaxLength:
+		return &PolicyError{fmt.Sprintf("Must be at most %d bytes", MaxLength)}
+	case p.RequireUpper && !validators.UppercaseRX.MatchString(password):
+		return &PolicyError{"Must include at least one uppercase letter"}
+	case p.RequireNumber && !validators.NumberRX.MatchString(password):
+		return &PolicyError{"Must include at least one number"}
+	case p.RequireSpecial && !validators.SpecialRX.MatchString(password):
+		return &PolicyError{"Must include at least one special character (!@#$%^&*)"}
+	case p.breachedContains(password):
+		return &PolicyError{"This password has appeared in a data breach, please choose another"}
+	}
+	return nil
+}
+
+func (p *Policy) breachedContains(password string) bool {
+	if len(p.breached) == 0 && p.sorted == nil {
+		return false
+	}
+	digest := sha1Hex(password)
+	if _, found := p.breached[digest]; found {
+		return true
+	}
+	return p.sorted != nil && searchSorted(p.sorted, digest)
+}
+
+// LoadBreachedList reads an offline list of leaked passwords, one per line,
+// into memory. Lines may be plain passwords or SHA-1 digests in the Have I
+// Been Pwned download format ("HEX" or "HEX:count"). Blank lines and lines
+// starting with # are skipped. Files over MaxBreachedListSize are refused.
+func (p *Policy) LoadBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > MaxBreachedListSize {
+		return fmt.Errorf("breached password list %s is %d bytes, over the %d byte limit; use a sorted SHA-1 list instead",
+			path, info.Size(), MaxBreachedListSize)
+	}
+
+	list := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if digest, ok := parseSHA1Line(line); ok {
+			list[digest] = struct{}{}
+			continue
+		}
+		list[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read breached password list: %w", err)
+	}
+
+	p.breached = list
+	return nil
+}
+
+// OpenSortedBreachedList searches a list of SHA-1 digests ("HEX" or
+// "HEX:count" per line, sorted by digest, as in the Have I Been Pwned
+// "ordered by hash" download) on disk by binary search, so it may be any
+// size. The file stays open for the life of the process.
+func (p *Policy) OpenSortedBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	p.sorted = io.NewSectionReader(f, 0, info.Size())
+	return nil
+}
+
+// searchSorted binary-searches a sorted digest list for digest. It narrows
+// [lo, hi), the byte range where the line holding digest must start, by
+// probing the first line that starts at or after the midpoint. Read errors
+// count as not found.
+func searchSorted(list *io.SectionReader, digest string) bool {
+	lo, hi := int64(0), list.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		line, start, err := lineFrom(list, mid)
+		if err != nil {
+			return false
+		}
+		if line == "" {
+			// No line starts in [mid, hi).
+			hi = mid
+			continue
+		}
+
+		key, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+		switch cmp := strings.Compare(strings.ToUpper(key), digest); {
+		case cmp == 0:
+			return true
+		case cmp < 0:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return false
+}
+
+// lineFrom returns the first line starting at or after off, with its
+// newline, and where it starts. The line is "" when none does.
+func lineFrom(r *io.SectionReader, off int64) (string, int64, error) {
+	start := off
+	if off > 0 {
+		// Back up one byte so a line starting exactly at off is kept.
+		start = off - 1
+	}
+
+	br := bufio.NewReaderSize(io.NewSectionReader(r, start, r.Size()-start), 128)
+	if off > 0 {
+		skipped, err := br.ReadString('\n')
+		if err == io.EOF {
+			return "", 0, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+		start += int64(len(skipped))
+	}
+
+	line, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	return line, start, nil
+}
+
+func parseSHA1Line(line string) (string, bool) {
+	digest, _, _ := strings.Cut(line, ":")
+	if len(digest) != sha1.Size*2 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return "", false
+	}
+	return strings.ToUpper(digest), true
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
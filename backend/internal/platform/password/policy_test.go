@@ -0,0 +1,107 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func writeList(t *testing.T, lines []string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSortedBreachedList(t *testing.T) {
+	var breached, lines []string
+	for i := range 500 {
+		pw := fmt.Sprintf("leaked-%d", i)
+		breached = append(breached, pw)
+		lines = append(lines, fmt.Sprintf("%s:%d", sha1Hex(pw), i+1))
+	}
+	sort.Strings(lines)
+
+	p := &Policy{}
+	if err := p.OpenSortedBreachedList(writeList(t, lines)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pw := range breached {
+		if !p.breachedContains(pw) {
+			t.Fatalf("%q not found", pw)
+		}
+	}
+	for i := range 500 {
+		if pw := fmt.Sprintf("safe-%d", i); p.breachedContains(pw) {
+			t.Fatalf("%q reported as breached", pw)
+		}
+	}
+
+	var weak *PolicyError
+	if err := p.Check("leaked-42"); !errors.As(err, &weak) {
+		t.Fatalf("Check = %v, want a PolicyError", err)
+	}
+}
+
+func TestSortedBreachedListEdges(t *testing.T) {
+	digests := []string{sha1Hex("a"), sha1Hex("b"), sha1Hex("c")}
+	sort.Strings(digests)
+
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{name: "single line", lines: digests[:1]},
+		{name: "trailing newline", lines: append(append([]string{}, digests...), "")},
+		{name: "lower case", lines: []string{strings.ToLower(digests[0]), strings.ToLower(digests[1]), strings.ToLower(digests[2])}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{}
+			if err := p.OpenSortedBreachedList(writeList(t, tt.lines)); err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range tt.lines {
+				if line == "" {
+					continue
+				}
+				if !searchSorted(p.sorted, strings.ToUpper(line)) {
+					t.Errorf("%s not found", line)
+				}
+			}
+			if searchSorted(p.sorted, sha1Hex("not there")) {
+				t.Error("missing digest found")
+			}
+		})
+	}
+
+	p := &Policy{}
+	if err := p.OpenSortedBreachedList(writeList(t, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if p.breachedContains("a") {
+		t.Error("empty list matched")
+	}
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	p := &Policy{}
+	path := writeList(t, []string{"# comment", "hunter2", sha1Hex("Password1") + ":99", ""})
+	if err := p.LoadBreachedList(path); err != nil {
+		t.Fatal(err)
+	}
+
+	for pw, want := range map[string]bool{"hunter2": true, "Password1": true, "# comment": false, "other": false} {
+		if got := p.breachedContains(pw); got != want {
+			t.Errorf("breachedContains(%q) = %t, want %t", pw, got, want)
+		}
+	}
+}
@@ -5,6 +5,15 @@ import "net/http"
 type ErrorResponse struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
+	// Reason is an optional machine-readable code the SPA can switch on
+	// when the HTTP status alone is ambiguous (e.g. several kinds of 403).
+	Reason string `json:"reason,omitempty"`
+}
+
+// WithReason returns a copy of e carrying a machine-readable reason.
+func (e ErrorResponse) WithReason(reason string) ErrorResponse {
+	e.Reason = reason
+	return e
 }
 
 func BadRequest(msg string) ErrorResponse {
@@ -15,4 +24,24 @@ func Internal(msg string) ErrorResponse {
 	return ErrorResponse{Message: msg, Code: http.StatusInternalServerError}
 }
 
+func Unauthorized(msg string) ErrorResponse {
+	return ErrorResponse{Message: msg, Code: http.StatusUnauthorized}
+}
+
+func Forbidden(msg string) ErrorResponse {
+	return ErrorResponse{Message: msg, Code: http.StatusForbidden}
+}
+
+func NotFound(msg string) ErrorResponse {
+	return ErrorResponse{Message: msg, Code: http.StatusNotFound}
+}
+
+func Conflict(msg string) ErrorResponse {
+	return ErrorResponse{Message: msg, Code: http.StatusConflict}
+}
+
+func TooManyRequests(msg string) ErrorResponse {
+	return ErrorResponse{Message: msg, Code: http.StatusTooManyRequests}
+}
+
 // etc...
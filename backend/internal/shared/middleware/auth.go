@@ -1,72 +1,224 @@
 package middleware
 
 import (
+	"context"
+	stdErrors "errors"
 	"net/http"
-	"slices"
 
-	"github.com/iankencruz/sabiflow/internal/auth"
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
 	"github.com/iankencruz/sabiflow/internal/shared/response"
 	"github.com/iankencruz/sabiflow/internal/shared/sessions"
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
 )
 
-var (
-	sessionManager *sessions.Manager
-	userRepo       auth.UserRepository
-)
+// SessionReader resolves the signed-in user from a request; 0 means none.
+// impersonatorID is the administrator behind an impersonation session.
+type SessionReader interface {
+	Identify(r *http.Request) (userID, impersonatorID int32, err error)
+}
+
+// AuthStore loads what the authorisation middleware needs about a user.
+// LoadPrincipal returns nil, nil for users that may not sign in (deleted or
+// disabled); LoadTokenPrincipal does the same for unknown, expired or
+// revoked personal access tokens. Both resolve the studio requested in ctx
+// (see tenant.Slug) and fail with tenant.ErrNotMember when the user does
+// not belong to it.
+type AuthStore interface {
+	LoadPrincipal(ctx context.Context, userID int32) (*Principal, error)
+	LoadTokenPrincipal(ctx context.Context, token, ip string) (*Principal, error)
+	IsEmailVerified(ctx context.Context, userID int32) (bool, error)
+	TwoFactorStatus(ctx context.Context, userID int32) (enabled, required bool, err error)
+}
+
+// Authorizer builds the authentication and permission middleware. Create
+// one with NewAuthorizer and share it across the router.
+type Authorizer struct {
+	sessions SessionReader
+	store    AuthStore
+}
 
-// InitPermissionMiddleware wires the shared session manager and repository
-// exactly once — do this in routes.go or wherever you build the router.
-func InitPermissionMiddleware(sm *sessions.Manager, r auth.UserRepository) {
-	sessionManager = sm
-	userRepo = r
+func NewAuthorizer(sessions SessionReader, store AuthStore) *Authorizer {
+	return &Authorizer{sessions: sessions, store: store}
 }
 
 // -----------------------------------------------------------------------------
 // Core middle-wares
 // -----------------------------------------------------------------------------
 
-// RequireAuth ensures the request carries a valid session.
-func RequireAuth(sm *sessions.Manager) func(http.Handler) http.Handler {
+// RequireAuth ensures the request carries a valid session cookie or an
+// "Authorization: Bearer" personal access token, and stores the caller's
+// Principal in the context for the handlers and middleware below.
+func (a *Authorizer) RequireAuth() func(http.Handler) http.Handler {
+	return a.authenticate(true)
+}
+
+// RequireSession is RequireAuth without Bearer tokens. Account and
+// credential management sits behind it, so a leaked token cannot mint new
+// tokens, change 2FA or revoke sessions.
+func (a *Authorizer) RequireSession() func(http.Handler) http.Handler {
+	return a.authenticate(false)
+}
+
+func (a *Authorizer) authenticate(allowTokens bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var p *Principal
+			var err error
+
+			if token, ok := sessions.BearerToken(r); ok {
+				if !allowTokens {
+					_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
+					return
+				}
+				p, err = a.store.LoadTokenPrincipal(r.Context(), token, sessions.ClientIP(r))
+			} else {
+				userID, impersonatorID, sessErr := a.sessions.Identify(r)
+				if sessErr != nil || userID == 0 {
+					_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
+					return
+				}
+				p, err = a.store.LoadPrincipal(r.Context(), userID)
+				if p != nil && impersonatorID != 0 {
+					// LoadPrincipal may return a shared cached value.
+					impersonated := *p
+					impersonated.ImpersonatorID = impersonatorID
+					p = &impersonated
+				}
+			}
+
+			if stdErrors.Is(err, tenant.ErrNotMember) {
+				errResp := errors.Forbidden("not a member of this studio").WithReason(tenant.ReasonNotMember)
+				_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+				return
+			}
+			if err != nil {
+				_ = response.WriteJSON(w, http.StatusInternalServerError, "failed to fetch user", nil)
+				return
+			}
+			if p == nil {
+				_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
+				return
+			}
+
+			ctx := WithPrincipal(r.Context(), p)
+			if p.Studio != nil {
+				ctx = tenant.WithStudio(ctx, p.Studio)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ReasonImpersonating is the error reason returned when an administrator
+// who is impersonating someone attempts a sensitive action.
+const ReasonImpersonating = "impersonating"
+
+// DenyImpersonation blocks impersonation sessions from sensitive actions
+// such as changing credentials or 2FA. Mount it after RequireAuth or
+// RequireSession.
+func (a *Authorizer) DenyImpersonation() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userID, err := sm.GetUserID(r)
-			if err != nil || userID == 0 {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok {
 				_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
 				return
 			}
+
+			if p.Impersonating() {
+				errResp := errors.Forbidden("not available while impersonating").WithReason(ReasonImpersonating)
+				_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
-// PermissionRequired checks a user’s group permissions.
-// If requireAll == true, the user must have *every* permission in requiredPerms.
-// Otherwise, having *any* single permission suffices.
-func PermissionRequired(
-	sm *sessions.Manager,
-	repo auth.UserRepository,
-	requiredPerms []string,
-	requireAll bool,
-) func(http.Handler) http.Handler {
+// ReasonEmailUnverified is the error reason returned when a signed-in user
+// has not yet confirmed their email address.
+const ReasonEmailUnverified = "email_unverified"
+
+// RequireVerifiedEmail blocks users whose email address is unverified with a
+// 403 carrying ReasonEmailUnverified, so the SPA can prompt for confirmation.
+// Mount it after RequireAuth.
+func (a *Authorizer) RequireVerifiedEmail() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok {
+				_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
+				return
+			}
+
+			verified, err := a.store.IsEmailVerified(r.Context(), p.UserID)
+			if err != nil {
+				_ = response.WriteJSON(w, http.StatusInternalServerError, "failed to fetch user", nil)
+				return
+			}
+
+			if !verified {
+				errResp := errors.Forbidden("email address not verified").WithReason(ReasonEmailUnverified)
+				_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			userID, err := sm.GetUserID(r)
-			if err != nil || userID == 0 {
+// ReasonTwoFactorRequired is the error reason returned when the user's
+// permission group enforces 2FA but they have not enrolled yet.
+const ReasonTwoFactorRequired = "two_factor_enrolment_required"
+
+// RequireTwoFactor blocks members of groups that enforce 2FA until they have
+// enrolled. Enrolment endpoints live under /auth and stay reachable.
+// Mount it after RequireAuth.
+func (a *Authorizer) RequireTwoFactor() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok {
 				_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
 				return
 			}
 
-			userPerms, err := repo.GetGroupPermissions(r.Context(), userID)
+			enabled, required, err := a.store.TwoFactorStatus(r.Context(), p.UserID)
 			if err != nil {
-				_ = response.WriteJSON(w, http.StatusInternalServerError, "failed to fetch permissions", nil)
+				_ = response.WriteJSON(w, http.StatusInternalServerError, "failed to fetch user", nil)
+				return
+			}
+
+			if required && !enabled {
+				errResp := errors.Forbidden("two-factor authentication required").WithReason(ReasonTwoFactorRequired)
+				_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PermissionRequired checks the principal's group permissions.
+// If requireAll == true, the user must have *every* permission in requiredPerms.
+// Otherwise, having *any* single permission suffices. Mount it after
+// RequireAuth.
+func (a *Authorizer) PermissionRequired(requiredPerms []string, requireAll bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := PrincipalFrom(r.Context())
+			if !ok {
+				_ = response.WriteJSON(w, http.StatusUnauthorized, "unauthorised", nil)
 				return
 			}
 
 			if requireAll {
 				// Must possess *all* required permissions
 				for _, perm := range requiredPerms {
-					if !slices.Contains(userPerms, perm) {
+					if !p.Has(perm) {
 						_ = response.WriteJSON(w, http.StatusForbidden, "forbidden", nil)
 						return
 					}
@@ -75,7 +227,7 @@ func PermissionRequired(
 				// Must possess *at least one*
 				allowed := false
 				for _, perm := range requiredPerms {
-					if slices.Contains(userPerms, perm) {
+					if p.Has(perm) {
 						allowed = true
 						break
 					}
@@ -92,17 +244,17 @@ func PermissionRequired(
 }
 
 // -----------------------------------------------------------------------------
-// Friendly wrappers — import middleware and use Can / CanAny / CanAll inline
+// Friendly wrappers — use authz.Can / CanAny / CanAll inline
 // -----------------------------------------------------------------------------
 
-func Can(permission string) func(http.Handler) http.Handler {
-	return PermissionRequired(sessionManager, userRepo, []string{permission}, false)
+func (a *Authorizer) Can(permission string) func(http.Handler) http.Handler {
+	return a.PermissionRequired([]string{permission}, false)
 }
 
-func CanAny(perms ...string) func(http.Handler) http.Handler {
-	return PermissionRequired(sessionManager, userRepo, perms, false)
+func (a *Authorizer) CanAny(perms ...string) func(http.Handler) http.Handler {
+	return a.PermissionRequired(perms, false)
 }
 
-func CanAll(perms ...string) func(http.Handler) http.Handler {
-	return PermissionRequired(sessionManager, userRepo, perms, true)
+func (a *Authorizer) CanAll(perms ...string) func(http.Handler) http.Handler {
+	return a.PermissionRequired(perms, true)
 }
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+)
+
+type fakeSessions struct {
+	userID, impersonatorID int32
+	err                    error
+}
+
+func (f fakeSessions) Identify(*http.Request) (int32, int32, error) {
+	return f.userID, f.impersonatorID, f.err
+}
+
+type fakeStore struct {
+	principals map[int32]*Principal
+	tokens     map[string]*Principal
+	err        error
+}
+
+func (f fakeStore) LoadPrincipal(_ context.Context, userID int32) (*Principal, error) {
+	return f.principals[userID], f.err
+}
+
+func (f fakeStore) LoadTokenPrincipal(_ context.Context, token, _ string) (*Principal, error) {
+	return f.tokens[token], f.err
+}
+
+func (f fakeStore) IsEmailVerified(context.Context, int32) (bool, error) {
+	return true, nil
+}
+
+func (f fakeStore) TwoFactorStatus(context.Context, int32) (bool, bool, error) {
+	return false, false, nil
+}
+
+// capture records the principal the handler under test received.
+func capture(got **Principal) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*got, _ = PrincipalFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func TestRequireAuth(t *testing.T) {
+	alice := &Principal{UserID: 1, Permissions: []string{"projects.view"}}
+	token := &Principal{UserID: 1, TokenID: 9}
+
+	store := fakeStore{
+		principals: map[int32]*Principal{1: alice},
+		tokens:     map[string]*Principal{"good": token},
+	}
+
+	tests := []struct {
+		name     string
+		sessions fakeSessions
+		store    fakeStore
+		bearer   string
+		session  bool // RequireSession instead of RequireAuth
+		want     int
+		wantUser int32
+		wantImp  int32
+	}{
+		{name: "no session", store: store, want: http.StatusUnauthorized},
+		{name: "session error", sessions: fakeSessions{err: errors.New("boom")}, store: store, want: http.StatusUnauthorized},
+		{name: "session", sessions: fakeSessions{userID: 1}, store: store, want: http.StatusNoContent, wantUser: 1},
+		{name: "unknown user", sessions: fakeSessions{userID: 2}, store: store, want: http.StatusUnauthorized},
+		{name: "impersonation", sessions: fakeSessions{userID: 1, impersonatorID: 7}, store: store, want: http.StatusNoContent, wantUser: 1, wantImp: 7},
+		{name: "store error", sessions: fakeSessions{userID: 1}, store: fakeStore{err: errors.New("boom")}, want: http.StatusInternalServerError},
+		{name: "not a member", sessions: fakeSessions{userID: 1}, store: fakeStore{err: tenant.ErrNotMember}, want: http.StatusForbidden},
+		{name: "bearer token", bearer: "good", store: store, want: http.StatusNoContent, wantUser: 1},
+		{name: "bad bearer token", bearer: "bad", store: store, want: http.StatusUnauthorized},
+		{name: "bearer on session-only route", bearer: "good", store: store, session: true, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAuthorizer(tt.sessions, tt.store)
+			mw := a.RequireAuth()
+			if tt.session {
+				mw = a.RequireSession()
+			}
+
+			var got *Principal
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+			mw(capture(&got)).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusNoContent {
+				return
+			}
+			if got == nil || got.UserID != tt.wantUser || got.ImpersonatorID != tt.wantImp {
+				t.Fatalf("principal = %+v, want user %d impersonator %d", got, tt.wantUser, tt.wantImp)
+			}
+		})
+	}
+
+	// Impersonation must not leak into the store's shared principal.
+	if alice.ImpersonatorID != 0 {
+		t.Fatalf("cached principal was modified: %+v", alice)
+	}
+}
+
+func TestPermissionRequired(t *testing.T) {
+	p := &Principal{UserID: 1, Permissions: []string{"projects.view", "projects.edit"}}
+
+	tests := []struct {
+		name       string
+		principal  *Principal
+		perms      []string
+		requireAll bool
+		want       int
+	}{
+		{name: "no principal", perms: []string{"projects.view"}, want: http.StatusUnauthorized},
+		{name: "any: holds one", principal: p, perms: []string{"users.manage", "projects.view"}, want: http.StatusNoContent},
+		{name: "any: holds none", principal: p, perms: []string{"users.manage", "users.invite"}, want: http.StatusForbidden},
+		{name: "all: holds every one", principal: p, perms: []string{"projects.view", "projects.edit"}, requireAll: true, want: http.StatusNoContent},
+		{name: "all: missing one", principal: p, perms: []string{"projects.view", "users.manage"}, requireAll: true, want: http.StatusForbidden},
+		{name: "any: empty list", principal: p, want: http.StatusForbidden},
+	}
+
+	a := NewAuthorizer(fakeSessions{}, fakeStore{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.principal != nil {
+				r = r.WithContext(WithPrincipal(r.Context(), tt.principal))
+			}
+			w := httptest.NewRecorder()
+
+			var got *Principal
+			a.PermissionRequired(tt.perms, tt.requireAll)(capture(&got)).ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
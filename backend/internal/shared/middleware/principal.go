@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"slices"
+
+	"github.com/iankencruz/sabiflow/internal/shared/tenant"
+)
+
+// Principal is the authenticated caller. RequireAuth resolves it once per
+// request and stores it in the request context; treat it as read-only.
+type Principal struct {
+	UserID int32
+	// Studio is the studio the request acts in, nil for users who belong
+	// to none. GroupID, Group and Permissions describe the user's
+	// membership there.
+	Studio *tenant.Studio
+	// GroupID and Group identify the user's permission group; GroupID is
+	// nil for users without one.
+	GroupID     *int32
+	Group       string
+	Permissions []string
+	// TokenID is set when the request authenticated with a personal access
+	// token instead of a session cookie; Permissions are then the token's
+	// scopes.
+	TokenID int32
+	// ImpersonatorID is the administrator acting as UserID through an
+	// impersonation session, or 0.
+	ImpersonatorID int32
+}
+
+// Impersonating reports whether an administrator is acting as this user.
+func (p *Principal) Impersonating() bool {
+	return p.ImpersonatorID != 0
+}
+
+// ViaToken reports whether the caller used a personal access token.
+func (p *Principal) ViaToken() bool {
+	return p.TokenID != 0
+}
+
+// Has reports whether the principal holds permission.
+func (p *Principal) Has(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal stored by RequireAuth, if any.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
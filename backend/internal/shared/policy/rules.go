@@ -0,0 +1,63 @@
+package policy
+
+import "fmt"
+
+// Rule renders a SQL predicate over the row aliased as alias, whose key is
+// idColumn, that is true when the user bound to @policy_user_id has the
+// relationship the rule describes (owner, assignee, …). Table and column
+// names come from code, never from requests, so they are interpolated
+// directly.
+type Rule func(alias, idColumn string) string
+
+// Owner matches rows whose column holds the user's ID, e.g.
+// Owner("owner_id") for "clients they own".
+func Owner(column string) Rule {
+	return func(alias, _ string) string {
+		return fmt.Sprintf("%s.%s = @policy_user_id", alias, column)
+	}
+}
+
+// Member matches rows that have an entry for the user in a join table, e.g.
+// Member("crm.project_assignees", "project_id", "user_id") for "projects
+// they are assigned to". foreignKey references the row's key column.
+func Member(table, foreignKey, userColumn string) Rule {
+	return func(alias, idColumn string) string {
+		m := alias + "_m"
+		return fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM %s %s WHERE %s.%s = %s.%s AND %s.%s = @policy_user_id)",
+			table, m, m, foreignKey, alias, idColumn, m, userColumn,
+		)
+	}
+}
+
+// Via follows a foreign key to a parent table keyed by id and applies rule
+// there, e.g. Via("crm.clients", "client_id", Owner("owner_id")) for
+// "invoices for clients they own".
+func Via(parentTable, foreignKey string, rule Rule) Rule {
+	return ViaKey(parentTable, "id", foreignKey, rule)
+}
+
+// ViaKey is Via for a parent table whose key column is parentKey.
+func ViaKey(parentTable, parentKey, foreignKey string, rule Rule) Rule {
+	return func(alias, _ string) string {
+		p := alias + "_p"
+		return fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM %s %s WHERE %s.%s = %s.%s AND %s)",
+			parentTable, p, p, parentKey, alias, foreignKey, rule(p, parentKey),
+		)
+	}
+}
+
+// AnyOf matches when at least one rule does.
+func AnyOf(rules ...Rule) Rule {
+	return func(alias, idColumn string) string {
+		if len(rules) == 0 {
+			return "FALSE"
+		}
+		clause := "(" + rules[0](alias, idColumn)
+		for _, r := range rules[1:] {
+			clause += " OR " + r(alias, idColumn)
+		}
+		return clause + ")"
+	}
+}
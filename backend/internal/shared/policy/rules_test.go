@@ -0,0 +1,64 @@
+package policy
+
+import "testing"
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     Rule
+		idColumn string
+		want     string
+	}{
+		{
+			name:     "owner",
+			rule:     Owner("owner_id"),
+			idColumn: "id",
+			want:     "r.owner_id = @policy_user_id",
+		},
+		{
+			name:     "member",
+			rule:     Member("crm.project_assignees", "project_id", "user_id"),
+			idColumn: "id",
+			want:     "EXISTS (SELECT 1 FROM crm.project_assignees r_m WHERE r_m.project_id = r.id AND r_m.user_id = @policy_user_id)",
+		},
+		{
+			name:     "member with custom key",
+			rule:     Member("crm.project_assignees", "project_uid", "user_id"),
+			idColumn: "uid",
+			want:     "EXISTS (SELECT 1 FROM crm.project_assignees r_m WHERE r_m.project_uid = r.uid AND r_m.user_id = @policy_user_id)",
+		},
+		{
+			name:     "via",
+			rule:     Via("crm.clients", "client_id", Owner("owner_id")),
+			idColumn: "id",
+			want:     "EXISTS (SELECT 1 FROM crm.clients r_p WHERE r_p.id = r.client_id AND r_p.owner_id = @policy_user_id)",
+		},
+		{
+			name:     "via keyed parent passes its key on",
+			rule:     ViaKey("crm.projects", "uid", "project_uid", Member("crm.project_assignees", "project_uid", "user_id")),
+			idColumn: "id",
+			want: "EXISTS (SELECT 1 FROM crm.projects r_p WHERE r_p.uid = r.project_uid AND " +
+				"EXISTS (SELECT 1 FROM crm.project_assignees r_p_m WHERE r_p_m.project_uid = r_p.uid AND r_p_m.user_id = @policy_user_id))",
+		},
+		{
+			name:     "any of",
+			rule:     AnyOf(Owner("owner_id"), Member("crm.project_assignees", "project_uid", "user_id")),
+			idColumn: "uid",
+			want:     "(r.owner_id = @policy_user_id OR EXISTS (SELECT 1 FROM crm.project_assignees r_m WHERE r_m.project_uid = r.uid AND r_m.user_id = @policy_user_id))",
+		},
+		{
+			name:     "any of nothing",
+			rule:     AnyOf(),
+			idColumn: "id",
+			want:     "FALSE",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule("r", tt.idColumn); got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
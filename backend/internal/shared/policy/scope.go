@@ -0,0 +1,33 @@
+package policy
+
+import "github.com/jackc/pgx/v5"
+
+// Scope is a row filter produced by Engine.Scope for list queries:
+//
+//	scope, err := policies.Scope(ctx, principal, "projects.view", "p")
+//	args := pgx.NamedArgs{"limit": 50}
+//	query := `SELECT p.id, p.name FROM crm.projects p WHERE ` + scope.Where(args) + ` LIMIT @limit`
+type Scope struct {
+	clause string
+	args   pgx.NamedArgs
+	all    bool
+}
+
+// Where adds the scope's arguments to args and returns the predicate to AND
+// into the query's WHERE clause. It always limits rows to the active
+// studio.
+func (s Scope) Where(args pgx.NamedArgs) string {
+	if s.clause == "" {
+		return "FALSE"
+	}
+	for k, v := range s.args {
+		args[k] = v
+	}
+	return "(" + s.clause + ")"
+}
+
+// All reports whether the scope lets every row of the studio through, so
+// callers can skip work such as joins that only matter for scoped users.
+func (s Scope) All() bool {
+	return s.all
+}
@@ -0,0 +1,132 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/database"
+)
+
+// Table is tabular data written to the archive as CSV.
+type Table struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// QueryTable runs query and returns its result as a Table, using the
+// selected column names as the header. NULLs become empty cells, times
+// RFC 3339 and byte strings base64.
+func QueryTable(ctx context.Context, db database.DBTX, query string, args ...any) (Table, error) {
+	rows, err := db.Query(ctx, query, args...)
+	if err != nil {
+		return Table{}, err
+	}
+	defer rows.Close()
+
+	var t Table
+	for _, f := range rows.FieldDescriptions() {
+		t.Columns = append(t.Columns, f.Name)
+	}
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return Table{}, err
+		}
+
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = cell(v)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t, rows.Err()
+}
+
+func cell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// manifest is written to the archive as manifest.json.
+type manifest struct {
+	UserID      int32     `json:"userId"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	Files       []string  `json:"files"`
+}
+
+// Export writes a ZIP archive of every source's records for userID to w:
+// one CSV or JSON file per source plus manifest.json listing them.
+func (r *Registry) Export(ctx context.Context, userID int32, w io.Writer) error {
+	zw := zip.NewWriter(w)
+	m := manifest{UserID: userID, GeneratedAt: time.Now().UTC()}
+
+	for _, s := range r.list() {
+		if s.Export == nil {
+			continue
+		}
+
+		data, err := s.Export(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", s.Name, err)
+		}
+
+		name, err := writeEntry(zw, s.Name, data)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", s.Name, err)
+		}
+		m.Files = append(m.Files, name)
+	}
+
+	if _, err := writeEntry(zw, "manifest", m); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeEntry adds data to the archive as name.csv for a Table and
+// name.json otherwise, returning the file name used.
+func writeEntry(zw *zip.Writer, name string, data any) (string, error) {
+	if t, ok := data.(Table); ok {
+		name += ".csv"
+		f, err := zw.Create(name)
+		if err != nil {
+			return "", err
+		}
+
+		cw := csv.NewWriter(f)
+		if err := cw.Write(t.Columns); err != nil {
+			return "", err
+		}
+		if err := cw.WriteAll(t.Rows); err != nil {
+			return "", err
+		}
+		return name, nil
+	}
+
+	name += ".json"
+	f, err := zw.Create(name)
+	if err != nil {
+		return "", err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return name, enc.Encode(data)
+}
@@ -0,0 +1,91 @@
+// Package privacy answers data-protection requests: it gathers everything
+// held about a person into a downloadable archive (right of access) and
+// erases it (right to erasure).
+//
+// Each module registers a Source for the tables it owns, so a new module
+// (CRM contacts, projects, …) only has to register its own. Records the
+// law requires to be kept, such as invoices held for tax retention, are
+// exported as usual but anonymised rather than deleted by their source's
+// Erase:
+//
+//	app.Privacy.Register(privacy.Source{
+//	    Name:   "invoices",
+//	    Export: invoices.ExportForUser,
+//	    Erase:  invoices.AnonymiseForUser, // kept for tax retention
+//	})
+package privacy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Source is one module's share of a person's data.
+type Source struct {
+	// Name is the file name in the archive without extension, e.g.
+	// "sessions". Names must be unique.
+	Name string
+	// Export returns the person's records: a Table is written as CSV,
+	// anything else as JSON. Nil leaves the source out of exports.
+	Export func(ctx context.Context, userID int32) (any, error)
+	// Erase deletes or anonymises the person's records. It must be safe to
+	// run again, so a failed erasure can be retried. Nil means the source
+	// has nothing of its own to erase.
+	Erase func(ctx context.Context, userID int32) error
+}
+
+// Registry holds the registered sources. Modules register theirs at
+// startup alongside their permission codes.
+type Registry struct {
+	mu      sync.RWMutex
+	sources []Source
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds sources, replacing any earlier ones with the same name.
+func (r *Registry) Register(sources ...Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range sources {
+		replaced := false
+		for i := range r.sources {
+			if r.sources[i].Name == s.Name {
+				r.sources[i] = s
+				replaced = true
+			}
+		}
+		if !replaced {
+			r.sources = append(r.sources, s)
+		}
+	}
+}
+
+func (r *Registry) list() []Source {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Source(nil), r.sources...)
+}
+
+// Erase runs every source's Erase, most recently registered first: the
+// module owning the account itself registers first, so its record is the
+// last to go and other modules can still look it up. It stops at the first
+// failure.
+func (r *Registry) Erase(ctx context.Context, userID int32) error {
+	sources := r.list()
+	for i := len(sources) - 1; i >= 0; i-- {
+		s := sources[i]
+		if s.Erase == nil {
+			continue
+		}
+		if err := s.Erase(ctx, userID); err != nil {
+			return fmt.Errorf("erase %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
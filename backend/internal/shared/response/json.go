@@ -40,7 +40,6 @@ func WriteJSON(w http.ResponseWriter, statusCode int, message string, data inter
 		return err
 	}
 
-	fmt.Println("✅ WriteJSON sent:", string(js))
 	return nil
 }
 
@@ -0,0 +1,98 @@
+package sessions
+
+import (
+	"net/http"
+	"time"
+)
+
+// Config controls the session cookie and how long sessions live. Zero
+// fields take the defaults in DefaultConfig.
+type Config struct {
+	CookieName string
+	// Domain scopes the cookie, e.g. "example.com" to share it with
+	// subdomains; empty means the API host only.
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+
+	// IdleTimeout ends a browser-session login after this long without a
+	// request. Activity pushes the expiry out again, but only once it would
+	// move by more than RefreshThreshold, to save writes.
+	IdleTimeout      time.Duration
+	RefreshThreshold time.Duration
+	// RememberMe is the idle timeout of "remember me" logins, whose cookie
+	// also survives closing the browser.
+	RememberMe time.Duration
+	// AbsoluteLifetime caps every login however active it is; after it
+	// the user signs in again.
+	AbsoluteLifetime time.Duration
+}
+
+// DefaultConfig is used for any Config field left zero.
+var DefaultConfig = Config{
+	CookieName:       "user_session",
+	SameSite:         http.SameSiteLaxMode,
+	IdleTimeout:      24 * time.Hour,
+	RefreshThreshold: 10 * time.Minute,
+	RememberMe:       30 * 24 * time.Hour,
+	AbsoluteLifetime: 90 * 24 * time.Hour,
+}
+
+func (c Config) withDefaults() Config {
+	if c.CookieName == "" {
+		c.CookieName = DefaultConfig.CookieName
+	}
+	if c.SameSite == 0 {
+		c.SameSite = DefaultConfig.SameSite
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = DefaultConfig.IdleTimeout
+	}
+	if c.RefreshThreshold <= 0 {
+		c.RefreshThreshold = DefaultConfig.RefreshThreshold
+	}
+	if c.RememberMe <= 0 {
+		c.RememberMe = DefaultConfig.RememberMe
+	}
+	if c.AbsoluteLifetime <= 0 {
+		c.AbsoluteLifetime = DefaultConfig.AbsoluteLifetime
+	}
+	return c
+}
+
+// idleTimeout is how long a session of the given kind lives without
+// activity.
+func (c Config) idleTimeout(persistent bool) time.Duration {
+	if persistent {
+		return c.RememberMe
+	}
+	return c.IdleTimeout
+}
+
+// ParseSameSite maps "lax", "strict" or "none" to an http.SameSite; other
+// values give the default.
+func ParseSameSite(s string) http.SameSite {
+	switch s {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax":
+		return http.SameSiteLaxMode
+	}
+	return DefaultConfig.SameSite
+}
+
+// cookie returns the base cookie attributes shared by the session and CSRF
+// cookies.
+func (c Config) cookie(name, value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		SameSite: c.SameSite,
+		Expires:  expires,
+	}
+}
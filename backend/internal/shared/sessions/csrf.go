@@ -0,0 +1,180 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+)
+
+const (
+	// CSRFCookieName holds the CSRF token. Unlike the session cookie it is
+	// readable from JavaScript, so the SPA can echo it back.
+	CSRFCookieName = "csrf_token"
+	// CSRFHeader carries the token on unsafe requests.
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Machine-readable reasons for CSRF refusals.
+const (
+	ReasonCSRFOrigin = "csrf_origin"
+	ReasonCSRFToken  = "csrf_token"
+)
+
+// CSRFToken returns the token the client must send in the X-CSRF-Token
+// header with unsafe requests, and sets it in the CSRF cookie.
+//
+// With a session the token is derived from the session token, so it needs
+// no storage and changes whenever the session rotates (every login). Before
+// sign-in there is no session to bind to and a random token is compared
+// against the cookie instead (double submit).
+func (m *Manager) CSRFToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if token := m.Token(r); token != "" {
+		csrf := csrfToken(token)
+		m.setCSRFCookie(w, csrf, time.Time{})
+		return csrf, nil
+	}
+
+	if cookie, err := r.Cookie(CSRFCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+
+	csrf, err := generateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	m.setCSRFCookie(w, csrf, time.Time{})
+	return csrf, nil
+}
+
+// VerifyCSRF reports whether r carries the CSRF token matching its session
+// or, without one, its CSRF cookie.
+func (m *Manager) VerifyCSRF(r *http.Request) bool {
+	sent := r.Header.Get(CSRFHeader)
+	if sent == "" {
+		return false
+	}
+
+	var want string
+	if token := m.Token(r); token != "" {
+		want = csrfToken(token)
+	} else if cookie, err := r.Cookie(CSRFCookieName); err == nil {
+		want = cookie.Value
+	}
+	return want != "" && hmac.Equal([]byte(sent), []byte(want))
+}
+
+// csrfToken derives a session's CSRF token: an HMAC keyed by the raw
+// session token, which reveals nothing about the session token itself.
+func csrfToken(sessionToken string) string {
+	mac := hmac.New(sha256.New, []byte(sessionToken))
+	mac.Write([]byte("csrf"))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// setCSRFCookie sets the CSRF cookie with the session cookie's attributes,
+// minus HttpOnly.
+func (m *Manager) setCSRFCookie(w http.ResponseWriter, token string, expires time.Time) {
+	http.SetCookie(w, m.Config.cookie(CSRFCookieName, token, expires))
+}
+
+// CSRF protects cookie-authenticated requests from cross-site forgery.
+// Unsafe methods must pass two checks:
+//
+//   - Origin (or, failing that, Referer) must be the API's own host or one
+//     of TrustedOrigins. Requests sending neither are let through to the
+//     token check, as non-browser clients often omit both.
+//   - X-CSRF-Token must match the request's token; see Manager.CSRFToken.
+//
+// Requests with a non-empty "Authorization: Bearer" token are exempt: they
+// authenticate with the token alone, which browsers never attach on their
+// own.
+type CSRF struct {
+	Sessions *Manager
+	// TrustedOrigins lists the SPA origins, e.g. "https://app.example.com".
+	TrustedOrigins []string
+}
+
+// Middleware enforces the checks. Mount it on the API router.
+func (c CSRF) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) || hasBearer(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !c.originAllowed(r) {
+			errResp := errors.Forbidden("cross-site request refused").WithReason(ReasonCSRFOrigin)
+			_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+			return
+		}
+
+		if !c.Sessions.VerifyCSRF(r) {
+			errResp := errors.Forbidden("missing or invalid CSRF token").WithReason(ReasonCSRFToken)
+			_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c CSRF) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false // includes the opaque "null" origin
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	for _, trusted := range c.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), u.Scheme+"://"+u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func hasBearer(r *http.Request) bool {
+	_, ok := BearerToken(r)
+	return ok
+}
+
+// BearerToken extracts the token from an "Authorization: Bearer" header,
+// reporting false when there is none or it is empty.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
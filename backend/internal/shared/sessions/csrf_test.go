@@ -0,0 +1,206 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSRFOriginAllowed(t *testing.T) {
+	c := CSRF{TrustedOrigins: []string{"https://app.example.com/"}}
+
+	tests := []struct {
+		name    string
+		origin  string
+		referer string
+		want    bool
+	}{
+		{name: "neither header", want: true},
+		{name: "own host", origin: "https://api.example.com", want: true},
+		{name: "trusted origin", origin: "https://APP.example.com", want: true},
+		{name: "untrusted origin", origin: "https://evil.example", want: false},
+		{name: "trusted host on another scheme", origin: "http://app.example.com", want: false},
+		{name: "null origin", origin: "null", want: false},
+		{name: "trusted referer", referer: "https://app.example.com/settings?tab=1", want: true},
+		{name: "untrusted referer", referer: "https://evil.example/page", want: false},
+		{name: "unparsable referer", referer: "::", want: false},
+		{name: "origin wins over referer", origin: "https://evil.example", referer: "https://app.example.com/", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "https://api.example.com/api/v1/things", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+			if got := c.originAllowed(r); got != tt.want {
+				t.Fatalf("originAllowed = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// csrfCookie returns the CSRF cookie CSRFToken set on w.
+func csrfCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == CSRFCookieName {
+			return c
+		}
+	}
+	t.Fatal("no CSRF cookie set")
+	return nil
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	m, _ := newTestManager()
+	h := CSRF{Sessions: m}.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// An anonymous client gets a double-submit token.
+	w := httptest.NewRecorder()
+	anonToken, err := m.CSRFToken(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonCookie := csrfCookie(t, w)
+
+	// A signed-in client gets one derived from its session.
+	signedIn := signIn(t, m, nil, 1)
+	w = httptest.NewRecorder()
+	sessionToken, err := m.CSRFToken(w, signedIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessionToken == anonToken {
+		t.Fatal("session token equals the anonymous token")
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		build  func(r *http.Request)
+		want   int
+		reason string
+	}{
+		{name: "safe method", method: http.MethodGet, want: http.StatusNoContent},
+		{name: "no token", method: http.MethodPost, want: http.StatusForbidden, reason: ReasonCSRFToken},
+		{
+			name:   "anonymous double submit",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				r.AddCookie(anonCookie)
+				r.Header.Set(CSRFHeader, anonToken)
+			},
+			want: http.StatusNoContent,
+		},
+		{
+			name:   "anonymous token mismatch",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				r.AddCookie(anonCookie)
+				r.Header.Set(CSRFHeader, anonToken+"x")
+			},
+			want:   http.StatusForbidden,
+			reason: ReasonCSRFToken,
+		},
+		{
+			name:   "session token",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				copyCookies(r, signedIn)
+				r.Header.Set(CSRFHeader, sessionToken)
+			},
+			want: http.StatusNoContent,
+		},
+		{
+			name:   "session ignores double submit cookie",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				copyCookies(r, signedIn)
+				r.AddCookie(anonCookie)
+				r.Header.Set(CSRFHeader, anonToken)
+			},
+			want:   http.StatusForbidden,
+			reason: ReasonCSRFToken,
+		},
+		{
+			name:   "cross-site with valid token",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				copyCookies(r, signedIn)
+				r.Header.Set(CSRFHeader, sessionToken)
+				r.Header.Set("Origin", "https://evil.example")
+			},
+			want:   http.StatusForbidden,
+			reason: ReasonCSRFOrigin,
+		},
+		{
+			name:   "bearer token",
+			method: http.MethodDelete,
+			build: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer sf_pat_abc")
+				r.Header.Set("Origin", "https://evil.example")
+			},
+			want: http.StatusNoContent,
+		},
+		{
+			name:   "empty bearer token",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				copyCookies(r, signedIn)
+				r.Header.Set("Authorization", "Bearer ")
+			},
+			want:   http.StatusForbidden,
+			reason: ReasonCSRFToken,
+		},
+		{
+			name:   "blank bearer token",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				copyCookies(r, signedIn)
+				r.Header.Set("Authorization", "bearer    ")
+			},
+			want:   http.StatusForbidden,
+			reason: ReasonCSRFToken,
+		},
+		{
+			name:   "other scheme",
+			method: http.MethodPost,
+			build: func(r *http.Request) {
+				r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+			},
+			want:   http.StatusForbidden,
+			reason: ReasonCSRFToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/api/v1/things", nil)
+			if tt.build != nil {
+				tt.build(r)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.reason != "" && !strings.Contains(w.Body.String(), tt.reason) {
+				t.Fatalf("body %s lacks reason %q", w.Body, tt.reason)
+			}
+		})
+	}
+}
+
+func copyCookies(dst, src *http.Request) {
+	for _, c := range src.Cookies() {
+		dst.AddCookie(c)
+	}
+}
@@ -0,0 +1,133 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Session describes one active login for the device inventory. The token
+// hash is never exposed; ID is a stable surrogate safe to hand to clients.
+type Session struct {
+	ID         int64     `json:"id"`
+	UserID     int32     `json:"userId"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"userAgent"`
+	IPAddress  string    `json:"ipAddress"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+	// Impersonated marks sessions an administrator opened as this user.
+	Impersonated bool `json:"impersonated"`
+}
+
+// ListForUser returns the user's unexpired sessions, most recently used
+// first. The session attached to r (if any) is flagged as Current.
+func (m *Manager) ListForUser(r *http.Request, userID int32) ([]Session, error) {
+	currentHash := ""
+	if token := m.Token(r); token != "" {
+		currentHash = hashToken(token)
+	}
+
+	records, err := m.Store.ListForUser(r.Context(), userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions failed: %w", err)
+	}
+
+	list := make([]Session, 0, len(records))
+	for _, rec := range records {
+		list = append(list, Session{
+			ID:           rec.ID,
+			UserID:       userID,
+			Device:       describeUserAgent(rec.UserAgent),
+			UserAgent:    rec.UserAgent,
+			IPAddress:    rec.IPAddress,
+			CreatedAt:    rec.CreatedAt,
+			LastSeenAt:   rec.LastSeenAt,
+			ExpiresAt:    rec.ExpiresAt,
+			Current:      rec.TokenHash == currentHash,
+			Impersonated: rec.ImpersonatorID != nil,
+		})
+	}
+	return list, nil
+}
+
+// Revoke deletes a single session belonging to userID. It reports false when
+// no such session exists, so callers can answer 404 without leaking whether
+// the ID belongs to someone else.
+func (m *Manager) Revoke(ctx context.Context, userID int32, sessionID int64) (bool, error) {
+	return m.Store.DeleteForUser(ctx, userID, sessionID)
+}
+
+// RevokeOthers signs userID out of every session except the one on r.
+func (m *Manager) RevokeOthers(r *http.Request, userID int32) (int64, error) {
+	currentHash := ""
+	if token := m.Token(r); token != "" {
+		currentHash = hashToken(token)
+	}
+	return m.Store.DeleteOthers(r.Context(), userID, currentHash)
+}
+
+// RevokeAll signs userID out everywhere, including any impersonation
+// sessions they opened as someone else.
+func (m *Manager) RevokeAll(ctx context.Context, userID int32) (int64, error) {
+	return m.Store.DeleteAll(ctx, userID)
+}
+
+// ClientIP returns the caller's IP without the port. Behind a reverse proxy
+// RemoteAddr is the proxy's address unless TrustedProxies has rewritten it
+// from the forwarding headers.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// describeUserAgent turns a raw User-Agent into a short "Browser on OS"
+// label for the session list. It is deliberately coarse.
+func describeUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+
+	os := ""
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		os = "iOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Mac OS X"), strings.Contains(ua, "Macintosh"):
+		os = "macOS"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+
+	if os == "" {
+		return browser
+	}
+	return browser + " on " + os
+}
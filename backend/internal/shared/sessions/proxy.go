@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// TrustedProxies applies chi's RealIP middleware only to requests whose
+// immediate peer is one of Networks, so ClientIP (and with it the per-IP
+// login and magic-link limits) sees the real client behind a reverse proxy
+// while direct callers cannot spoof an address with X-Forwarded-For.
+//
+// The proxies must set X-Real-IP, or replace rather than append to
+// X-Forwarded-For, since RealIP takes the first address in that header.
+// With no Networks every request keeps its RemoteAddr.
+type TrustedProxies struct {
+	Networks []netip.Prefix
+}
+
+// Middleware rewrites RemoteAddr for requests from a trusted proxy. Mount it
+// ahead of anything that logs or limits by IP.
+func (t TrustedProxies) Middleware(next http.Handler) http.Handler {
+	if len(t.Networks) == 0 {
+		return next
+	}
+
+	realIP := middleware.RealIP(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.trusted(r.RemoteAddr) {
+			realIP.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (t TrustedProxies) trusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, n := range t.Networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses CIDR ranges ("10.0.0.0/8") and single
+// addresses ("192.0.2.7") for TrustedProxies.
+func ParseTrustedProxies(list []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, 0, len(list))
+	for _, item := range list {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("trusted proxy %q: %w", item, err)
+			}
+			addr = addr.Unmap()
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", item, err)
+		}
+		networks = append(networks, prefix.Masked())
+	}
+	return networks, nil
+}
@@ -0,0 +1,61 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.7"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		networks bool
+		remote   string
+		header   string
+		want     string
+	}{
+		{name: "no proxies configured", remote: "10.1.2.3:5000", header: "203.0.113.9", want: "10.1.2.3"},
+		{name: "trusted range", networks: true, remote: "10.1.2.3:5000", header: "203.0.113.9", want: "203.0.113.9"},
+		{name: "trusted address", networks: true, remote: "192.0.2.7:5000", header: "203.0.113.9", want: "203.0.113.9"},
+		{name: "untrusted peer", networks: true, remote: "198.51.100.4:5000", header: "203.0.113.9", want: "198.51.100.4"},
+		{name: "trusted without header", networks: true, remote: "10.1.2.3:5000", want: "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proxies TrustedProxies
+			if tt.networks {
+				proxies.Networks = networks
+			}
+
+			var got string
+			h := proxies.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.header != "" {
+				r.Header.Set("X-Forwarded-For", tt.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	for _, in := range []string{"not-an-ip", "10.0.0.0/99"} {
+		if _, err := ParseTrustedProxies([]string{in}); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) succeeded", in)
+		}
+	}
+}
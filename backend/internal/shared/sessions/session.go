@@ -2,168 +2,290 @@ package sessions
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"time"
-
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Manager issues session cookies and resolves them against a Store.
 type Manager struct {
-	DB *pgxpool.Pool
+	Store  Store
+	Config Config
 }
 
-func NewManager(db *pgxpool.Pool) *Manager {
-	return &Manager{DB: db}
+func NewManager(store Store, cfg Config) *Manager {
+	return &Manager{Store: store, Config: cfg.withDefaults()}
 }
 
 const (
-	sessionCookieName = "user_session"
-	sessionLifespan   = 7 * 24 * time.Hour // 7 days
+	anonymousLifespan = 15 * time.Minute // pre-login sessions
+	sessionTokenBytes = 32               // 256 bits of entropy
+	lastSeenInterval  = time.Minute      // throttle last_seen_at writes
 )
 
-func (m *Manager) SetUserID(w http.ResponseWriter, r *http.Request, userID int32) error {
-	sessionToken := generateSessionToken()
-	expiry := time.Now().Add(sessionLifespan)
-	userAgent := r.UserAgent()
+// impersonationLifespan is fixed; impersonation sessions never slide.
+const impersonationLifespan = time.Hour
+
+// SetUserID starts a brand new session for userID and sets the cookie.
+// Any session already attached to the request is destroyed first, so calling
+// this on login, OAuth callback or password change rotates the token and
+// makes session fixation impossible.
+//
+// A remembered session gets a persistent cookie and the RememberMe idle
+// timeout; otherwise the cookie ends with the browser session. Either way
+// it ends after AbsoluteLifetime.
+func (m *Manager) SetUserID(w http.ResponseWriter, r *http.Request, userID int32, remember bool) error {
+	lifespan := min(m.Config.idleTimeout(remember), m.Config.AbsoluteLifetime)
+	_, err := m.start(w, r, &userID, nil, lifespan, remember)
+	return err
+}
+
+// Rotate replaces the request's session with a new one for userID that is
+// remembered if the old one was. Call it after a credential change so a
+// token captured earlier stops working in this browser too.
+func (m *Manager) Rotate(w http.ResponseWriter, r *http.Request, userID int32) error {
+	remember := false
+	if token := m.Token(r); token != "" {
+		rec, err := m.live(r.Context(), token)
+		if err != nil {
+			return err
+		}
+		remember = rec != nil && rec.Persistent
+	}
+	return m.SetUserID(w, r, userID, remember)
+}
+
+// StartImpersonation replaces the request's session with one acting as
+// userID on behalf of impersonatorID. It lasts impersonationLifespan and is
+// not extended by activity.
+func (m *Manager) StartImpersonation(w http.ResponseWriter, r *http.Request, userID, impersonatorID int32) error {
+	_, err := m.start(w, r, &userID, &impersonatorID, impersonationLifespan, false)
+	return err
+}
 
-	args := pgx.NamedArgs{
-		"token":      sessionToken,
-		"user_id":    userID,
-		"expires_at": expiry,
-		"user_agent": userAgent,
+// ensureSession returns the raw token of the request's live session,
+// starting a short-lived anonymous one when there is none, so pre-login
+// flows (e.g. passkey challenges) have somewhere to Put their state.
+func (m *Manager) ensureSession(w http.ResponseWriter, r *http.Request) (string, error) {
+	if token := m.Token(r); token != "" {
+		rec, err := m.live(r.Context(), token)
+		if err != nil {
+			return "", err
+		}
+		if rec != nil {
+			return token, nil
+		}
 	}
 
-	_, err := m.DB.Exec(r.Context(), `
-		INSERT INTO auth.sessions (token, user_id, expires_at, user_agent)
-		VALUES (@token, @user_id, @expires_at, @user_agent)
-		ON CONFLICT (token) DO UPDATE SET 
-			expires_at = EXCLUDED.expires_at,
-			user_agent = EXCLUDED.user_agent
-	`, args)
+	return m.start(w, r, nil, nil, anonymousLifespan, false)
+}
 
+// live returns the session for token, or nil when it is unknown, expired
+// or past AbsoluteLifetime.
+func (m *Manager) live(ctx context.Context, token string) (*Record, error) {
+	rec, err := m.Store.Find(ctx, hashToken(token))
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
 	if err != nil {
-		fmt.Println("❌ failed to insert session:", err)
-		return fmt.Errorf("failed to insert session: %w", err)
+		return nil, fmt.Errorf("query session failed: %w", err)
 	}
 
-	fmt.Println("⚠️ session args:", args)
+	// Sessions older than AbsoluteLifetime are dead however recently
+	// they were used.
+	now := time.Now()
+	if !rec.ExpiresAt.After(now) || !rec.CreatedAt.After(now.Add(-m.Config.AbsoluteLifetime)) {
+		return nil, nil
+	}
+	return rec, nil
+}
 
-	cookie := &http.Cookie{
-		Name:     sessionCookieName,
-		Value:    sessionToken,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   false, // set true in production behind HTTPS
-		SameSite: http.SameSiteLaxMode,
-		Expires:  expiry,
+// Token returns the raw session token presented by the request, or "".
+func (m *Manager) Token(r *http.Request) string {
+	cookie, err := r.Cookie(m.Config.CookieName)
+	if err != nil {
+		return ""
 	}
-	http.SetCookie(w, cookie)
-	return nil
+	return cookie.Value
 }
 
-func (m *Manager) GetUserID(r *http.Request) (int32, error) {
-	cookie, err := r.Cookie(sessionCookieName)
+// start rotates away any existing session and stores a new one. A nil
+// userID creates an anonymous session. Only persistent sessions get a
+// cookie that outlives the browser.
+func (m *Manager) start(w http.ResponseWriter, r *http.Request, userID, impersonatorID *int32, lifespan time.Duration, persistent bool) (string, error) {
+	sessionToken, err := generateSessionToken()
 	if err != nil {
-		return 0, err
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	// Rotate: drop whatever session the browser presented before.
+	if token := m.Token(r); token != "" {
+		_ = m.Store.Delete(r.Context(), hashToken(token))
 	}
 
-	var userID int32
-	var expiresAt time.Time
+	err = m.Store.Create(r.Context(), &Record{
+		TokenHash:      hashToken(sessionToken),
+		UserID:         userID,
+		ImpersonatorID: impersonatorID,
+		UserAgent:      r.UserAgent(),
+		IPAddress:      ClientIP(r),
+		Persistent:     persistent,
+		ExpiresAt:      time.Now().Add(lifespan),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to insert session: %w", err)
+	}
 
-	args := pgx.NamedArgs{
-		"token": cookie.Value,
-		"now":   time.Now(),
+	// Persistent cookies last until the absolute deadline; the server-side
+	// expiry decides sooner when the session goes idle.
+	var cookieExpiry time.Time
+	if persistent {
+		cookieExpiry = time.Now().Add(m.Config.AbsoluteLifetime)
 	}
 
-	err = m.DB.QueryRow(r.Context(), `
-		SELECT user_id, expires_at FROM auth.sessions
-		WHERE token = @token AND expires_at > @now
-	`, args).Scan(&userID, &expiresAt)
+	cookie := m.Config.cookie(m.Config.CookieName, sessionToken, cookieExpiry)
+	cookie.HttpOnly = true
+	http.SetCookie(w, cookie)
+	// The CSRF token is bound to the session, so it rotates with it.
+	m.setCSRFCookie(w, csrfToken(sessionToken), cookieExpiry)
+	return sessionToken, nil
+}
+
+// SignedInAt returns when the request's session was started, or the zero
+// time without a live session. Every sign-in rotates the session, so this
+// is when the user last authenticated.
+func (m *Manager) SignedInAt(r *http.Request) time.Time {
+	token := m.Token(r)
+	if token == "" {
+		return time.Time{}
+	}
+	rec, err := m.live(r.Context(), token)
+	if err != nil || rec == nil {
+		return time.Time{}
+	}
+	return rec.CreatedAt
+}
 
+func (m *Manager) GetUserID(r *http.Request) (int32, error) {
+	userID, _, err := m.Identify(r)
+	return userID, err
+}
+
+// Identify returns the session's effective user and, for impersonation
+// sessions, the administrator behind it (0 otherwise). A userID of 0 means
+// no signed-in session.
+func (m *Manager) Identify(r *http.Request) (userID, impersonatorID int32, err error) {
+	cookie, err := r.Cookie(m.Config.CookieName)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, nil // no session found
-		}
-		return 0, fmt.Errorf("query session failed: %w", err)
+		return 0, 0, err
 	}
 
-	// Optionally: refresh session expiry on activity
-	newExpiry := time.Now().Add(sessionLifespan)
-	if newExpiry.Sub(expiresAt) > (10 * time.Minute) {
-		m.refreshExpiry(r.Context(), cookie.Value, newExpiry)
+	// Only the SHA-256 digest is stored, so the lookup never compares the
+	// secret itself and a timing side-channel reveals nothing useful.
+	rec, err := m.live(r.Context(), cookie.Value)
+	if err != nil {
+		return 0, 0, err
+	}
+	if rec == nil {
+		return 0, 0, nil // no session found
 	}
 
-	return userID, nil
-}
+	if rec.UserID == nil {
+		return 0, 0, nil // anonymous (pre-login) session
+	}
 
-func (m *Manager) refreshExpiry(ctx context.Context, token string, newExpiry time.Time) {
-	_, _ = m.DB.Exec(ctx, `
-		UPDATE auth.sessions SET expires_at = @expires_at WHERE token = @token
-	`, pgx.NamedArgs{
-		"token":      token,
-		"expires_at": newExpiry,
-	})
+	// Slide the idle expiry on activity, never past the absolute deadline.
+	newExpiry := time.Now().Add(m.Config.idleTimeout(rec.Persistent))
+	if deadline := rec.CreatedAt.Add(m.Config.AbsoluteLifetime); newExpiry.After(deadline) {
+		newExpiry = deadline
+	}
+	if rec.ImpersonatorID == nil && newExpiry.Sub(rec.ExpiresAt) > m.Config.RefreshThreshold {
+		_ = m.Store.SetExpiry(r.Context(), rec.TokenHash, newExpiry)
+	}
+
+	// Keep the device inventory current without writing on every request.
+	if time.Since(rec.LastSeenAt) > lastSeenInterval {
+		_ = m.Store.Touch(r.Context(), rec.TokenHash, ClientIP(r))
+	}
+
+	if rec.ImpersonatorID != nil {
+		impersonatorID = *rec.ImpersonatorID
+	}
+	return *rec.UserID, impersonatorID, nil
 }
 
 func (m *Manager) Clear(w http.ResponseWriter, r *http.Request) error {
-	cookie, err := r.Cookie(sessionCookieName)
+	cookie, err := r.Cookie(m.Config.CookieName)
 	if err != nil {
 		return nil // No session to clear
 	}
 
-	_, _ = m.DB.Exec(r.Context(), `
-		DELETE FROM auth.sessions WHERE token = @token
-	`, pgx.NamedArgs{"token": cookie.Value})
+	_ = m.Store.Delete(r.Context(), hashToken(cookie.Value))
 
 	// Expire the cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     sessionCookieName,
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
-	})
+	expired := m.Config.cookie(m.Config.CookieName, "", time.Unix(0, 0))
+	expired.HttpOnly = true
+	expired.MaxAge = -1
+	http.SetCookie(w, expired)
+
+	// Hand out a fresh pre-login token so the SPA can sign in again
+	// without fetching one first.
+	if csrf, err := generateSessionToken(); err == nil {
+		m.setCSRFCookie(w, csrf, time.Time{})
+	}
 	return nil
 }
 
-func (m *Manager) Put(ctx context.Context, token string, key string, value string) error {
-	_, err := m.DB.Exec(ctx, `
-		INSERT INTO auth.session_data (token, key, value)
-		VALUES (@token, @key, @value)
-		ON CONFLICT (token, key) DO UPDATE SET value = EXCLUDED.value
-	`, pgx.NamedArgs{
-		"token": token,
-		"key":   key,
-		"value": value,
-	})
-	return err
+// Put stores key on the request's session, starting an anonymous one when
+// the request has no live session yet.
+func (m *Manager) Put(w http.ResponseWriter, r *http.Request, key string, value string) error {
+	token, err := m.ensureSession(w, r)
+	if err != nil {
+		return err
+	}
+	return m.Store.Put(r.Context(), hashToken(token), key, value)
 }
 
-func (m *Manager) GetString(ctx context.Context, token string, key string) (string, error) {
-	var val string
-	err := m.DB.QueryRow(ctx, `
-		SELECT value FROM auth.session_data
-		WHERE token = @token AND key = @key
-	`, pgx.NamedArgs{
-		"token": token,
-		"key":   key,
-	}).Scan(&val)
+// Remove deletes a single key from the request's session data.
+func (m *Manager) Remove(r *http.Request, key string) error {
+	token := m.Token(r)
+	if token == "" {
+		return nil
+	}
+	return m.Store.Remove(r.Context(), hashToken(token), key)
+}
 
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return "", nil
-		}
+// GetString returns key from the request's session data, or "" when it is
+// unset or the session is gone or expired.
+func (m *Manager) GetString(r *http.Request, key string) (string, error) {
+	token := m.Token(r)
+	if token == "" {
+		return "", nil
+	}
+	rec, err := m.live(r.Context(), token)
+	if err != nil || rec == nil {
+		return "", err
+	}
+	return m.Store.Get(r.Context(), rec.TokenHash, key)
+}
+
+// generateSessionToken returns a URL-safe, 256-bit random session token.
+func generateSessionToken() (string, error) {
+	b := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(b); err != nil {
 		return "", err
 	}
-	return val, nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-// generateSessionToken generates a new session token
-func generateSessionToken() string {
-	return strconv.FormatInt(time.Now().UnixNano(), 36) // simplistic token for now
+// hashToken returns the hex SHA-256 digest that is persisted in place of the
+// raw token. A database leak therefore never yields usable cookies.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,188 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestManager() (*Manager, *MemoryStore) {
+	store := NewMemoryStore()
+	return NewManager(store, Config{AbsoluteLifetime: time.Hour}), store
+}
+
+// signIn starts a session for userID and returns a request carrying its
+// cookie, as the browser's next request would.
+func signIn(t *testing.T, m *Manager, prev *http.Request, userID int32) *http.Request {
+	t.Helper()
+	if prev == nil {
+		prev = httptest.NewRequest(http.MethodPost, "/login", nil)
+	}
+	w := httptest.NewRecorder()
+	if err := m.SetUserID(w, prev, userID, false); err != nil {
+		t.Fatalf("SetUserID: %v", err)
+	}
+	return withCookies(m, w)
+}
+
+// withCookies builds a request presenting the session cookie set on w.
+func withCookies(m *Manager, w *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		if c.Name == m.Config.CookieName {
+			r.AddCookie(c)
+		}
+	}
+	return r
+}
+
+func identify(t *testing.T, m *Manager, r *http.Request) int32 {
+	t.Helper()
+	userID, _, err := m.Identify(r)
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	return userID
+}
+
+func TestSetUserIDRotatesSession(t *testing.T) {
+	m, store := newTestManager()
+
+	first := signIn(t, m, nil, 1)
+	if got := identify(t, m, first); got != 1 {
+		t.Fatalf("user = %d, want 1", got)
+	}
+
+	second := signIn(t, m, first, 1)
+	if m.Token(first) == m.Token(second) {
+		t.Fatal("sign-in reused the previous token")
+	}
+	if got := identify(t, m, first); got != 0 {
+		t.Fatalf("old token still signed in as %d", got)
+	}
+	if got := identify(t, m, second); got != 1 {
+		t.Fatalf("user = %d, want 1", got)
+	}
+	if n := len(store.sessions); n != 1 {
+		t.Fatalf("store holds %d sessions, want 1", n)
+	}
+}
+
+func TestAbsoluteLifetime(t *testing.T) {
+	m, store := newTestManager()
+	r := signIn(t, m, nil, 1)
+
+	// Keep the idle expiry fresh but age the session past the cap.
+	rec := store.sessions[hashToken(m.Token(r))]
+	rec.CreatedAt = time.Now().Add(-m.Config.AbsoluteLifetime - time.Minute)
+	rec.ExpiresAt = time.Now().Add(time.Hour)
+
+	if got := identify(t, m, r); got != 0 {
+		t.Fatalf("session past its absolute lifetime signed in as %d", got)
+	}
+	if !m.SignedInAt(r).IsZero() {
+		t.Fatal("SignedInAt reported a dead session")
+	}
+}
+
+func TestIdentifyNeverSlidesPastAbsoluteLifetime(t *testing.T) {
+	m, store := newTestManager()
+	r := signIn(t, m, nil, 1)
+
+	rec := store.sessions[hashToken(m.Token(r))]
+	rec.CreatedAt = time.Now().Add(-m.Config.AbsoluteLifetime + time.Minute)
+	rec.ExpiresAt = time.Now().Add(time.Second)
+
+	identify(t, m, r)
+
+	deadline := rec.CreatedAt.Add(m.Config.AbsoluteLifetime)
+	if rec.ExpiresAt.After(deadline) {
+		t.Fatalf("expiry %v slid past the absolute deadline %v", rec.ExpiresAt, deadline)
+	}
+}
+
+func TestPutGetString(t *testing.T) {
+	m, _ := newTestManager()
+
+	// Put without a session starts an anonymous one.
+	w := httptest.NewRecorder()
+	if err := m.Put(w, httptest.NewRequest(http.MethodPost, "/", nil), "challenge", "abc"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	r := withCookies(m, w)
+
+	if got, err := m.GetString(r, "challenge"); err != nil || got != "abc" {
+		t.Fatalf("GetString = %q, %v; want abc", got, err)
+	}
+	if got := identify(t, m, r); got != 0 {
+		t.Fatalf("anonymous session identified as %d", got)
+	}
+
+	if err := m.Remove(r, "challenge"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got, _ := m.GetString(r, "challenge"); got != "" {
+		t.Fatalf("GetString after Remove = %q", got)
+	}
+
+	// Signing in rotates the session and drops its data.
+	r = signIn(t, m, r, 1)
+	if got, _ := m.GetString(r, "challenge"); got != "" {
+		t.Fatalf("data survived rotation: %q", got)
+	}
+}
+
+func TestGetStringWithoutSession(t *testing.T) {
+	m, _ := newTestManager()
+
+	got, err := m.GetString(httptest.NewRequest(http.MethodGet, "/", nil), "challenge")
+	if err != nil || got != "" {
+		t.Fatalf("GetString = %q, %v; want empty", got, err)
+	}
+}
+
+func TestSweepBatches(t *testing.T) {
+	m, store := newTestManager()
+	ctx := context.Background()
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	for i := range 7 {
+		expires := past
+		if i >= 5 {
+			expires = future
+		}
+		if err := store.Create(ctx, &Record{TokenHash: fmt.Sprint(i), ExpiresAt: expires}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One live-looking session that is past the absolute lifetime.
+	store.sessions["6"].CreatedAt = time.Now().Add(-2 * m.Config.AbsoluteLifetime)
+
+	n, err := Sweeper{Sessions: m, BatchSize: 2}.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if n != 6 {
+		t.Fatalf("deleted %d sessions, want 6", n)
+	}
+	if _, ok := store.sessions["5"]; !ok || len(store.sessions) != 1 {
+		t.Fatalf("remaining sessions = %v, want only 5", store.sessions)
+	}
+}
+
+func TestSweepStopsOnCancel(t *testing.T) {
+	m, store := newTestManager()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_ = store.Create(context.Background(), &Record{TokenHash: "a", ExpiresAt: time.Now().Add(-time.Minute)})
+
+	n, err := Sweeper{Sessions: m, BatchSize: 1}.Sweep(ctx)
+	if err == nil || n != 0 {
+		t.Fatalf("Sweep = %d, %v; want 0 and the context error", n, err)
+	}
+}
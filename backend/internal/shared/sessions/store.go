@@ -0,0 +1,62 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Store.Find for unknown tokens.
+var ErrNotFound = errors.New("session not found")
+
+// Record is a stored session. Only the SHA-256 digest of the token is
+// kept, never the token itself.
+type Record struct {
+	TokenHash string
+	// ID is a stable surrogate for the token hash, safe to show clients.
+	// Store.Create assigns it.
+	ID int64
+	// UserID is nil for anonymous (pre-login) sessions; ImpersonatorID is
+	// set on sessions an administrator opened as UserID.
+	UserID         *int32
+	ImpersonatorID *int32
+	UserAgent      string
+	IPAddress      string
+	Persistent     bool
+	CreatedAt      time.Time
+	LastSeenAt     time.Time
+	ExpiresAt      time.Time
+}
+
+// Store persists sessions and their key/value data. Deleting a session
+// deletes its data too. Manager handles expiry, so lookups return expired
+// sessions as well; list methods only return unexpired ones.
+type Store interface {
+	// Create saves rec, filling in ID, CreatedAt and LastSeenAt.
+	Create(ctx context.Context, rec *Record) error
+	Find(ctx context.Context, tokenHash string) (*Record, error)
+	Delete(ctx context.Context, tokenHash string) error
+	SetExpiry(ctx context.Context, tokenHash string, expiresAt time.Time) error
+	// Touch records activity from ip.
+	Touch(ctx context.Context, tokenHash, ip string) error
+
+	// ListForUser returns userID's unexpired sessions, most recently used
+	// first.
+	ListForUser(ctx context.Context, userID int32) ([]Record, error)
+	// DeleteForUser deletes userID's session with the given ID.
+	DeleteForUser(ctx context.Context, userID int32, id int64) (bool, error)
+	// DeleteOthers deletes userID's sessions except keepHash.
+	DeleteOthers(ctx context.Context, userID int32, keepHash string) (int64, error)
+	// DeleteAll deletes userID's sessions and the impersonation sessions
+	// they opened.
+	DeleteAll(ctx context.Context, userID int32) (int64, error)
+
+	// DeleteExpired deletes up to limit sessions that expired or were
+	// created before createdBefore, returning how many went.
+	DeleteExpired(ctx context.Context, now, createdBefore time.Time, limit int) (int64, error)
+
+	Put(ctx context.Context, tokenHash, key, value string) error
+	// Get returns "" for unset keys.
+	Get(ctx context.Context, tokenHash, key string) (string, error)
+	Remove(ctx context.Context, tokenHash, key string) error
+}
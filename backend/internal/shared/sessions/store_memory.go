@@ -0,0 +1,192 @@
+package sessions
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in process memory. It is meant for tests and
+// single-process development: nothing survives a restart.
+type MemoryStore struct {
+	mu       sync.Mutex
+	nextID   int64
+	sessions map[string]*Record
+	data     map[string]map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: map[string]*Record{},
+		data:     map[string]map[string]string{},
+	}
+}
+
+func (s *MemoryStore) Create(_ context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	now := time.Now()
+	rec.ID = s.nextID
+	rec.CreatedAt = now
+	rec.LastSeenAt = now
+
+	stored := *rec
+	s.sessions[rec.TokenHash] = &stored
+	return nil
+}
+
+func (s *MemoryStore) Find(_ context.Context, tokenHash string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.sessions[tokenHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *rec
+	return &found, nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, tokenHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delete(tokenHash)
+	return nil
+}
+
+// delete removes a session and its data; s.mu must be held.
+func (s *MemoryStore) delete(tokenHash string) {
+	delete(s.sessions, tokenHash)
+	delete(s.data, tokenHash)
+}
+
+func (s *MemoryStore) SetExpiry(_ context.Context, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.sessions[tokenHash]; ok {
+		rec.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryStore) Touch(_ context.Context, tokenHash, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rec, ok := s.sessions[tokenHash]; ok {
+		rec.LastSeenAt = time.Now()
+		rec.IPAddress = ip
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListForUser(_ context.Context, userID int32) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var list []Record
+	for _, rec := range s.sessions {
+		if rec.UserID != nil && *rec.UserID == userID && rec.ExpiresAt.After(now) {
+			list = append(list, *rec)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeenAt.After(list[j].LastSeenAt)
+	})
+	return list, nil
+}
+
+func (s *MemoryStore) DeleteForUser(_ context.Context, userID int32, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, rec := range s.sessions {
+		if rec.ID == id && rec.UserID != nil && *rec.UserID == userID {
+			s.delete(hash)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) DeleteOthers(_ context.Context, userID int32, keepHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for hash, rec := range s.sessions {
+		if hash != keepHash && rec.UserID != nil && *rec.UserID == userID {
+			s.delete(hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) DeleteAll(_ context.Context, userID int32) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for hash, rec := range s.sessions {
+		if (rec.UserID != nil && *rec.UserID == userID) ||
+			(rec.ImpersonatorID != nil && *rec.ImpersonatorID == userID) {
+			s.delete(hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) DeleteExpired(_ context.Context, now, createdBefore time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for hash, rec := range s.sessions {
+		if n >= int64(limit) {
+			break
+		}
+		if !rec.ExpiresAt.After(now) || !rec.CreatedAt.After(createdBefore) {
+			s.delete(hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, tokenHash, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like the foreign key in Postgres, data needs a session to hang off.
+	if _, ok := s.sessions[tokenHash]; !ok {
+		return ErrNotFound
+	}
+	if s.data[tokenHash] == nil {
+		s.data[tokenHash] = map[string]string{}
+	}
+	s.data[tokenHash][key] = value
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, tokenHash, key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data[tokenHash][key], nil
+}
+
+func (s *MemoryStore) Remove(_ context.Context, tokenHash, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.data[tokenHash], key)
+	return nil
+}
@@ -0,0 +1,217 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iankencruz/sabiflow/internal/platform/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// PostgresStore keeps sessions in auth.sessions and their data in
+// auth.session_data.
+type PostgresStore struct {
+	DB database.DBTX
+}
+
+func NewPostgresStore(db database.DBTX) *PostgresStore {
+	return &PostgresStore{DB: db}
+}
+
+const recordColumns = `token_hash, id, user_id, impersonator_id, user_agent, ip_address, persistent,
+	created_at, last_seen_at, expires_at`
+
+func scanRecord(row pgx.Row) (*Record, error) {
+	var rec Record
+	err := row.Scan(
+		&rec.TokenHash,
+		&rec.ID,
+		&rec.UserID,
+		&rec.ImpersonatorID,
+		&rec.UserAgent,
+		&rec.IPAddress,
+		&rec.Persistent,
+		&rec.CreatedAt,
+		&rec.LastSeenAt,
+		&rec.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *PostgresStore) Create(ctx context.Context, rec *Record) error {
+	args := pgx.NamedArgs{
+		"token_hash":      rec.TokenHash,
+		"user_id":         rec.UserID,
+		"impersonator_id": rec.ImpersonatorID,
+		"expires_at":      rec.ExpiresAt,
+		"user_agent":      rec.UserAgent,
+		"ip_address":      rec.IPAddress,
+		"persistent":      rec.Persistent,
+	}
+
+	return s.DB.QueryRow(ctx, `
+		INSERT INTO auth.sessions (token_hash, user_id, impersonator_id, expires_at, user_agent, ip_address, persistent)
+		VALUES (@token_hash, @user_id, @impersonator_id, @expires_at, @user_agent, @ip_address, @persistent)
+		RETURNING id, created_at, last_seen_at
+	`, args).Scan(&rec.ID, &rec.CreatedAt, &rec.LastSeenAt)
+}
+
+func (s *PostgresStore) Find(ctx context.Context, tokenHash string) (*Record, error) {
+	rec, err := scanRecord(s.DB.QueryRow(ctx, `
+		SELECT `+recordColumns+` FROM auth.sessions WHERE token_hash = @token_hash
+	`, pgx.NamedArgs{"token_hash": tokenHash}))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return rec, err
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, tokenHash string) error {
+	_, err := s.DB.Exec(ctx, `
+		DELETE FROM auth.sessions WHERE token_hash = @token_hash
+	`, pgx.NamedArgs{"token_hash": tokenHash})
+	return err
+}
+
+func (s *PostgresStore) SetExpiry(ctx context.Context, tokenHash string, expiresAt time.Time) error {
+	_, err := s.DB.Exec(ctx, `
+		UPDATE auth.sessions SET expires_at = @expires_at WHERE token_hash = @token_hash
+	`, pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"expires_at": expiresAt,
+	})
+	return err
+}
+
+func (s *PostgresStore) Touch(ctx context.Context, tokenHash, ip string) error {
+	_, err := s.DB.Exec(ctx, `
+		UPDATE auth.sessions SET last_seen_at = now(), ip_address = @ip_address
+		WHERE token_hash = @token_hash
+	`, pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"ip_address": ip,
+	})
+	return err
+}
+
+func (s *PostgresStore) ListForUser(ctx context.Context, userID int32) ([]Record, error) {
+	rows, err := s.DB.Query(ctx, `
+		SELECT `+recordColumns+`
+		FROM auth.sessions
+		WHERE user_id = @user_id AND expires_at > now()
+		ORDER BY last_seen_at DESC
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Record
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *rec)
+	}
+	return list, rows.Err()
+}
+
+func (s *PostgresStore) DeleteForUser(ctx context.Context, userID int32, id int64) (bool, error) {
+	tag, err := s.DB.Exec(ctx, `
+		DELETE FROM auth.sessions WHERE id = @id AND user_id = @user_id
+	`, pgx.NamedArgs{
+		"id":      id,
+		"user_id": userID,
+	})
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *PostgresStore) DeleteOthers(ctx context.Context, userID int32, keepHash string) (int64, error) {
+	tag, err := s.DB.Exec(ctx, `
+		DELETE FROM auth.sessions WHERE user_id = @user_id AND token_hash <> @keep_hash
+	`, pgx.NamedArgs{
+		"user_id":   userID,
+		"keep_hash": keepHash,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *PostgresStore) DeleteAll(ctx context.Context, userID int32) (int64, error) {
+	tag, err := s.DB.Exec(ctx, `
+		DELETE FROM auth.sessions WHERE user_id = @user_id OR impersonator_id = @user_id
+	`, pgx.NamedArgs{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteExpired removes one batch; auth.session_data rows go with their
+// sessions via ON DELETE CASCADE.
+func (s *PostgresStore) DeleteExpired(ctx context.Context, now, createdBefore time.Time, limit int) (int64, error) {
+	tag, err := s.DB.Exec(ctx, `
+		DELETE FROM auth.sessions
+		WHERE token_hash IN (
+			SELECT token_hash FROM auth.sessions
+			WHERE expires_at <= @now OR created_at <= @created_before
+			LIMIT @limit
+		)
+	`, pgx.NamedArgs{
+		"now":            now,
+		"created_before": createdBefore,
+		"limit":          limit,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *PostgresStore) Put(ctx context.Context, tokenHash, key, value string) error {
+	_, err := s.DB.Exec(ctx, `
+		INSERT INTO auth.session_data (token_hash, key, value)
+		VALUES (@token_hash, @key, @value)
+		ON CONFLICT (token_hash, key) DO UPDATE SET value = EXCLUDED.value
+	`, pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"key":        key,
+		"value":      value,
+	})
+	return err
+}
+
+func (s *PostgresStore) Get(ctx context.Context, tokenHash, key string) (string, error) {
+	var val string
+	err := s.DB.QueryRow(ctx, `
+		SELECT value FROM auth.session_data
+		WHERE token_hash = @token_hash AND key = @key
+	`, pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"key":        key,
+	}).Scan(&val)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return val, err
+}
+
+func (s *PostgresStore) Remove(ctx context.Context, tokenHash, key string) error {
+	_, err := s.DB.Exec(ctx, `
+		DELETE FROM auth.session_data WHERE token_hash = @token_hash AND key = @key
+	`, pgx.NamedArgs{
+		"token_hash": tokenHash,
+		"key":        key,
+	})
+	return err
+}
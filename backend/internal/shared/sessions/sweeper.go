@@ -0,0 +1,83 @@
+package sessions
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Defaults for zero Sweeper fields.
+const (
+	DefaultSweepInterval  = 15 * time.Minute
+	DefaultSweepBatchSize = 500
+)
+
+// Sweeper periodically purges expired sessions, and with them their
+// session data, which would otherwise pile up forever. Deletes run in
+// batches of BatchSize so one sweep never holds a long lock on the table.
+type Sweeper struct {
+	Sessions  *Manager
+	Interval  time.Duration
+	BatchSize int
+	Logger    *slog.Logger
+}
+
+// Run sweeps once straight away and then every Interval until ctx is
+// cancelled. It returns once the batch in flight, if any, has finished.
+func (s Sweeper) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultSweepInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Sweep(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			s.log().Error("session sweep failed", "error", err, "deleted", n)
+		case n > 0:
+			s.log().Info("expired sessions purged", "deleted", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes expired sessions batch by batch until none are left or ctx
+// is cancelled, and returns how many it deleted.
+func (s Sweeper) Sweep(ctx context.Context) (int64, error) {
+	batch := s.BatchSize
+	if batch <= 0 {
+		batch = DefaultSweepBatchSize
+	}
+
+	var total int64
+	for ctx.Err() == nil {
+		// Sessions past the absolute lifetime are dead even if their
+		// sliding expiry has not passed yet.
+		now := time.Now()
+		n, err := s.Sessions.Store.DeleteExpired(ctx, now, now.Add(-s.Sessions.Config.AbsoluteLifetime), batch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(batch) {
+			break
+		}
+	}
+	return total, ctx.Err()
+}
+
+func (s Sweeper) log() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+	return s.Logger
+}
@@ -0,0 +1,117 @@
+package tenant
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/iankencruz/sabiflow/internal/shared/errors"
+	"github.com/iankencruz/sabiflow/internal/shared/response"
+)
+
+// Header is the request header naming the studio, e.g. "X-Studio: acme".
+const Header = "X-Studio"
+
+// Resolver works out which studio a request is for. It only records the
+// slug; membership is checked by RequireAuth when the principal is loaded.
+//
+// The first of these that names a studio wins:
+//
+//   - the X-Studio header;
+//   - a path under PathPrefix + "/s/{slug}", which is stripped so the rest
+//     routes as usual (with PathPrefix "/api/v1", /api/v1/s/acme/projects
+//     is served as /api/v1/projects);
+//   - a subdomain of BaseDomain (acme.example.com with BaseDomain
+//     "example.com").
+//
+// Requests naming no studio use the caller's default studio.
+type Resolver struct {
+	// PathPrefix enables path addressing; empty disables it.
+	PathPrefix string
+	// BaseDomain enables subdomain addressing; empty disables it.
+	BaseDomain string
+}
+
+// Middleware records the requested studio in the context. Mount it on the
+// root router so path rewriting happens before routing.
+func (res Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slug := strings.TrimSpace(r.Header.Get(Header))
+
+		if fromPath, rest, ok := res.fromPath(r.URL.Path); ok {
+			if slug == "" {
+				slug = fromPath
+			}
+			r.URL.Path = rest
+			r.URL.RawPath = ""
+		}
+
+		if slug == "" {
+			slug = res.fromHost(r.Host)
+		}
+
+		if slug != "" {
+			r = r.WithContext(WithSlug(r.Context(), strings.ToLower(slug)))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fromPath splits PathPrefix/s/{slug}/rest into slug and PathPrefix/rest.
+func (res Resolver) fromPath(path string) (slug, rest string, ok bool) {
+	if res.PathPrefix == "" {
+		return "", "", false
+	}
+
+	base := strings.TrimSuffix(res.PathPrefix, "/")
+	tail, found := strings.CutPrefix(path, base+"/s/")
+	if !found {
+		return "", "", false
+	}
+
+	slug, rest, _ = strings.Cut(tail, "/")
+	if slug == "" {
+		return "", "", false
+	}
+	return slug, base + "/" + rest, true
+}
+
+// fromHost returns the subdomain label in front of BaseDomain, if any.
+func (res Resolver) fromHost(host string) string {
+	if res.BaseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	label, found := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(res.BaseDomain))
+	if !found || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// ReasonNoStudio is the error reason returned when a studio-scoped route
+// is called by a user who belongs to no studio.
+const ReasonNoStudio = "no_studio"
+
+// ReasonNotMember is the error reason returned when a request names a
+// studio the caller is not a member of.
+const ReasonNotMember = "not_studio_member"
+
+// Require blocks requests without an active studio. Mount it after
+// RequireAuth on routes whose data belongs to a studio.
+func Require() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := From(r.Context()); !ok {
+				errResp := errors.Forbidden("no active studio").WithReason(ReasonNoStudio)
+				_ = response.WriteJSON(w, errResp.Code, errResp.Message, errResp)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
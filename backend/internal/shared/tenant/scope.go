@@ -0,0 +1,37 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Arg is the named argument Where and Bind set to the active studio's ID.
+const Arg = "tenant_studio_id"
+
+// Where adds the active studio to args and returns the predicate limiting
+// rows of alias (a table with a studio_id column) to it:
+//
+//	args := pgx.NamedArgs{"limit": 50}
+//	where, err := tenant.Where(ctx, "p", args)
+//	query := `SELECT p.id, p.name FROM crm.projects p WHERE ` + where + ` LIMIT @limit`
+//
+// Without an active studio it fails with ErrNoStudio instead of returning
+// every studio's rows.
+func Where(ctx context.Context, alias string, args pgx.NamedArgs) (string, error) {
+	if err := Bind(ctx, args); err != nil {
+		return "", err
+	}
+	return alias + ".studio_id = @" + Arg, nil
+}
+
+// Bind adds the active studio to args for statements that write studio_id
+// themselves, e.g. INSERT ... VALUES (@tenant_studio_id, ...).
+func Bind(ctx context.Context, args pgx.NamedArgs) error {
+	id, err := ID(ctx)
+	if err != nil {
+		return err
+	}
+	args[Arg] = id
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package tenant scopes requests and queries to a studio.
+//
+// Resolver reads which studio a request asks for (header, path or
+// subdomain); RequireAuth then checks the caller is a member and stores the
+// active Studio in the context. Repositories filter studio-owned tables with
+// Where and Bind, so no query can see another studio's rows by accident.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNoStudio means a studio-scoped query ran without an active studio.
+	ErrNoStudio = errors.New("no active studio")
+	// ErrNotMember means the request named a studio the caller cannot use.
+	ErrNotMember = errors.New("not a member of the requested studio")
+)
+
+// Studio is a tenant: one business sharing the application with others.
+type Studio struct {
+	ID   int32  `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type studioKey struct{}
+
+type slugKey struct{}
+
+// WithStudio returns a copy of ctx whose active studio is s.
+func WithStudio(ctx context.Context, s *Studio) context.Context {
+	return context.WithValue(ctx, studioKey{}, s)
+}
+
+// From returns the active studio stored by RequireAuth, if any.
+func From(ctx context.Context) (*Studio, bool) {
+	s, ok := ctx.Value(studioKey{}).(*Studio)
+	return s, ok && s != nil
+}
+
+// ID returns the active studio's ID, or ErrNoStudio.
+func ID(ctx context.Context) (int32, error) {
+	s, ok := From(ctx)
+	if !ok {
+		return 0, ErrNoStudio
+	}
+	return s.ID, nil
+}
+
+// WithSlug records the studio a request asked for.
+func WithSlug(ctx context.Context, slug string) context.Context {
+	return context.WithValue(ctx, slugKey{}, slug)
+}
+
+// Slug returns the studio the request asked for; "" means the user's
+// default studio.
+func Slug(ctx context.Context) string {
+	slug, _ := ctx.Value(slugKey{}).(string)
+	return slug
+}
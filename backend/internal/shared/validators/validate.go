@@ -12,6 +12,13 @@ var (
 	LowercaseRX = regexp.MustCompile(`[a-z]`)
 	NumberRX    = regexp.MustCompile(`[0-9]`)
 	SpecialRX   = regexp.MustCompile(`[!@#\$%\^&\*]`)
+
+	// LocaleRX matches BCP 47 language tags such as "en", "en-AU" or
+	// "zh-Hant-TW".
+	LocaleRX = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+	// SlugRX matches URL and subdomain safe handles such as "acme-films".
+	SlugRX = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
 )
 
 type Validator struct {
@@ -0,0 +1,24 @@
+// The API refuses cookie-authenticated POST/PUT/PATCH/DELETE requests unless
+// they echo the csrf_token cookie in this header.
+export const CSRF_HEADER = 'X-CSRF-Token';
+
+function readCookie(name: string): string {
+	const match = document.cookie.split('; ').find((c) => c.startsWith(`${name}=`));
+	return match ? decodeURIComponent(match.slice(name.length + 1)) : '';
+}
+
+// Returns the current CSRF token, asking the API for one when the cookie is
+// missing (first visit, or the cookie was cleared).
+export async function csrfToken(): Promise<string> {
+	const token = readCookie('csrf_token');
+	if (token) return token;
+
+	const res = await fetch('/api/v1/auth/csrf', { credentials: 'include' });
+	const result = await res.json().catch(() => ({}));
+	return result.data?.csrfToken ?? '';
+}
+
+// Headers to add to an unsafe request.
+export async function csrfHeaders(): Promise<Record<string, string>> {
+	return { [CSRF_HEADER]: await csrfToken() };
+}
@@ -1,6 +1,7 @@
 
 import { goto } from '$app/navigation';
 import { getUserContext } from '$lib/stores/user.svelte';
+import { csrfHeaders } from '$lib/csrf';
 
 const BASE_URL = 'http://localhost:8080/api';
 
@@ -10,11 +11,15 @@ export async function fetchApi(endpoint: string, options: RequestInit = {}) {
 		credentials: 'include'
 	};
 
+	const method = (options.method ?? 'GET').toUpperCase();
+	const unsafe = !['GET', 'HEAD', 'OPTIONS'].includes(method);
+
 	const fetchOpts = {
 		...defaultOpts,
 		...options,
 		headers: {
 			...defaultOpts.headers,
+			...(unsafe ? await csrfHeaders() : {}),
 			...(options.headers || {})
 		}
 	};
@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- Existing tokens were stored in plaintext and are guessable; drop them all.
+-- auth.session_data rows go with them via ON DELETE CASCADE.
+DELETE FROM auth.sessions;
+
+ALTER TABLE auth.sessions
+ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE auth.sessions RENAME COLUMN token TO token_hash;
+ALTER TABLE auth.session_data RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+DELETE FROM auth.sessions;
+
+ALTER TABLE auth.session_data RENAME COLUMN token_hash TO token;
+ALTER TABLE auth.sessions RENAME COLUMN token_hash TO token;
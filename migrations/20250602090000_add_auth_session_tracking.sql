@@ -0,0 +1,18 @@
+
+-- +goose Up
+ALTER TABLE auth.sessions
+ADD COLUMN id BIGSERIAL UNIQUE,
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX auth_sessions_user_id_idx ON auth.sessions (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.auth_sessions_user_id_idx;
+
+ALTER TABLE auth.sessions
+DROP COLUMN last_seen_at,
+DROP COLUMN created_at,
+DROP COLUMN ip_address,
+DROP COLUMN id;
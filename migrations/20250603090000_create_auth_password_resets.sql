@@ -0,0 +1,15 @@
+
+-- +goose Up
+CREATE TABLE auth.password_resets (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_password_resets_user_id_idx ON auth.password_resets (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.password_resets;
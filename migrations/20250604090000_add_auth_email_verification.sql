@@ -0,0 +1,22 @@
+
+-- +goose Up
+ALTER TABLE auth.users
+ADD COLUMN email_verified_at TIMESTAMPTZ;
+
+CREATE TABLE auth.email_verifications (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  email TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_email_verifications_user_id_idx ON auth.email_verifications (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.email_verifications;
+
+ALTER TABLE auth.users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,38 @@
+
+-- +goose Up
+CREATE TABLE auth.user_totp (
+  user_id INTEGER PRIMARY KEY REFERENCES auth.users(id) ON DELETE CASCADE,
+  secret_encrypted BYTEA NOT NULL,
+  confirmed_at TIMESTAMPTZ,
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE auth.recovery_codes (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  code_hash TEXT NOT NULL,
+  used_at TIMESTAMPTZ,
+  UNIQUE (user_id, code_hash)
+);
+
+-- Short-lived tokens handed out after a correct password while the second
+-- factor is still outstanding.
+CREATE TABLE auth.mfa_challenges (
+  token_hash TEXT PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE auth.permission_groups
+ADD COLUMN require_2fa BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+ALTER TABLE auth.permission_groups
+DROP COLUMN require_2fa;
+
+DROP TABLE IF EXISTS auth.mfa_challenges;
+DROP TABLE IF EXISTS auth.recovery_codes;
+DROP TABLE IF EXISTS auth.user_totp;
@@ -0,0 +1,40 @@
+
+-- +goose Up
+-- Random, opaque WebAuthn user handle (never the numeric id).
+ALTER TABLE auth.users
+ADD COLUMN webauthn_handle BYTEA UNIQUE;
+
+CREATE TABLE auth.webauthn_credentials (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  credential_id BYTEA NOT NULL UNIQUE,
+  public_key BYTEA NOT NULL,
+  attestation_type TEXT NOT NULL DEFAULT '',
+  transports TEXT[] NOT NULL DEFAULT '{}',
+  aaguid BYTEA,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  clone_warning BOOLEAN NOT NULL DEFAULT false,
+  backup_eligible BOOLEAN NOT NULL DEFAULT false,
+  backup_state BOOLEAN NOT NULL DEFAULT false,
+  name TEXT NOT NULL DEFAULT 'Passkey',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX auth_webauthn_credentials_user_id_idx ON auth.webauthn_credentials (user_id);
+
+-- Passkey login needs somewhere to keep its challenge before anyone is
+-- signed in, so sessions may now be anonymous.
+ALTER TABLE auth.sessions
+ALTER COLUMN user_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM auth.sessions WHERE user_id IS NULL;
+
+ALTER TABLE auth.sessions
+ALTER COLUMN user_id SET NOT NULL;
+
+DROP TABLE IF EXISTS auth.webauthn_credentials;
+
+ALTER TABLE auth.users
+DROP COLUMN webauthn_handle;
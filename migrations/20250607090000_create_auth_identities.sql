@@ -0,0 +1,40 @@
+
+-- +goose Up
+CREATE TABLE auth.identities (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  provider TEXT NOT NULL,
+  subject TEXT NOT NULL,
+  email TEXT NOT NULL DEFAULT '',
+  linked_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_login_at TIMESTAMPTZ,
+  UNIQUE (provider, subject)
+);
+
+CREATE INDEX auth_identities_user_id_idx ON auth.identities (user_id);
+
+-- The old column never recorded the provider's subject, so existing OAuth
+-- users cannot be migrated; they are linked again on their next verified
+-- sign-in. That requires a verified address, which the provider vouched
+-- for when the account was created.
+UPDATE auth.users
+SET email_verified_at = now()
+WHERE provider <> 'email' AND email_verified_at IS NULL;
+
+ALTER TABLE auth.users
+DROP COLUMN provider;
+
+-- +goose Down
+ALTER TABLE auth.users
+ADD COLUMN provider TEXT DEFAULT 'email';
+
+UPDATE auth.users u
+SET provider = i.provider
+FROM (
+  SELECT DISTINCT ON (user_id) user_id, provider
+  FROM auth.identities
+  ORDER BY user_id, linked_at
+) i
+WHERE i.user_id = u.id AND u.password = '';
+
+DROP TABLE IF EXISTS auth.identities;
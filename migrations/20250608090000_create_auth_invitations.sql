@@ -0,0 +1,19 @@
+
+-- +goose Up
+CREATE TABLE auth.invitations (
+  id SERIAL PRIMARY KEY,
+  email TEXT NOT NULL,
+  group_id INTEGER NOT NULL REFERENCES auth.permission_groups(id) ON DELETE CASCADE,
+  token_hash TEXT NOT NULL UNIQUE,
+  invited_by INTEGER REFERENCES auth.users(id) ON DELETE SET NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  accepted_at TIMESTAMPTZ,
+  accepted_user_id INTEGER REFERENCES auth.users(id) ON DELETE SET NULL,
+  revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX auth_invitations_email_idx ON auth.invitations (lower(email));
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.invitations;
@@ -0,0 +1,12 @@
+
+-- +goose Up
+ALTER TABLE auth.users
+ADD COLUMN disabled_at TIMESTAMPTZ;
+
+CREATE INDEX auth_users_group_id_idx ON auth.users (group_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.auth_users_group_id_idx;
+
+ALTER TABLE auth.users
+DROP COLUMN disabled_at;
@@ -0,0 +1,11 @@
+
+-- +goose Up
+-- System groups cannot be renamed, deleted or have permissions removed.
+ALTER TABLE auth.permission_groups
+ADD COLUMN is_system BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE auth.permission_groups SET is_system = true WHERE name = 'Admin';
+
+-- +goose Down
+ALTER TABLE auth.permission_groups
+DROP COLUMN is_system;
@@ -0,0 +1,20 @@
+
+-- +goose Up
+CREATE TABLE auth.api_tokens (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  -- First characters of the raw token so users can tell tokens apart.
+  token_prefix TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  scopes TEXT[] NOT NULL DEFAULT '{}',
+  expires_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_used_at TIMESTAMPTZ,
+  last_used_ip TEXT
+);
+
+CREATE INDEX auth_api_tokens_user_id_idx ON auth.api_tokens (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.api_tokens;
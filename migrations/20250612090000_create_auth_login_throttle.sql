@@ -0,0 +1,14 @@
+
+-- +goose Up
+-- Failed sign-in counters, keyed by "account:<email>" or "ip:<address>".
+CREATE TABLE auth.login_throttle (
+  key TEXT PRIMARY KEY,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_until TIMESTAMPTZ
+);
+
+CREATE INDEX auth_login_throttle_last_failure_at_idx ON auth.login_throttle (last_failure_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.login_throttle;
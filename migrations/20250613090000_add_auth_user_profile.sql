@@ -0,0 +1,28 @@
+
+-- +goose Up
+ALTER TABLE auth.users
+  ADD COLUMN timezone TEXT NOT NULL DEFAULT 'UTC',
+  ADD COLUMN locale TEXT NOT NULL DEFAULT 'en',
+  ADD COLUMN avatar_url TEXT;
+
+-- Pending email changes; users.email only changes once the new address
+-- confirms.
+CREATE TABLE auth.email_changes (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  new_email TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_email_changes_user_id_idx ON auth.email_changes (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.email_changes;
+
+ALTER TABLE auth.users
+  DROP COLUMN IF EXISTS avatar_url,
+  DROP COLUMN IF EXISTS locale,
+  DROP COLUMN IF EXISTS timezone;
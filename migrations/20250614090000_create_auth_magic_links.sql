@@ -0,0 +1,18 @@
+
+-- +goose Up
+CREATE TABLE auth.magic_links (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  -- The address the link was mailed to; it stops working if the account's
+  -- email changes in the meantime.
+  email TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_magic_links_user_id_idx ON auth.magic_links (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.magic_links;
@@ -0,0 +1,24 @@
+
+-- +goose Up
+-- Set on sessions an administrator opened as another user; user_id is the
+-- effective (impersonated) user.
+ALTER TABLE auth.sessions
+  ADD COLUMN impersonator_id INTEGER REFERENCES auth.users(id) ON DELETE CASCADE;
+
+CREATE TABLE auth.audit_log (
+  id BIGSERIAL PRIMARY KEY,
+  actor_id INTEGER REFERENCES auth.users(id) ON DELETE SET NULL,
+  action TEXT NOT NULL,
+  target_user_id INTEGER REFERENCES auth.users(id) ON DELETE SET NULL,
+  ip_address TEXT NOT NULL DEFAULT '',
+  metadata JSONB NOT NULL DEFAULT '{}',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX auth_audit_log_actor_id_idx ON auth.audit_log (actor_id);
+CREATE INDEX auth_audit_log_target_user_id_idx ON auth.audit_log (target_user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS auth.audit_log;
+
+ALTER TABLE auth.sessions DROP COLUMN IF EXISTS impersonator_id;
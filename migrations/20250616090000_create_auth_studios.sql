@@ -0,0 +1,78 @@
+
+-- +goose Up
+CREATE TABLE auth.studios (
+  id SERIAL PRIMARY KEY,
+  -- URL-safe handle used in the X-Studio header, paths and subdomains.
+  slug TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Existing data becomes the first studio.
+INSERT INTO auth.studios (slug, name) VALUES ('main', 'Main studio');
+
+-- Permission groups belong to a studio; names are unique within it.
+ALTER TABLE auth.permission_groups
+ADD COLUMN studio_id INTEGER REFERENCES auth.studios(id) ON DELETE CASCADE;
+
+UPDATE auth.permission_groups SET studio_id = (SELECT id FROM auth.studios WHERE slug = 'main');
+
+ALTER TABLE auth.permission_groups
+ALTER COLUMN studio_id SET NOT NULL,
+DROP CONSTRAINT permission_groups_name_key,
+ADD CONSTRAINT permission_groups_studio_id_name_key UNIQUE (studio_id, name);
+
+-- A user's permission group is per studio, replacing users.group_id.
+CREATE TABLE auth.studio_members (
+  studio_id INTEGER NOT NULL REFERENCES auth.studios(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  group_id INTEGER REFERENCES auth.permission_groups(id) ON DELETE SET NULL,
+  joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (studio_id, user_id)
+);
+
+CREATE INDEX auth_studio_members_user_id_idx ON auth.studio_members (user_id);
+CREATE INDEX auth_studio_members_group_id_idx ON auth.studio_members (group_id);
+
+INSERT INTO auth.studio_members (studio_id, user_id, group_id)
+SELECT s.id, u.id, u.group_id
+FROM auth.users u, auth.studios s
+WHERE s.slug = 'main';
+
+ALTER TABLE auth.users DROP COLUMN group_id;
+
+-- The studio used when a request does not name one.
+ALTER TABLE auth.users
+ADD COLUMN default_studio_id INTEGER REFERENCES auth.studios(id) ON DELETE SET NULL;
+
+ALTER TABLE auth.invitations
+ADD COLUMN studio_id INTEGER REFERENCES auth.studios(id) ON DELETE CASCADE;
+
+UPDATE auth.invitations SET studio_id = (SELECT id FROM auth.studios WHERE slug = 'main');
+
+ALTER TABLE auth.invitations ALTER COLUMN studio_id SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE auth.invitations DROP COLUMN studio_id;
+ALTER TABLE auth.users DROP COLUMN default_studio_id;
+
+ALTER TABLE auth.users
+ADD COLUMN group_id INTEGER REFERENCES auth.permission_groups(id) ON DELETE SET NULL;
+
+UPDATE auth.users u
+SET group_id = m.group_id
+FROM auth.studio_members m
+JOIN auth.studios s ON s.id = m.studio_id
+WHERE m.user_id = u.id AND s.slug = 'main';
+
+DROP TABLE IF EXISTS auth.studio_members;
+
+DELETE FROM auth.permission_groups
+WHERE studio_id <> (SELECT id FROM auth.studios WHERE slug = 'main');
+
+ALTER TABLE auth.permission_groups
+DROP CONSTRAINT permission_groups_studio_id_name_key,
+ADD CONSTRAINT permission_groups_name_key UNIQUE (name),
+DROP COLUMN studio_id;
+
+DROP TABLE IF EXISTS auth.studios;
@@ -0,0 +1,26 @@
+
+-- +goose Up
+-- Personal data archives built for access requests; the archive is kept
+-- until expires_at so the user can download it.
+CREATE TABLE auth.data_exports (
+  id SERIAL PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+  requested_by INTEGER REFERENCES auth.users(id) ON DELETE SET NULL,
+  -- pending, ready or failed
+  status TEXT NOT NULL DEFAULT 'pending',
+  archive BYTEA,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  completed_at TIMESTAMPTZ,
+  expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX auth_data_exports_user_id_idx ON auth.data_exports (user_id);
+
+-- Set when an account is anonymised on an erasure request. The row stays
+-- so records that must be retained (invoices) keep a valid reference.
+ALTER TABLE auth.users
+ADD COLUMN erased_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE auth.users DROP COLUMN erased_at;
+DROP TABLE IF EXISTS auth.data_exports;
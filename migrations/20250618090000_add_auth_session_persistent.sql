@@ -0,0 +1,11 @@
+
+-- +goose Up
+-- "Remember me" sessions keep a persistent cookie and a longer idle
+-- timeout. Sessions from before this change had persistent cookies.
+ALTER TABLE auth.sessions
+ADD COLUMN persistent BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE auth.sessions SET persistent = true WHERE user_id IS NOT NULL;
+
+-- +goose Down
+ALTER TABLE auth.sessions DROP COLUMN persistent;
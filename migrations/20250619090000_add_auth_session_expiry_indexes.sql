@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- The session sweeper deletes by expiry and, past the absolute lifetime,
+-- by creation time.
+CREATE INDEX auth_sessions_expires_at_idx ON auth.sessions (expires_at);
+CREATE INDEX auth_sessions_created_at_idx ON auth.sessions (created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.auth_sessions_created_at_idx;
+DROP INDEX IF EXISTS auth.auth_sessions_expires_at_idx;
@@ -0,0 +1,25 @@
+
+-- +goose Up
+-- Accounts created before invitations existed never got a group, so on
+-- installs upgraded with users in place nobody holds users.invite and
+-- closed registration cannot be used. Make the earliest active member of
+-- each studio without an Admin its Admin, as a fresh install would.
+UPDATE auth.studio_members m
+SET group_id = pg.id
+FROM auth.permission_groups pg
+WHERE pg.studio_id = m.studio_id AND pg.name = 'Admin' AND pg.is_system
+  AND m.user_id = (
+    SELECT sm.user_id
+    FROM auth.studio_members sm
+    JOIN auth.users u ON u.id = sm.user_id
+    WHERE sm.studio_id = m.studio_id AND u.disabled_at IS NULL
+    ORDER BY u.created_at, u.id
+    LIMIT 1
+  )
+  AND NOT EXISTS (
+    SELECT 1 FROM auth.studio_members a
+    WHERE a.studio_id = m.studio_id AND a.group_id = pg.id
+  );
+
+-- +goose Down
+-- The previous groups were not recorded; owners keep the Admin group.
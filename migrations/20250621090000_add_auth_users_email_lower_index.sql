@@ -0,0 +1,8 @@
+
+-- +goose Up
+-- Emails are looked up case-insensitively, so two accounts must not differ
+-- only in case. Merge any such accounts before running this.
+CREATE UNIQUE INDEX auth_users_email_lower_idx ON auth.users (lower(email));
+
+-- +goose Down
+DROP INDEX IF EXISTS auth.auth_users_email_lower_idx;